@@ -7,7 +7,10 @@ import (
 
 	"github.com/Azure/InnovationEngine/internal/engine"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/spf13/cobra"
 )
 
@@ -19,7 +22,9 @@ func init() {
 	executeCommand.PersistentFlags().
 		Bool("verbose", false, "Enable verbose logging & standard output.")
 	executeCommand.PersistentFlags().
-		Bool("do-not-delete", false, "Do not delete the Azure resources created by the Azure CLI commands executed.")
+		Bool("do-not-delete", false, "Do not delete the Azure resources created by the Azure CLI commands executed, or destroy what terraform applied.")
+	executeCommand.PersistentFlags().
+		Bool("resume", false, "Resume the scenario after the last code block that succeeded, restoring the environment and working directory captured by its checkpoint.")
 
 	// String flags
 	executeCommand.PersistentFlags().
@@ -29,9 +34,30 @@ func init() {
 	executeCommand.PersistentFlags().
 		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
 
+	executeCommand.PersistentFlags().
+		String("profile", "", "Selects the section of the scenario's INI file to load variables from. Values in the [DEFAULT] section are loaded first and the selected section overrides them.")
+
+	// Int flags
+	executeCommand.PersistentFlags().
+		Int("from-step", 0, "Start the scenario from this step, restoring the state captured by its checkpoint when there is one.")
+
+	// Int64 flags
+	executeCommand.PersistentFlags().
+		Int64("seed", 0, "Seeds the values generated by the scenario's variables block. Reusing the seed of a previous run generates the same values. A new seed is used when not set.")
+
 	// StringArray flags
 	executeCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	executeCommand.PersistentFlags().
+		StringArray("env-file", []string{}, "Loads variables for the scenario from a dotenv or INI (.ini) file. Can be repeated, later files override earlier ones. Format: --env-file <path>")
+	executeCommand.PersistentFlags().
+		StringArray("only", []string{}, "Only runs the steps and code blocks matching the selector. Can be repeated. Format: --only <step number>, <step>.<code block>, tag:<tag> or a step name pattern")
+	executeCommand.PersistentFlags().
+		StringArray("skip", []string{}, "Skips the steps and code blocks matching the selector. Can be repeated. Format: --skip <step number>, <step>.<code block>, tag:<tag> or a step name pattern")
+
+	addOutputFlags(executeCommand)
+	addInterpreterFlags(executeCommand)
+	addStrictFlag(executeCommand)
 }
 
 var executeCommand = &cobra.Command{
@@ -46,6 +72,9 @@ var executeCommand = &cobra.Command{
 			os.Exit(1)
 		}
 
+		configureOutput(cmd)
+		interpreters := interpretersFromFlags(cmd)
+
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		doNotDelete, _ := cmd.Flags().GetBool("do-not-delete")
 
@@ -54,7 +83,17 @@ var executeCommand = &cobra.Command{
 		environment, _ := cmd.Flags().GetString("environment")
 		workingDirectory, _ := cmd.Flags().GetString("working-directory")
 
+		profile, _ := cmd.Flags().GetString("profile")
+		resume, _ := cmd.Flags().GetBool("resume")
+		fromStep, _ := cmd.Flags().GetInt("from-step")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		if !cmd.Flags().Changed("seed") {
+			seed = lib.NewSeed()
+		}
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		envFiles, _ := cmd.Flags().GetStringArray("env-file")
+		only, _ := cmd.Flags().GetStringArray("only")
+		skip, _ := cmd.Flags().GetStringArray("skip")
 		features, _ := cmd.Flags().GetStringArray("feature")
 
 		// Known features
@@ -95,14 +134,18 @@ var executeCommand = &cobra.Command{
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
+			shells.Languages(interpreters),
 			cliEnvironmentVariables,
+			profile,
+			envFiles,
+			seed,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
 			fmt.Printf("Error creating scenario: %s", err)
 			os.Exit(1)
 		}
+		applyStrictFlag(cmd, scenario)
 
 		innovationEngine, err := engine.NewEngine(engine.EngineConfiguration{
 			Verbose:          verbose,
@@ -112,6 +155,11 @@ var executeCommand = &cobra.Command{
 			Environment:      environment,
 			WorkingDirectory: workingDirectory,
 			RenderValues:     renderValues,
+			Resume:           resume,
+			FromStep:         fromStep,
+			Only:             only,
+			Skip:             skip,
+			Executor:         shells.BashExecutor{Interpreters: interpreters},
 		})
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating engine: %s", err)
@@ -123,7 +171,7 @@ var executeCommand = &cobra.Command{
 		err = innovationEngine.ExecuteScenario(scenario)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error executing scenario: %s", err)
-			fmt.Printf("Error executing scenario: %s\n", err)
+			fmt.Printf("Error executing scenario: %s\n", secrets.MaskError(err))
 			os.Exit(1)
 		}
 	},
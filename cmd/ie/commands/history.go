@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Azure/InnovationEngine/internal/engine/history"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// / Register the command with our command runner.
+func init() {
+	rootCommand.AddCommand(historyCommand)
+	historyCommand.PersistentFlags().
+		Int("limit", 20, "How many of the most recent runs to show. Use 0 to show every recorded run.")
+	historyCommand.PersistentFlags().
+		String("output", "text", "The format of the history. Valid options are 'text' and 'json'.")
+}
+
+var historyCommand = &cobra.Command{
+	Use:   "history [markdown file]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Show the pass/fail trend, flaky code blocks and durations of the recorded runs of a scenario.",
+	Run: func(cmd *cobra.Command, args []string) {
+		limit, _ := cmd.Flags().GetInt("limit")
+		output, _ := cmd.Flags().GetString("output")
+		if output != "text" && output != "json" {
+			logging.GlobalLogger.Errorf("Invalid output format: %s", output)
+			fmt.Printf("Invalid output format: %s\n", output)
+			os.Exit(1)
+		}
+
+		store, err := history.DefaultStore()
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error finding the history: %s", err)
+			fmt.Printf("Error finding the history: %s\n", err)
+			os.Exit(1)
+		}
+
+		scenarioPath := history.ResolveScenarioPath(args[0])
+		entries, err := store.Load(scenarioPath)
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error loading the history: %s", err)
+			fmt.Printf("Error loading the history: %s\n", err)
+			os.Exit(1)
+		}
+		if limit > 0 && len(entries) > limit {
+			entries = entries[len(entries)-limit:]
+		}
+
+		summary := history.Summarize(scenarioPath, entries)
+
+		if output == "json" {
+			contents, err := json.MarshalIndent(summary, "", "    ")
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error converting to json: %s", err)
+				fmt.Printf("Error converting to json: %s\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(contents))
+			return
+		}
+
+		fmt.Print(summary.Render())
+	},
+}
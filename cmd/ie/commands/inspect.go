@@ -3,10 +3,14 @@ package commands
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/Azure/InnovationEngine/internal/ui"
 	"github.com/spf13/cobra"
 )
@@ -23,9 +27,19 @@ func init() {
 	inspectCommand.PersistentFlags().
 		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
 
+	inspectCommand.PersistentFlags().
+		String("profile", "", "Selects the section of the scenario's INI file to load variables from. Values in the [DEFAULT] section are loaded first and the selected section overrides them.")
+
+	// Int64 flags
+	inspectCommand.PersistentFlags().
+		Int64("seed", 0, "Seeds the values generated by the scenario's variables block. Reusing the seed of a previous run generates the same values. A new seed is used when not set.")
+
 	// StringArray flags
 	inspectCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	inspectCommand.PersistentFlags().
+		StringArray("env-file", []string{}, "Loads variables for the scenario from a dotenv or INI (.ini) file. Can be repeated, later files override earlier ones. Format: --env-file <path>")
+	addInterpreterFlags(inspectCommand)
 }
 
 var inspectCommand = &cobra.Command{
@@ -39,7 +53,13 @@ var inspectCommand = &cobra.Command{
 			os.Exit(1)
 		}
 
+		profile, _ := cmd.Flags().GetString("profile")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		if !cmd.Flags().Changed("seed") {
+			seed = lib.NewSeed()
+		}
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		envFiles, _ := cmd.Flags().GetStringArray("env-file")
 		// features, _ := cmd.Flags().GetStringArray("feature")
 
 		// Parse the environment variables from the command line into a map
@@ -58,11 +78,16 @@ var inspectCommand = &cobra.Command{
 
 			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
 		}
+		interpreters := interpretersFromFlags(cmd)
+
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-inspect", "terraform"},
+			shells.Languages(interpreters),
 			cliEnvironmentVariables,
+			profile,
+			envFiles,
+			seed,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
@@ -77,6 +102,28 @@ var inspectCommand = &cobra.Command{
 		}
 
 		fmt.Println(ui.ScenarioTitleStyle.Render(scenario.Name))
+
+		// Show each variable along with the source that its value came from.
+		if len(scenario.VariableSources) > 0 {
+			fmt.Println(ui.StepTitleStyle.Render("  Variables\n"))
+			variableNames := make([]string, 0, len(scenario.VariableSources))
+			for name := range scenario.VariableSources {
+				variableNames = append(variableNames, name)
+			}
+			sort.Strings(variableNames)
+
+			maskedEnvironment := secrets.MaskVariables(scenario.Environment)
+			for _, name := range variableNames {
+				fmt.Printf(
+					"    %s=%s (from %s)\n",
+					name,
+					maskedEnvironment[name],
+					scenario.VariableSources[name],
+				)
+			}
+			fmt.Println()
+		}
+
 		for stepNumber, step := range scenario.Steps {
 			stepTitle := fmt.Sprintf("  %d. %s\n", stepNumber+1, step.Name)
 			fmt.Println(ui.StepTitleStyle.Render(stepTitle))
@@ -96,7 +143,7 @@ var inspectCommand = &cobra.Command{
 						fmt.Sprintf(
 							"      %s",
 							ui.InteractiveModeCodeBlockStyle.Render(
-								codeBlock.Content,
+								secrets.MaskString(codeBlock.Content),
 							),
 						),
 						6),
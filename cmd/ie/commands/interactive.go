@@ -7,7 +7,10 @@ import (
 
 	"github.com/Azure/InnovationEngine/internal/engine"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/spf13/cobra"
 )
 
@@ -23,9 +26,26 @@ func init() {
 	interactiveCommand.PersistentFlags().
 		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
 
+	interactiveCommand.PersistentFlags().
+		String("profile", "", "Selects the section of the scenario's INI file to load variables from. Values in the [DEFAULT] section are loaded first and the selected section overrides them.")
+
+	// Int64 flags
+	interactiveCommand.PersistentFlags().
+		Int64("seed", 0, "Seeds the values generated by the scenario's variables block. Reusing the seed of a previous run generates the same values. A new seed is used when not set.")
+
 	// StringArray flags
 	interactiveCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	interactiveCommand.PersistentFlags().
+		StringArray("env-file", []string{}, "Loads variables for the scenario from a dotenv or INI (.ini) file. Can be repeated, later files override earlier ones. Format: --env-file <path>")
+	interactiveCommand.PersistentFlags().
+		StringArray("only", []string{}, "Only runs the steps and code blocks matching the selector. Can be repeated. Format: --only <step number>, <step>.<code block>, tag:<tag> or a step name pattern")
+	interactiveCommand.PersistentFlags().
+		StringArray("skip", []string{}, "Skips the steps and code blocks matching the selector. Can be repeated. Format: --skip <step number>, <step>.<code block>, tag:<tag> or a step name pattern")
+
+	addOutputFlags(interactiveCommand)
+	addInterpreterFlags(interactiveCommand)
+	addStrictFlag(interactiveCommand)
 }
 
 var interactiveCommand = &cobra.Command{
@@ -39,6 +59,9 @@ var interactiveCommand = &cobra.Command{
 			os.Exit(1)
 		}
 
+		configureOutput(cmd)
+		interpreters := interpretersFromFlags(cmd)
+
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		doNotDelete, _ := cmd.Flags().GetBool("do-not-delete")
 
@@ -47,8 +70,16 @@ var interactiveCommand = &cobra.Command{
 		environment, _ := cmd.Flags().GetString("environment")
 		workingDirectory, _ := cmd.Flags().GetString("working-directory")
 
+		profile, _ := cmd.Flags().GetString("profile")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		if !cmd.Flags().Changed("seed") {
+			seed = lib.NewSeed()
+		}
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
-		// features, _ := cmd.Flags().GetStringArray("feature")
+		envFiles, _ := cmd.Flags().GetStringArray("env-file")
+		only, _ := cmd.Flags().GetStringArray("only")
+		skip, _ := cmd.Flags().GetStringArray("skip")
+		features, _ := cmd.Flags().GetStringArray("feature")
 
 		// Known features
 		renderValues := false
@@ -69,17 +100,36 @@ var interactiveCommand = &cobra.Command{
 
 			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
 		}
+
+		for _, feature := range features {
+			switch feature {
+			case "render-values":
+				renderValues = true
+			default:
+				logging.GlobalLogger.Errorf(
+					"Error: Invalid feature: %s",
+					feature,
+				)
+				fmt.Printf("Error: Invalid feature: %s\n", feature)
+				cmd.Help()
+				os.Exit(1)
+			}
+		}
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
+			shells.Languages(interpreters),
 			cliEnvironmentVariables,
+			profile,
+			envFiles,
+			seed,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
 			fmt.Printf("Error creating scenario: %s", err)
 			os.Exit(1)
 		}
+		applyStrictFlag(cmd, scenario)
 
 		innovationEngine, err := engine.NewEngine(engine.EngineConfiguration{
 			Verbose:          verbose,
@@ -89,6 +139,9 @@ var interactiveCommand = &cobra.Command{
 			Environment:      environment,
 			WorkingDirectory: workingDirectory,
 			RenderValues:     renderValues,
+			Only:             only,
+			Skip:             skip,
+			Executor:         shells.BashExecutor{Interpreters: interpreters},
 		})
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating engine: %s", err)
@@ -100,7 +153,7 @@ var interactiveCommand = &cobra.Command{
 		err = innovationEngine.InteractWithScenario(scenario)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error executing scenario: %s", err)
-			fmt.Printf("Error executing scenario: %s", err)
+			fmt.Printf("Error executing scenario: %s", secrets.MaskError(err))
 			os.Exit(1)
 		}
 	},
@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/spf13/cobra"
+)
+
+// Registers the --interpreter flag of a command that runs scenarios.
+func addInterpreterFlags(command *cobra.Command) {
+	command.PersistentFlags().
+		StringArray("interpreter", []string{}, "Runs the code blocks of a language with the command given, which receives the code block as its last argument. Adds the language when it isn't one of the defaults. The shell: prefix marks POSIX shells, which share the variables they export with the code blocks that follow. Can be repeated. Format: --interpreter <language>=[shell:]<command>")
+}
+
+// Gets the interpreters set with --interpreter, by language.
+func interpretersFromFlags(cmd *cobra.Command) map[string]shells.Interpreter {
+	values, _ := cmd.Flags().GetStringArray("interpreter")
+
+	interpreters := make(map[string]shells.Interpreter)
+	for _, value := range values {
+		language, interpreter, err := shells.ParseInterpreter(value)
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error parsing interpreter: %s", err)
+			fmt.Printf("Error parsing interpreter: %s\n", err)
+			os.Exit(1)
+		}
+		interpreters[language] = interpreter
+	}
+
+	return interpreters
+}
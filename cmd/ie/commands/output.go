@@ -0,0 +1,69 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/events"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// The formats of the output of the commands that run scenarios.
+const (
+	outputFormatText  = "text"
+	outputFormatJSONL = "jsonl"
+)
+
+// Registers the --output and --output-fd flags of a command that runs
+// scenarios.
+func addOutputFlags(command *cobra.Command) {
+	command.PersistentFlags().
+		String("output", outputFormatText, "The format of the output. Valid options are 'text' and 'jsonl', which writes an event per line as the scenario runs.")
+	command.PersistentFlags().
+		Int("output-fd", 1, "The file descriptor that --output jsonl writes events to. When it's 1, everything else ie writes to stdout goes to stderr instead.")
+}
+
+// Subscribes the writer of the events to the engine when --output jsonl is
+// set.
+func configureOutput(cmd *cobra.Command) {
+	output, _ := cmd.Flags().GetString("output")
+	switch output {
+	case outputFormatText:
+		return
+	case outputFormatJSONL:
+	default:
+		logging.GlobalLogger.Errorf("Invalid output format: %s", output)
+		fmt.Printf("Invalid output format: %s\n", output)
+		os.Exit(1)
+	}
+
+	fd, _ := cmd.Flags().GetInt("output-fd")
+
+	var writer io.Writer
+	switch fd {
+	case 1:
+		// Keep stdout to the events, so that it can be piped into other tools.
+		writer = os.Stdout
+		os.Stdout = os.Stderr
+	case 2:
+		writer = os.Stderr
+	default:
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		if file == nil {
+			logging.GlobalLogger.Errorf("Invalid file descriptor: %d", fd)
+			fmt.Printf("Invalid file descriptor: %d\n", fd)
+			os.Exit(1)
+		}
+		if _, err := file.Stat(); err != nil {
+			logging.GlobalLogger.Errorf("File descriptor %d isn't open: %s", fd, err)
+			fmt.Printf("File descriptor %d isn't open: %s\n", fd, err)
+			os.Exit(1)
+		}
+		writer = file
+	}
+
+	common.Events.Subscribe(events.NewJSONLWriter(writer))
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/engine"
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/spf13/cobra"
+)
+
+// / Register the command with our command runner.
+func init() {
+	rootCommand.AddCommand(replayCommand)
+	replayCommand.PersistentFlags().
+		Bool("verbose", false, "Enable verbose logging & standard output.")
+	replayCommand.PersistentFlags().
+		Bool("until-failure", false, "Stop at the code block the report recorded as failed instead of running the whole scenario.")
+	replayCommand.PersistentFlags().
+		String("subscription", "", "Sets the subscription ID used by a scenarios azure-cli commands. Will rely on the default subscription if not set.")
+	replayCommand.PersistentFlags().
+		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
+	replayCommand.PersistentFlags().
+		String("report", "", "The path to generate a report of the replay.")
+	replayCommand.PersistentFlags().
+		String("report-format", common.ReportFormatJSON, "The format of the report written with --report. Valid options are 'json', 'junit' and 'html'.")
+
+	replayCommand.PersistentFlags().
+		StringArray("var", []string{}, "Overrides a variable recorded by the report. Required for the secrets the report masks. Format: --var <key>=<value>")
+
+	addOutputFlags(replayCommand)
+	addInterpreterFlags(replayCommand)
+}
+
+var replayCommand = &cobra.Command{
+	Use:   "replay [json report]",
+	Args:  cobra.ExactArgs(1),
+	Short: "Run a scenario again from its test report, with the variable values it recorded.",
+	Run: func(cmd *cobra.Command, args []string) {
+		reportPath := args[0]
+		configureOutput(cmd)
+		interpreters := interpretersFromFlags(cmd)
+
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		untilFailure, _ := cmd.Flags().GetBool("until-failure")
+		subscription, _ := cmd.Flags().GetString("subscription")
+		workingDirectory, _ := cmd.Flags().GetString("working-directory")
+		environment, _ := cmd.Flags().GetString("environment")
+		reportFile, _ := cmd.Flags().GetString("report")
+		reportFormat, _ := cmd.Flags().GetString("report-format")
+		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+
+		if !common.IsValidReportFormat(reportFormat) {
+			logging.GlobalLogger.Errorf("Invalid report format: %s", reportFormat)
+			fmt.Printf("Invalid report format: %s\n", reportFormat)
+			os.Exit(1)
+		}
+
+		// Parse the environment variables from the command line into a map
+		cliEnvironmentVariables := make(map[string]string)
+		for _, environmentVariable := range environmentVariables {
+			keyValuePair := strings.SplitN(environmentVariable, "=", 2)
+			if len(keyValuePair) != 2 {
+				logging.GlobalLogger.Errorf(
+					"Error: Invalid environment variable format: %s",
+					environmentVariable,
+				)
+				fmt.Printf("Error: Invalid environment variable format: %s", environmentVariable)
+				cmd.Help()
+				os.Exit(1)
+			}
+
+			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
+		}
+
+		scenario, err := common.CreateScenarioFromReport(
+			reportPath,
+			cliEnvironmentVariables,
+			untilFailure,
+		)
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error creating scenario from report: %s", err)
+			fmt.Printf("Error creating scenario from report: %s\n", err)
+			os.Exit(1)
+		}
+
+		// Code blocks that were skipped by the original run are skipped again.
+		report, _, err := common.LoadReport(reportPath)
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error loading report: %s", err)
+			fmt.Printf("Error loading report: %s\n", err)
+			os.Exit(1)
+		}
+
+		innovationEngine, err := engine.NewEngine(engine.EngineConfiguration{
+			Verbose:          verbose,
+			DoNotDelete:      false,
+			Subscription:     subscription,
+			CorrelationId:    "",
+			WorkingDirectory: workingDirectory,
+			Environment:      environment,
+			ReportFile:       reportFile,
+			ReportFormat:     reportFormat,
+			Skip:             report.SkippedCodeBlockSelectors(),
+			Executor:         shells.BashExecutor{Interpreters: interpreters},
+		})
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error creating engine %s", err)
+			fmt.Printf("Error creating engine %s", err)
+			os.Exit(1)
+		}
+
+		err = innovationEngine.TestScenario(scenario)
+		if err != nil {
+			logging.GlobalLogger.Errorf("Error replaying scenario: %s", err)
+			fmt.Printf("Scenario did not finish successfully.")
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/spf13/cobra"
+)
+
+// / Register the command with our command runner.
+func init() {
+	rootCommand.AddCommand(reportCommand)
+	reportCommand.AddCommand(reportDiffCommand)
+
+	reportDiffCommand.PersistentFlags().
+		String("output", "text", "The format of the differences. Valid options are 'text' and 'json'.")
+}
+
+var reportCommand = &cobra.Command{
+	Use:   "report",
+	Short: "Work with the reports written by ie test.",
+}
+
+var reportDiffCommand = &cobra.Command{
+	Use:   "diff [earlier json report] [later json report]",
+	Args:  cobra.ExactArgs(2),
+	Short: "Show what changed between two reports of a scenario.",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		if output != "text" && output != "json" {
+			logging.GlobalLogger.Errorf("Invalid output format: %s", output)
+			fmt.Printf("Invalid output format: %s\n", output)
+			os.Exit(1)
+		}
+
+		var reports []*common.Report
+		for _, path := range args {
+			report, _, err := common.LoadReport(path)
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error loading report: %s", err)
+				fmt.Printf("Error loading report: %s\n", err)
+				os.Exit(1)
+			}
+			reports = append(reports, report)
+		}
+
+		diff := common.DiffReports(reports[0], reports[1])
+
+		if output == "json" {
+			contents, err := json.MarshalIndent(diff, "", "    ")
+			if err != nil {
+				logging.GlobalLogger.Errorf("Error converting to json: %s", err)
+				fmt.Printf("Error converting to json: %s\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(string(contents))
+			return
+		}
+
+		fmt.Print(diff.Render())
+	},
+}
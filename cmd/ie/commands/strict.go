@@ -0,0 +1,19 @@
+package commands
+
+import (
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/spf13/cobra"
+)
+
+// Registers the --strict flag of a command that runs scenarios.
+func addStrictFlag(command *cobra.Command) {
+	command.PersistentFlags().
+		Bool("strict", false, "Runs the code blocks in strict mode, which fails them when they use a variable that isn't set or a command of a pipeline fails. Code blocks can opt out with {strict=false}.")
+}
+
+// Runs the code blocks of the scenario in strict mode when --strict is set.
+func applyStrictFlag(cmd *cobra.Command, scenario *common.Scenario) {
+	if strict, _ := cmd.Flags().GetBool("strict"); strict {
+		scenario.EnableStrictMode()
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/Azure/InnovationEngine/internal/engine"
+	"github.com/Azure/InnovationEngine/internal/engine/batch"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/spf13/cobra"
 )
 
@@ -16,35 +20,87 @@ func init() {
 	rootCommand.AddCommand(testCommand)
 	testCommand.PersistentFlags().
 		Bool("verbose", false, "Enable verbose logging & standard output.")
+	testCommand.PersistentFlags().
+		Bool("no-history", false, "Don't record the run in the history shown by ie history.")
+	testCommand.PersistentFlags().
+		Bool("resume", false, "Resume the scenario after the last code block that succeeded, restoring the environment and working directory captured by its checkpoint.")
 	testCommand.PersistentFlags().
 		String("subscription", "", "Sets the subscription ID used by a scenarios azure-cli commands. Will rely on the default subscription if not set.")
 	testCommand.PersistentFlags().
 		String("working-directory", ".", "Sets the working directory for innovation engine to operate out of. Restores the current working directory when finished.")
 	testCommand.PersistentFlags().
-		String("report", "", "The path to generate a report of the scenario execution. The contents of the report are in JSON and will only be generated when this flag is set.")
+		String("report", "", "The path to generate a report of the scenario execution. The report is written in the format chosen by --report-format, JSON by default, and only when this flag is set.")
+	testCommand.PersistentFlags().
+		String("report-format", common.ReportFormatJSON, "The format of the report written with --report. Valid options are 'json', 'junit' and 'html'.")
+	testCommand.PersistentFlags().
+		String("profile", "", "Selects the section of the scenario's INI file to load variables from. Values in the [DEFAULT] section are loaded first and the selected section overrides them.")
+	testCommand.PersistentFlags().
+		Int("from-step", 0, "Start the scenario from this step, restoring the state captured by its checkpoint when there is one.")
+	testCommand.PersistentFlags().
+		Int("parallel", 1, "How many scenarios to test at the same time when testing a directory, a glob or several files.")
+	testCommand.PersistentFlags().
+		Bool("in-scenario-directory", false, "When testing several scenarios, runs each one in the directory that contains it instead of an empty working directory of its own.")
+	testCommand.PersistentFlags().
+		Int64("seed", 0, "Seeds the values generated by the scenario's variables block. Reusing the seed of a previous run generates the same values. A new seed is used when not set.")
 
 	testCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	testCommand.PersistentFlags().
+		StringArray("env-file", []string{}, "Loads variables for the scenario from a dotenv or INI (.ini) file. Can be repeated, later files override earlier ones. Format: --env-file <path>")
+	testCommand.PersistentFlags().
+		StringArray("only", []string{}, "Only runs the steps and code blocks matching the selector. Can be repeated. Format: --only <step number>, <step>.<code block>, tag:<tag> or a step name pattern")
+	testCommand.PersistentFlags().
+		StringArray("skip", []string{}, "Skips the steps and code blocks matching the selector. Can be repeated. Format: --skip <step number>, <step>.<code block>, tag:<tag> or a step name pattern")
+
+	addOutputFlags(testCommand)
+	addInterpreterFlags(testCommand)
+	addStrictFlag(testCommand)
 }
 
 var testCommand = &cobra.Command{
-	Use:   "test",
+	Use:   "test [markdown file | directory | directory/... | glob]...",
 	Args:  cobra.MinimumNArgs(1),
 	Short: "Test document commands against their expected outputs.",
 	Run: func(cmd *cobra.Command, args []string) {
+		reportFormat, _ := cmd.Flags().GetString("report-format")
+		if !common.IsValidReportFormat(reportFormat) {
+			logging.GlobalLogger.Errorf("Invalid report format: %s", reportFormat)
+			fmt.Printf("Invalid report format: %s\n", reportFormat)
+			os.Exit(1)
+		}
+
+		if batch.IsBatch(args) {
+			testScenarios(cmd, args)
+			return
+		}
+
 		markdownFile := args[0]
 		if markdownFile == "" {
 			cmd.Help()
 			return
 		}
 
+		configureOutput(cmd)
+		interpreters := interpretersFromFlags(cmd)
+
 		verbose, _ := cmd.Flags().GetBool("verbose")
 		subscription, _ := cmd.Flags().GetString("subscription")
 		workingDirectory, _ := cmd.Flags().GetString("working-directory")
 		environment, _ := cmd.Flags().GetString("environment")
 		generateReport, _ := cmd.Flags().GetString("report")
 
+		profile, _ := cmd.Flags().GetString("profile")
+		resume, _ := cmd.Flags().GetBool("resume")
+		noHistory, _ := cmd.Flags().GetBool("no-history")
+		fromStep, _ := cmd.Flags().GetInt("from-step")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		if !cmd.Flags().Changed("seed") {
+			seed = lib.NewSeed()
+		}
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		envFiles, _ := cmd.Flags().GetStringArray("env-file")
+		only, _ := cmd.Flags().GetStringArray("only")
+		skip, _ := cmd.Flags().GetStringArray("skip")
 
 		// Parse the environment variables from the command line into a map
 		cliEnvironmentVariables := make(map[string]string)
@@ -71,6 +127,13 @@ var testCommand = &cobra.Command{
 			WorkingDirectory: workingDirectory,
 			Environment:      environment,
 			ReportFile:       generateReport,
+			ReportFormat:     reportFormat,
+			Resume:           resume,
+			FromStep:         fromStep,
+			Only:             only,
+			Skip:             skip,
+			RecordHistory:    !noHistory,
+			Executor:         shells.BashExecutor{Interpreters: interpreters},
 		})
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating engine %s", err)
@@ -80,14 +143,18 @@ var testCommand = &cobra.Command{
 
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
+			shells.Languages(interpreters),
 			cliEnvironmentVariables,
+			profile,
+			envFiles,
+			seed,
 		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario %s", err)
 			fmt.Printf("Error creating engine %s", err)
 			os.Exit(1)
 		}
+		applyStrictFlag(cmd, scenario)
 
 		err = innovationEngine.TestScenario(scenario)
 		if err != nil {
@@ -97,3 +164,111 @@ var testCommand = &cobra.Command{
 		}
 	},
 }
+
+// Tests every scenario found in the arguments, each in a process of its own,
+// then prints a summary and writes an aggregate report.
+func testScenarios(cmd *cobra.Command, args []string) {
+	reportFile, _ := cmd.Flags().GetString("report")
+	reportFormat, _ := cmd.Flags().GetString("report-format")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	inScenarioDirectory, _ := cmd.Flags().GetBool("in-scenario-directory")
+
+	if reportFile != "" && reportFormat == common.ReportFormatHTML {
+		logging.GlobalLogger.Errorf("HTML reports can't be written when testing several scenarios")
+		fmt.Println("HTML reports can only be written when testing a single scenario. Use --report-format json or junit instead.")
+		os.Exit(1)
+	}
+
+	if output, _ := cmd.Flags().GetString("output"); output == outputFormatJSONL {
+		logging.GlobalLogger.Errorf("Events can't be written when testing several scenarios")
+		fmt.Println("--output jsonl can only be used when testing a single scenario.")
+		os.Exit(1)
+	}
+
+	scenarios, err := batch.Discover(args, shells.Languages(interpretersFromFlags(cmd)))
+	if err != nil {
+		logging.GlobalLogger.Errorf("Error finding scenarios: %s", err)
+		fmt.Printf("Error finding scenarios: %s\n", err)
+		os.Exit(1)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		logging.GlobalLogger.Errorf("Error finding the ie executable: %s", err)
+		fmt.Printf("Error finding the ie executable: %s\n", err)
+		os.Exit(1)
+	}
+
+	directory, err := os.MkdirTemp("", "ie-batch-")
+	if err != nil {
+		logging.GlobalLogger.Errorf("Error creating the batch directory: %s", err)
+		fmt.Printf("Error creating the batch directory: %s\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf(
+		"Testing %d scenarios, %d at a time. Output is kept in %s\n\n",
+		len(scenarios),
+		parallel,
+		directory,
+	)
+
+	envFiles, _ := cmd.Flags().GetStringArray("env-file")
+
+	start := time.Now()
+	results := batch.Run(batch.Configuration{
+		Executable:          executable,
+		Arguments:           forwardedTestArguments(cmd),
+		EnvFiles:            envFiles,
+		Parallel:            parallel,
+		Directory:           directory,
+		ReportFormat:        reportFormat,
+		InScenarioDirectory: inScenarioDirectory,
+	}, scenarios, func(result batch.Result) {
+		fmt.Println(batch.RenderProgress(result))
+	})
+
+	report := batch.BuildReport(results, time.Since(start))
+	fmt.Println()
+	fmt.Println(batch.RenderSummary(report))
+
+	if reportFile != "" {
+		if err := report.WriteToFile(reportFile, reportFormat); err != nil {
+			logging.GlobalLogger.Errorf("Error writing the batch report: %s", err)
+			fmt.Printf("Error writing the batch report: %s\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Report written to " + reportFile)
+	}
+
+	if !report.Success {
+		os.Exit(1)
+	}
+}
+
+// Gets the flags of `ie test` that apply to each scenario of a batch.
+func forwardedTestArguments(cmd *cobra.Command) []string {
+	var arguments []string
+
+	for _, name := range []string{"log-level", "subscription", "profile", "seed", "from-step"} {
+		if cmd.Flags().Changed(name) {
+			arguments = append(arguments, "--"+name, cmd.Flags().Lookup(name).Value.String())
+		}
+	}
+
+	for _, name := range []string{"verbose", "resume", "no-history", "strict"} {
+		if value, _ := cmd.Flags().GetBool(name); value {
+			arguments = append(arguments, "--"+name)
+		}
+	}
+
+	// Env files are passed on by the batch, which resolves their paths.
+	for _, name := range []string{"var", "only", "skip", "interpreter"} {
+		values, _ := cmd.Flags().GetStringArray(name)
+		for _, value := range values {
+			arguments = append(arguments, "--"+name, value)
+		}
+	}
+
+	return arguments
+}
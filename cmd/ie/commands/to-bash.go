@@ -8,7 +8,9 @@ import (
 
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/spf13/cobra"
 )
 
@@ -27,7 +29,13 @@ var toBashCommand = &cobra.Command{
 		}
 
 		environment, _ := cmd.Flags().GetString("environment")
+		profile, _ := cmd.Flags().GetString("profile")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		if !cmd.Flags().Changed("seed") {
+			seed = lib.NewSeed()
+		}
 		environmentVariables, _ := cmd.Flags().GetStringArray("var")
+		envFiles, _ := cmd.Flags().GetStringArray("env-file")
 
 		// Parse the environment variables
 		cliEnvironmentVariables := make(map[string]string)
@@ -49,11 +57,17 @@ var toBashCommand = &cobra.Command{
 			cliEnvironmentVariables[keyValuePair[0]] = keyValuePair[1]
 		}
 
+		interpreters := interpretersFromFlags(cmd)
+
 		// Parse the markdown file and create a scenario
 		scenario, err := common.CreateScenarioFromMarkdown(
 			markdownFile,
-			[]string{"bash", "azurecli", "azurecli-interactive", "terraform"},
-			cliEnvironmentVariables)
+			shells.Languages(interpreters),
+			cliEnvironmentVariables,
+			profile,
+			envFiles,
+			seed,
+		)
 		if err != nil {
 			logging.GlobalLogger.Errorf("Error creating scenario: %s", err)
 			fmt.Printf("Error creating scenario: %s", err)
@@ -63,7 +77,7 @@ var toBashCommand = &cobra.Command{
 		// If within cloudshell, we need to wrap the script in a json object to
 		// communicate it to the portal.
 		if environments.IsAzureEnvironment(environment) {
-			script := AzureScript{Script: scenario.ToShellScript()}
+			script := AzureScript{Script: scenario.ToShellScript(interpreters)}
 			scriptJson, err := json.Marshal(script)
 			if err != nil {
 				logging.GlobalLogger.Errorf("Error converting to json: %s", err)
@@ -73,7 +87,7 @@ var toBashCommand = &cobra.Command{
 
 			fmt.Printf("ie_us%sie_ue\n", scriptJson)
 		} else {
-			fmt.Printf("%s", scenario.ToShellScript())
+			fmt.Printf("%s", scenario.ToShellScript(interpreters))
 		}
 
 		return nil
@@ -82,6 +96,14 @@ var toBashCommand = &cobra.Command{
 
 func init() {
 	rootCommand.AddCommand(toBashCommand)
+	toBashCommand.PersistentFlags().
+		String("profile", "", "Selects the section of the scenario's INI file to load variables from. Values in the [DEFAULT] section are loaded first and the selected section overrides them.")
+	toBashCommand.PersistentFlags().
+		Int64("seed", 0, "Seeds the values generated by the scenario's variables block. Reusing the seed of a previous run generates the same values. A new seed is used when not set.")
+
 	toBashCommand.PersistentFlags().
 		StringArray("var", []string{}, "Sets an environment variable for the scenario. Format: --var <key>=<value>")
+	toBashCommand.PersistentFlags().
+		StringArray("env-file", []string{}, "Loads variables for the scenario from a dotenv or INI (.ini) file. Can be repeated, later files override earlier ones. Format: --env-file <path>")
+	addInterpreterFlags(toBashCommand)
 }
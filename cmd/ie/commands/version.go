@@ -1,6 +1,9 @@
 package commands
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/spf13/cobra"
+)
 
 var (
 	VERSION = "dev"
@@ -22,4 +25,8 @@ var versionCommand = &cobra.Command{
 
 func init() {
 	rootCommand.AddCommand(versionCommand)
+
+	// Stamp the reports written by ie with the build that wrote them.
+	common.IEVersion = VERSION
+	common.IECommit = COMMIT
 }
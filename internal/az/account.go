@@ -7,12 +7,12 @@ import (
 	"github.com/Azure/InnovationEngine/internal/shells"
 )
 
-func SetSubscription(subscription string) error {
+func SetSubscription(executor shells.Executor, subscription string) error {
 	if subscription != "" {
 		command := fmt.Sprintf("az account set --subscription %s", subscription)
-		_, err := shells.ExecuteBashCommand(
+		_, err := executor.Execute(
 			command,
-			shells.BashCommandConfiguration{
+			shells.CommandConfiguration{
 				EnvironmentVariables: map[string]string{},
 				InteractiveCommand:   false,
 				WriteToHistory:       false,
@@ -9,10 +9,10 @@ import (
 )
 
 // Find all the deployed resources in a resource group.
-func FindAllDeployedResourceURIs(resourceGroup string) []string {
-	output, err := shells.ExecuteBashCommand(
+func FindAllDeployedResourceURIs(executor shells.Executor, resourceGroup string) []string {
+	output, err := executor.Execute(
 		"az resource list -g "+resourceGroup,
-		shells.BashCommandConfiguration{
+		shells.CommandConfiguration{
 			EnvironmentVariables: map[string]string{},
 			InheritEnvironment:   true,
 			InteractiveCommand:   false,
@@ -0,0 +1,448 @@
+package batch
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// Configuration for testing several scenarios at once.
+type Configuration struct {
+	// The ie executable used to test each scenario.
+	Executable string
+	// Flags passed on to `ie test` for every scenario.
+	Arguments []string
+	// Env files passed on to `ie test` for every scenario. Relative paths are
+	// resolved against the current working directory, as `ie test` runs in a
+	// directory of its own.
+	EnvFiles []string
+	// How many scenarios are tested at the same time.
+	Parallel int
+	// Where the working directory, environment state, output and report of
+	// each scenario are kept.
+	Directory string
+	// The format of the report written for each scenario.
+	ReportFormat string
+	// Runs each scenario in the directory that contains it, so that it can use
+	// the files next to it, instead of an empty working directory of its own.
+	InScenarioDirectory bool
+}
+
+// The result of testing one scenario of a batch.
+type Result struct {
+	Path            string  `json:"path"`
+	Success         bool    `json:"success"`
+	Error           string  `json:"error"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Directory       string  `json:"directory"`
+	// The report written by `ie test` for the scenario, if it got that far.
+	Report json.RawMessage `json:"report,omitempty"`
+	// The same report when it was written as JUnit.
+	suite *common.JUnitTestSuite
+}
+
+// The aggregate report for a batch of scenarios.
+type Report struct {
+	Success         bool     `json:"success"`
+	Total           int      `json:"total"`
+	Passed          int      `json:"passed"`
+	Failed          int      `json:"failed"`
+	DurationSeconds float64  `json:"durationSeconds"`
+	Scenarios       []Result `json:"scenarios"`
+}
+
+func BuildReport(results []Result, duration time.Duration) Report {
+	report := Report{
+		Success:         true,
+		Total:           len(results),
+		DurationSeconds: duration.Seconds(),
+		Scenarios:       results,
+	}
+
+	for _, result := range results {
+		if result.Success {
+			report.Passed++
+		} else {
+			report.Failed++
+			report.Success = false
+		}
+	}
+
+	return report
+}
+
+// Writes the report to a file in the given format.
+func (report Report) WriteToFile(outputPath string, format string) error {
+	switch format {
+	case common.ReportFormatJSON, "":
+		return report.WriteToJSONFile(outputPath)
+	case common.ReportFormatJUnit:
+		return common.WriteJUnitFile(outputPath, report.ToJUnitTestSuites())
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+}
+
+// Combines the JUnit reports of the scenarios. Scenarios without a JUnit
+// report, i.e. because they failed before writing one, get a test suite with a
+// single test case for the whole scenario.
+func (report Report) ToJUnitTestSuites() common.JUnitTestSuites {
+	suites := common.JUnitTestSuites{Time: fmt.Sprintf("%.3f", report.DurationSeconds)}
+
+	for _, result := range report.Scenarios {
+		suite := result.suite
+		if suite == nil {
+			testCase := common.JUnitTestCase{
+				Name:      "Scenario",
+				ClassName: result.Path,
+				Time:      fmt.Sprintf("%.3f", result.DurationSeconds),
+			}
+			suite = &common.JUnitTestSuite{
+				Name:  result.Path,
+				Tests: 1,
+				Time:  testCase.Time,
+			}
+
+			if !result.Success {
+				message, _, _ := strings.Cut(result.Error, "\n")
+				testCase.Failure = &common.JUnitFailure{
+					Message:  message,
+					Type:     "ScenarioFailure",
+					Contents: result.Error,
+				}
+				suite.Failures = 1
+			}
+			suite.TestCases = []common.JUnitTestCase{testCase}
+		}
+
+		suites.Suites = append(suites.Suites, *suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Skipped += suite.Skipped
+	}
+
+	return suites
+}
+
+func (report Report) WriteToJSONFile(outputPath string) error {
+	// Secrets are masked before the report is encoded, as encoding escapes
+	// characters that secrets may contain.
+	masked := report
+	masked.Scenarios = make([]Result, len(report.Scenarios))
+	for index, result := range report.Scenarios {
+		result.Path = secrets.MaskString(result.Path)
+		result.Error = secrets.MaskString(result.Error)
+		result.Report = maskJSON(result.Report)
+		masked.Scenarios[index] = result
+	}
+
+	jsonReport, err := json.MarshalIndent(masked, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(outputPath, jsonReport, 0644); err != nil {
+		return err
+	}
+
+	logging.GlobalLogger.Infof("Wrote the batch report to %s", outputPath)
+	return nil
+}
+
+// Masks the secrets within the strings of a JSON document, such as the report
+// of a scenario. Documents that can't be decoded are dropped rather than
+// written without being masked.
+func maskJSON(document json.RawMessage) json.RawMessage {
+	if document == nil {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(document, &value); err != nil {
+		return nil
+	}
+
+	masked, err := json.Marshal(maskJSONValue(value))
+	if err != nil {
+		return nil
+	}
+	return masked
+}
+
+func maskJSONValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return secrets.MaskString(value)
+	case []interface{}:
+		for index, item := range value {
+			value[index] = maskJSONValue(item)
+		}
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = maskJSONValue(item)
+		}
+	}
+	return value
+}
+
+// Tests the scenarios, running up to configuration.Parallel of them at the
+// same time. Each scenario is tested by its own `ie test` process with an
+// isolated working directory and environment state, so that one scenario
+// can't affect the others and a failure doesn't stop the rest. onFinished is
+// called as each scenario finishes.
+func Run(configuration Configuration, scenarios []string, onFinished func(Result)) []Result {
+	parallel := configuration.Parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]Result, len(scenarios))
+	indexes := make(chan int)
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+
+	for worker := 0; worker < parallel; worker++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for index := range indexes {
+				result := runScenario(configuration, index, scenarios[index])
+				results[index] = result
+
+				if onFinished != nil {
+					mutex.Lock()
+					onFinished(result)
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for index := range scenarios {
+		indexes <- index
+	}
+	close(indexes)
+	waitGroup.Wait()
+
+	return results
+}
+
+var unsafeDirectoryCharacters = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// Tests a single scenario in a process of its own.
+func runScenario(configuration Configuration, index int, scenario string) Result {
+	result := Result{Path: scenario}
+
+	name := unsafeDirectoryCharacters.ReplaceAllString(
+		strings.TrimSuffix(scenario, filepath.Ext(scenario)),
+		"-",
+	)
+	name = strings.Trim(name, "-.")
+	if len(name) > 64 {
+		name = name[len(name)-64:]
+	}
+	directory := filepath.Join(configuration.Directory, fmt.Sprintf("%03d-%s", index+1, name))
+	workingDirectory := filepath.Join(directory, "work")
+	result.Directory = directory
+
+	if err := os.MkdirAll(workingDirectory, 0700); err != nil {
+		result.Error = fmt.Sprintf("failed to create the working directory: %s", err)
+		return result
+	}
+
+	scenarioPath := scenario
+	if !isRemote(scenario) {
+		if absolutePath, err := filepath.Abs(scenario); err == nil {
+			scenarioPath = absolutePath
+		}
+	}
+	if configuration.InScenarioDirectory && !isRemote(scenario) {
+		workingDirectory = filepath.Dir(scenarioPath)
+	}
+
+	reportPath := filepath.Join(directory, "report.json")
+	if configuration.ReportFormat == common.ReportFormatJUnit {
+		reportPath = filepath.Join(directory, "report.xml")
+	}
+	outputPath := filepath.Join(directory, "output.log")
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create the output file: %s", err)
+		return result
+	}
+	defer output.Close()
+
+	arguments := append([]string{
+		"test",
+		scenarioPath,
+		"--report", reportPath,
+		"--report-format", reportFormatOrDefault(configuration.ReportFormat),
+		"--working-directory", workingDirectory,
+		// There is no terminal to render the test UI to.
+		"--environment", "github-action",
+	}, configuration.Arguments...)
+	for _, envFile := range configuration.EnvFiles {
+		if absolutePath, err := filepath.Abs(envFile); err == nil {
+			envFile = absolutePath
+		}
+		arguments = append(arguments, "--env-file", envFile)
+	}
+
+	// The test UI reads its input from stdin and can't poll /dev/null, so the
+	// process gets a pipe that is never written to instead.
+	stdin, stdinWriter, err := os.Pipe()
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create the input pipe: %s", err)
+		return result
+	}
+	defer stdin.Close()
+	defer stdinWriter.Close()
+
+	command := exec.Command(configuration.Executable, arguments...)
+	command.Dir = directory
+	command.Stdin = stdin
+	command.Stdout = output
+	command.Stderr = output
+	command.Env = append(
+		os.Environ(),
+		lib.EnvironmentStateFileVariable+"="+filepath.Join(directory, "env-vars"),
+	)
+
+	logging.GlobalLogger.Infof("Testing %s in %s", scenario, directory)
+
+	start := time.Now()
+	runErr := command.Run()
+	result.DurationSeconds = time.Since(start).Seconds()
+
+	if fs.FileExists(reportPath) {
+		report, err := os.ReadFile(reportPath)
+		if err != nil {
+			logging.GlobalLogger.Warnf("Failed to load the report of %s: %s", scenario, err)
+		} else if configuration.ReportFormat == common.ReportFormatJUnit {
+			var suite common.JUnitTestSuite
+			if err := xml.Unmarshal(report, &suite); err != nil {
+				logging.GlobalLogger.Warnf("Failed to parse the report of %s: %s", scenario, err)
+			} else {
+				result.suite = &suite
+			}
+		} else if json.Valid(report) {
+			result.Report = report
+		}
+	}
+
+	result.Success = runErr == nil
+	if !result.Success {
+		result.Error = failureMessage(runErr, result, outputPath)
+	}
+
+	return result
+}
+
+func reportFormatOrDefault(format string) string {
+	if format == "" {
+		return common.ReportFormatJSON
+	}
+	return format
+}
+
+// Describes why a scenario failed, preferring the error from its report and
+// falling back to the end of its output.
+func failureMessage(runErr error, result Result, outputPath string) string {
+	var reported struct {
+		Error string `json:"error"`
+	}
+	if result.Report != nil && json.Unmarshal(result.Report, &reported) == nil && reported.Error != "" {
+		return reported.Error
+	}
+
+	if result.suite != nil {
+		for _, testCase := range result.suite.TestCases {
+			if testCase.Failure != nil {
+				return testCase.Failure.Message
+			}
+		}
+	}
+
+	if contents, err := os.ReadFile(outputPath); err == nil {
+		lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+		if len(lines) > 5 {
+			lines = lines[len(lines)-5:]
+		}
+		if tail := strings.TrimSpace(strings.Join(lines, "\n")); tail != "" {
+			return secrets.MaskString(tail)
+		}
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		return fmt.Sprintf("ie test exited with code %d", exitErr.ExitCode())
+	}
+	return runErr.Error()
+}
+
+// Renders the line shown when a scenario finishes.
+func RenderProgress(result Result) string {
+	if result.Success {
+		return fmt.Sprintf("%s %s (%.1fs)", ui.CheckStyle.Render("✔"), result.Path, result.DurationSeconds)
+	}
+	return fmt.Sprintf("%s %s (%.1fs)", ui.ErrorStyle.Render("✗"), result.Path, result.DurationSeconds)
+}
+
+// Renders the summary table of a batch.
+func RenderSummary(report Report) string {
+	width := len("Scenario")
+	for _, result := range report.Scenarios {
+		if len(result.Path) > width {
+			width = len(result.Path)
+		}
+	}
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "%-*s  %-6s  %9s  %s\n", width, "Scenario", "Result", "Duration", "Error")
+
+	for _, result := range report.Scenarios {
+		status := ui.CheckStyle.Render("passed")
+		firstLine := ""
+		if !result.Success {
+			status = ui.ErrorStyle.Render("failed")
+			firstLine, _, _ = strings.Cut(result.Error, "\n")
+		}
+		fmt.Fprintf(
+			&summary,
+			"%-*s  %s  %8.1fs  %s\n",
+			width,
+			result.Path,
+			status,
+			result.DurationSeconds,
+			firstLine,
+		)
+	}
+
+	fmt.Fprintf(
+		&summary,
+		"\n%d scenarios, %d passed, %d failed in %.1fs",
+		report.Total,
+		report.Passed,
+		report.Failed,
+		report.DurationSeconds,
+	)
+
+	return secrets.MaskString(summary.String())
+}
@@ -0,0 +1,180 @@
+package batch
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+// A stand in for `ie test` that writes a report and fails for scenarios with
+// "fail" in their name. It records the environment state file, working
+// directory and env files it was given.
+const fakeExecutable = `#!/bin/sh
+scenario="$2"
+while [ "$#" -gt 0 ]; do
+	if [ "$1" = "--report" ]; then report="$2"; fi
+	if [ "$1" = "--working-directory" ]; then echo "$2" > working-directory; fi
+	if [ "$1" = "--env-file" ]; then echo "$2" >> env-files; fi
+	shift
+done
+echo "$IE_ENVIRONMENT_STATE_FILE" > state-file
+case "$scenario" in
+*fail*)
+	echo '{"success": false, "error": "failed to execute code block 0 on step 0."}' > "$report"
+	exit 1
+	;;
+esac
+echo '{"success": true, "error": ""}' > "$report"
+`
+
+func TestRun(t *testing.T) {
+	directory := t.TempDir()
+	executable := filepath.Join(directory, "ie")
+	assert.NoError(t, os.WriteFile(executable, []byte(fakeExecutable), 0755))
+
+	scenarios := []string{"pass.md", "fail.md", "other.md"}
+	var finished []string
+
+	results := Run(Configuration{
+		Executable: executable,
+		Parallel:   2,
+		Directory:  filepath.Join(directory, "runs"),
+	}, scenarios, func(result Result) {
+		finished = append(finished, result.Path)
+	})
+
+	assert.ElementsMatch(t, scenarios, finished)
+	assert.Equal(t, 3, len(results))
+
+	t.Run("Results are kept in the order of the scenarios", func(t *testing.T) {
+		for index, scenario := range scenarios {
+			assert.Equal(t, scenario, results[index].Path)
+		}
+		assert.Equal(t, []bool{true, false, true}, []bool{
+			results[0].Success,
+			results[1].Success,
+			results[2].Success,
+		})
+		assert.Equal(t, "failed to execute code block 0 on step 0.", results[1].Error)
+	})
+
+	t.Run("Each scenario has its own environment state file", func(t *testing.T) {
+		for _, result := range results {
+			stateFile, err := os.ReadFile(filepath.Join(result.Directory, "state-file"))
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(result.Directory, "env-vars"), strings.TrimSpace(string(stateFile)))
+		}
+		assert.NotEqual(t, results[0].Directory, results[2].Directory)
+	})
+
+	t.Run("Each scenario has an empty working directory of its own", func(t *testing.T) {
+		for _, result := range results {
+			workingDirectory, err := os.ReadFile(filepath.Join(result.Directory, "working-directory"))
+			assert.NoError(t, err)
+			assert.Equal(t, filepath.Join(result.Directory, "work"), strings.TrimSpace(string(workingDirectory)))
+		}
+	})
+
+	t.Run("Scenarios can run in the directory that contains them", func(t *testing.T) {
+		scenarioDirectory := filepath.Join(directory, "scenarios", "storage")
+		assert.NoError(t, os.MkdirAll(scenarioDirectory, 0755))
+
+		results := Run(Configuration{
+			Executable:          executable,
+			Parallel:            1,
+			Directory:           filepath.Join(directory, "in-place"),
+			InScenarioDirectory: true,
+		}, []string{filepath.Join(scenarioDirectory, "README.md")}, func(Result) {})
+
+		workingDirectory, err := os.ReadFile(filepath.Join(results[0].Directory, "working-directory"))
+		assert.NoError(t, err)
+		assert.Equal(t, scenarioDirectory, strings.TrimSpace(string(workingDirectory)))
+	})
+
+	t.Run("Env files are passed on with their absolute paths", func(t *testing.T) {
+		results := Run(Configuration{
+			Executable: executable,
+			Parallel:   1,
+			Directory:  filepath.Join(directory, "env-files"),
+			EnvFiles:   []string{"my.env", "/etc/shared.env"},
+		}, []string{"pass.md"}, func(Result) {})
+
+		envFiles, err := os.ReadFile(filepath.Join(results[0].Directory, "env-files"))
+		assert.NoError(t, err)
+		workingDirectory, err := os.Getwd()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(workingDirectory, "my.env"),
+			"/etc/shared.env",
+		}, strings.Split(strings.TrimSpace(string(envFiles)), "\n"))
+	})
+
+	t.Run("The aggregate report counts the results", func(t *testing.T) {
+		report := BuildReport(results, time.Second)
+
+		assert.False(t, report.Success)
+		assert.Equal(t, 3, report.Total)
+		assert.Equal(t, 2, report.Passed)
+		assert.Equal(t, 1, report.Failed)
+
+		path := filepath.Join(directory, "report.json")
+		assert.NoError(t, report.WriteToJSONFile(path))
+
+		contents, err := os.ReadFile(path)
+		assert.NoError(t, err)
+
+		var written map[string]interface{}
+		assert.NoError(t, json.Unmarshal(contents, &written))
+		scenarios := written["scenarios"].([]interface{})
+		childReport := scenarios[1].(map[string]interface{})["report"].(map[string]interface{})
+		assert.Equal(t, false, childReport["success"])
+	})
+
+	t.Run("Secrets are masked even when JSON escapes them", func(t *testing.T) {
+		secret := `Pa<ss>&word`
+		secrets.Register(secret)
+		report := BuildReport([]Result{{
+			Path:   "login.md",
+			Error:  "failed to log in with " + secret,
+			Report: json.RawMessage(`{"success": false, "steps": [{"stdOut": "Pa\u003css\u003e\u0026word"}]}`),
+		}}, time.Second)
+
+		path := filepath.Join(directory, "secret-report.json")
+		assert.NoError(t, report.WriteToJSONFile(path))
+
+		contents, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.NotContains(t, string(contents), secret)
+		assert.NotContains(t, string(contents), "Pa\\u003css")
+
+		var written Report
+		assert.NoError(t, json.Unmarshal(contents, &written))
+		assert.Equal(t, "failed to log in with "+secrets.Mask, written.Scenarios[0].Error)
+		assert.JSONEq(t, `{"success": false, "steps": [{"stdOut": "`+secrets.Mask+`"}]}`, string(written.Scenarios[0].Report))
+	})
+
+	t.Run("Scenarios without a JUnit report get a failed test suite", func(t *testing.T) {
+		suites := BuildReport(results, time.Second).ToJUnitTestSuites()
+
+		assert.Equal(t, 3, len(suites.Suites))
+		assert.Equal(t, 3, suites.Tests)
+		assert.Equal(t, 1, suites.Failures)
+		assert.Equal(t, "fail.md", suites.Suites[1].Name)
+		assert.Equal(t, "failed to execute code block 0 on step 0.", suites.Suites[1].TestCases[0].Failure.Message)
+	})
+
+	t.Run("The summary lists every scenario", func(t *testing.T) {
+		summary := RenderSummary(BuildReport(results, time.Second))
+
+		for _, scenario := range scenarios {
+			assert.Contains(t, summary, scenario)
+		}
+		assert.Contains(t, summary, "3 scenarios, 2 passed, 1 failed")
+	})
+}
@@ -0,0 +1,220 @@
+package batch
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// Checks if the arguments given to `ie test` refer to more than one scenario,
+// i.e. several files, a directory, a glob or a `dir/...` pattern.
+func IsBatch(args []string) bool {
+	if len(args) > 1 {
+		return true
+	}
+
+	for _, arg := range args {
+		if isRemote(arg) {
+			continue
+		}
+		if isRecursivePattern(arg) || isGlob(arg) {
+			return true
+		}
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Finds the markdown scenarios referred to by the patterns. A pattern can be:
+//
+//	scenario.md        the scenario itself
+//	scenarios/         the scenarios directly inside the directory
+//	scenarios/...      the scenarios inside the directory and its subdirectories
+//	scenarios/*/*.md   the scenarios matching the glob
+//
+// Markdown files found through a directory or a glob are only included if
+// they contain code blocks in one of the languages, so that READMEs without
+// anything to run are left out. The paths are sorted and deduplicated.
+func Discover(patterns []string, languages []string) ([]string, error) {
+	found := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		paths, err := discoverPattern(pattern, languages)
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			logging.GlobalLogger.Warnf("No scenarios found for '%s'", pattern)
+		}
+		for _, path := range paths {
+			found[filepath.Clean(path)] = true
+		}
+	}
+
+	var scenarios []string
+	for path := range found {
+		scenarios = append(scenarios, path)
+	}
+	sort.Strings(scenarios)
+
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("no scenarios found in %s", strings.Join(patterns, ", "))
+	}
+
+	return scenarios, nil
+}
+
+func discoverPattern(pattern string, languages []string) ([]string, error) {
+	if isRemote(pattern) {
+		return []string{pattern}, nil
+	}
+
+	if isRecursivePattern(pattern) {
+		root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		if root == "" {
+			root = "."
+		}
+		return discoverRecursively(root, languages)
+	}
+
+	if isGlob(pattern) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+
+		var paths []string
+		for _, match := range matches {
+			if isHiddenMatch(pattern, match) {
+				continue
+			}
+
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				inDirectory, err := discoverInDirectory(match, languages)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, inDirectory...)
+			} else if isMarkdown(match) && isScenario(match, languages) {
+				paths = append(paths, match)
+			}
+		}
+		return paths, nil
+	}
+
+	info, err := os.Stat(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find '%s': %w", pattern, err)
+	}
+	if info.IsDir() {
+		return discoverInDirectory(pattern, languages)
+	}
+
+	// Files that were asked for by name are always included.
+	return []string{pattern}, nil
+}
+
+// Finds the scenarios directly inside a directory.
+func discoverInDirectory(directory string, languages []string) ([]string, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the directory '%s': %w", directory, err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		path := filepath.Join(directory, entry.Name())
+		if !entry.IsDir() && isMarkdown(path) && isScenario(path, languages) {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// Finds the scenarios inside a directory and its subdirectories. Hidden
+// directories such as .git are not searched.
+func discoverRecursively(root string, languages []string) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isMarkdown(path) && isScenario(path, languages) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search '%s' for scenarios: %w", root, err)
+	}
+
+	return paths, nil
+}
+
+// Checks if a markdown file has code blocks that can be executed.
+func isScenario(path string, languages []string) bool {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		logging.GlobalLogger.Warnf("Failed to read '%s': %s", path, err)
+		return false
+	}
+
+	document := parsers.ParseMarkdownIntoAst(source)
+	return len(parsers.ExtractCodeBlocksFromAst(document, source, languages)) > 0
+}
+
+// Checks if a glob only matched a path because a wildcard matched a hidden
+// file or directory, which the shell wouldn't do.
+func isHiddenMatch(pattern string, match string) bool {
+	patternParts := strings.Split(filepath.Clean(pattern), string(filepath.Separator))
+	matchParts := strings.Split(filepath.Clean(match), string(filepath.Separator))
+	if len(patternParts) != len(matchParts) {
+		return false
+	}
+
+	for index, part := range matchParts {
+		if part == "." || part == ".." {
+			continue
+		}
+		if strings.HasPrefix(part, ".") && !strings.HasPrefix(patternParts[index], ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func isMarkdown(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".md")
+}
+
+func isRecursivePattern(pattern string) bool {
+	return pattern == "..." || strings.HasSuffix(pattern, "/...")
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func isRemote(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
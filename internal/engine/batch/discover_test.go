@@ -0,0 +1,81 @@
+package batch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path string, contents string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+}
+
+func TestDiscover(t *testing.T) {
+	scenario := "# Scenario\n\n## Step\n\n```bash\necho hello\n```\n"
+	document := "# Notes\n\nNothing to run here.\n"
+
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "first", "README.md"), scenario)
+	writeFile(t, filepath.Join(root, "first", "nested", "README.md"), scenario)
+	writeFile(t, filepath.Join(root, "second", "README.md"), scenario)
+	writeFile(t, filepath.Join(root, "second", "notes.md"), document)
+	writeFile(t, filepath.Join(root, ".git", "README.md"), scenario)
+	writeFile(t, filepath.Join(root, "top.md"), scenario)
+
+	languages := []string{"bash"}
+
+	t.Run("Directories only include the scenarios inside of them", func(t *testing.T) {
+		scenarios, err := Discover([]string{filepath.Join(root, "second")}, languages)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(root, "second", "README.md")}, scenarios)
+	})
+
+	t.Run("Recursive patterns search subdirectories except hidden ones", func(t *testing.T) {
+		scenarios, err := Discover([]string{root + "/..."}, languages)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(root, "first", "README.md"),
+			filepath.Join(root, "first", "nested", "README.md"),
+			filepath.Join(root, "second", "README.md"),
+			filepath.Join(root, "top.md"),
+		}, scenarios)
+	})
+
+	t.Run("Globs and files are combined without duplicates", func(t *testing.T) {
+		scenarios, err := Discover([]string{
+			filepath.Join(root, "*", "README.md"),
+			filepath.Join(root, "first", "README.md"),
+			filepath.Join(root, "second", "notes.md"),
+		}, languages)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			filepath.Join(root, "first", "README.md"),
+			filepath.Join(root, "second", "README.md"),
+			filepath.Join(root, "second", "notes.md"),
+		}, scenarios)
+	})
+
+	t.Run("Finding nothing is an error", func(t *testing.T) {
+		_, err := Discover([]string{filepath.Join(root, "*", "missing.md")}, languages)
+		assert.Error(t, err)
+
+		_, err = Discover([]string{filepath.Join(root, "missing")}, languages)
+		assert.Error(t, err)
+	})
+
+	t.Run("Batches are detected from the arguments", func(t *testing.T) {
+		assert.False(t, IsBatch([]string{filepath.Join(root, "top.md")}))
+		assert.False(t, IsBatch([]string{"https://example.com/scenario.md?raw=true"}))
+		assert.True(t, IsBatch([]string{filepath.Join(root, "top.md"), filepath.Join(root, "top.md")}))
+		assert.True(t, IsBatch([]string{root}))
+		assert.True(t, IsBatch([]string{"./scenarios/..."}))
+		assert.True(t, IsBatch([]string{"scenarios/*/README.md"}))
+	})
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// A process started by a background code block, which keeps running while the
+// code blocks after it run, until the scenario ends.
+type BackgroundProcess struct {
+	StepNumber      int    `json:"stepNumber"`
+	CodeBlockNumber int    `json:"codeBlockNumber"`
+	PID             int    `json:"pid"`
+	LogFile         string `json:"logFile"`
+	// What the process wrote to stdout and stderr, read once it's stopped.
+	Logs string `json:"logs"`
+}
+
+// The background processes started by the scenario that are still running.
+var backgroundProcesses struct {
+	sync.Mutex
+	running []BackgroundProcess
+}
+
+// The file that the output of the background process started by a code block
+// is written to.
+func backgroundLogFile(block StatefulCodeBlock) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf(
+		"ie-%d-background-%d-%d.log",
+		os.Getpid(),
+		block.StepNumber+1,
+		block.CodeBlockNumber+1,
+	))
+}
+
+// Builds the command that starts the content of a background code block with
+// interpreter and prints the ID of the process it started. Its output goes to
+// a log file rather than the output of the command, so the command doesn't
+// wait for it, and job control puts it in a process group of its own so that
+// the processes it starts are stopped along with it. Interpreters that aren't
+// shells receive the content as their last argument.
+func BackgroundCommand(block StatefulCodeBlock, interpreter shells.Interpreter) string {
+	content := block.CodeBlock.Content
+	if !interpreter.Shell {
+		content = interpreter.CommandLine(content)
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	return strings.Join([]string{
+		"set -m",
+		fmt.Sprintf("(\n%s) > %s 2>&1 < /dev/null &", content, parsers.QuoteBashValue(backgroundLogFile(block))),
+		"echo \"$!\"",
+	}, "\n")
+}
+
+// Records the process started by a background code block from the output of
+// its BackgroundCommand, returning the output to show for the code block.
+func trackBackgroundProcess(block StatefulCodeBlock, output string) (string, error) {
+	pid, err := strconv.Atoi(strings.TrimSpace(output))
+	if err != nil {
+		return "", fmt.Errorf("failed to find the process started in the background: %w", err)
+	}
+
+	process := BackgroundProcess{
+		StepNumber:      block.StepNumber,
+		CodeBlockNumber: block.CodeBlockNumber,
+		PID:             pid,
+		LogFile:         backgroundLogFile(block),
+	}
+	logging.GlobalLogger.Infof("Started a background process with the PID %d", pid)
+
+	backgroundProcesses.Lock()
+	backgroundProcesses.running = append(backgroundProcesses.running, process)
+	backgroundProcesses.Unlock()
+
+	return fmt.Sprintf(
+		"Started in the background with the PID %d, writing its output to %s\n",
+		pid,
+		process.LogFile,
+	), nil
+}
+
+// Gets the background processes started by the scenario that are still
+// running.
+func BackgroundProcesses() []BackgroundProcess {
+	backgroundProcesses.Lock()
+	defer backgroundProcesses.Unlock()
+	return append([]BackgroundProcess{}, backgroundProcesses.running...)
+}
+
+// Builds the command that stops a background process along with the processes
+// it started, and prints what it wrote before removing its log file.
+func StopBackgroundProcessCommand(process BackgroundProcess) string {
+	logFile := parsers.QuoteBashValue(process.LogFile)
+	return strings.Join([]string{
+		fmt.Sprintf("kill -TERM -- -%d 2> /dev/null || true", process.PID),
+		fmt.Sprintf("cat %s 2> /dev/null || true", logFile),
+		fmt.Sprintf("rm -f %s", logFile),
+	}, "\n")
+}
+
+// Stops the background processes started by the scenario with executor,
+// returning them along with their logs.
+func StopBackgroundProcesses(executor shells.Executor) []BackgroundProcess {
+	backgroundProcesses.Lock()
+	processes := backgroundProcesses.running
+	backgroundProcesses.running = nil
+	backgroundProcesses.Unlock()
+
+	for i, process := range processes {
+		logging.GlobalLogger.Infof("Stopping the background process with the PID %d", process.PID)
+		output, err := executor.Execute(
+			StopBackgroundProcessCommand(process),
+			shells.CommandConfiguration{
+				InheritEnvironment: true,
+				InteractiveCommand: false,
+				WriteToHistory:     false,
+			},
+		)
+		if err != nil {
+			logging.GlobalLogger.Errorf(
+				"Error stopping the background process with the PID %d: %s",
+				process.PID,
+				err.Error(),
+			)
+		}
+		processes[i].Logs = output.StdOut
+	}
+	return processes
+}
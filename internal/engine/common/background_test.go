@@ -0,0 +1,99 @@
+package common
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+// Checks whether a process is still running.
+func isRunning(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+func TestBackgroundProcesses(t *testing.T) {
+	defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+	t.Run("Builds a command that starts the code block in the background", func(t *testing.T) {
+		command := BackgroundCommand(StatefulCodeBlock{
+			CodeBlock:       parsers.CodeBlock{Content: "python3 -m http.server 8080"},
+			StepNumber:      1,
+			CodeBlockNumber: 2,
+		}, shells.DefaultInterpreters["bash"])
+
+		lines := strings.Split(command, "\n")
+		assert.Equal(t, "set -m", lines[0])
+		assert.Equal(t, "python3 -m http.server 8080", lines[2])
+		assert.Contains(t, lines[3], "background-2-3.log 2>&1 < /dev/null &")
+		assert.Equal(t, "echo \"$!\"", lines[4])
+	})
+
+	t.Run("Builds a command that starts code blocks in other languages with their interpreter", func(t *testing.T) {
+		command := BackgroundCommand(StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{Language: "python", Content: "print('serving')\n"},
+		}, shells.DefaultInterpreters["python"])
+
+		assert.Contains(t, command, "(\npython3 -c 'print('\\''serving'\\'')\n'\n)")
+	})
+
+	t.Run("Runs background code blocks in other languages with their interpreter", func(t *testing.T) {
+		executor := shells.BashExecutor{
+			Interpreters: map[string]shells.Interpreter{"shout": {Command: []string{"printf", "%s!"}}},
+		}
+		block := StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{
+				Language:   "shout",
+				Content:    "serving",
+				Attributes: map[string]string{"background": "true"},
+			},
+		}
+
+		result := RunCodeBlock(executor, block, shells.CommandConfiguration{})
+		assert.NoError(t, result.Error)
+
+		// Wait for the output to reach the log file.
+		time.Sleep(200 * time.Millisecond)
+		stopped := StopBackgroundProcesses(executor)
+
+		assert.Len(t, stopped, 1)
+		assert.Equal(t, "serving!", stopped[0].Logs)
+	})
+
+	t.Run("Starts the process without waiting for it and stops it at the end", func(t *testing.T) {
+		executor := shells.BashExecutor{}
+		block := StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{
+				Language:   "bash",
+				Content:    "echo serving\n# Started by the code block, so it's stopped along with it.\nsleep 60 &\nsleep 60",
+				Attributes: map[string]string{"background": "true"},
+			},
+		}
+
+		start := time.Now()
+		result := RunCodeBlock(executor, block, shells.CommandConfiguration{})
+
+		assert.NoError(t, result.Error)
+		assert.Less(t, time.Since(start), 10*time.Second)
+		assert.Contains(t, result.StdOut, "Started in the background with the PID")
+
+		running := BackgroundProcesses()
+		assert.Len(t, running, 1)
+		assert.True(t, isRunning(running[0].PID))
+
+		// Wait for the output to reach the log file.
+		time.Sleep(200 * time.Millisecond)
+		stopped := StopBackgroundProcesses(executor)
+
+		assert.Len(t, stopped, 1)
+		assert.Equal(t, "serving\n", stopped[0].Logs)
+		assert.Empty(t, BackgroundProcesses())
+		assert.Eventually(t, func() bool { return !isRunning(stopped[0].PID) }, 5*time.Second, 50*time.Millisecond)
+		assert.NoFileExists(t, stopped[0].LogFile)
+	})
+}
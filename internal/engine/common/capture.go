@@ -0,0 +1,88 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+)
+
+// Gets the regex of a capture whose expression is a regex between slashes, or
+// nil if it's a JSONPath.
+func captureRegex(capture parsers.Capture) (*regexp.Regexp, error) {
+	expression := capture.Expression
+	if len(expression) < 2 || !strings.HasPrefix(expression, "/") || !strings.HasSuffix(expression, "/") {
+		return nil, nil
+	}
+	return regexp.Compile(expression[1 : len(expression)-1])
+}
+
+// Checks that the captures of a code block are valid, so that mistakes in them
+// are reported before anything runs.
+func ValidateCaptures(block parsers.CodeBlock) error {
+	for _, capture := range block.Captures {
+		if !lib.IsValidEnvironmentVariableName(capture.Variable) {
+			return fmt.Errorf("invalid capture variable '%s'", capture.Variable)
+		}
+
+		regex, err := captureRegex(capture)
+		if err != nil {
+			return fmt.Errorf("invalid capture regex %s for %s: %w", capture.Expression, capture.Variable, err)
+		}
+		if regex == nil && !strings.HasPrefix(capture.Expression, "$") {
+			return fmt.Errorf(
+				"invalid capture expression '%s' for %s, expected a JSONPath like $.name or a regex like /v(\\d+)/",
+				capture.Expression,
+				capture.Variable,
+			)
+		}
+	}
+	return nil
+}
+
+// Gets the value a capture extracts from the output of a code block.
+func captureValue(capture parsers.Capture, output string) (string, error) {
+	regex, err := captureRegex(capture)
+	if err != nil {
+		return "", err
+	}
+	if regex == nil {
+		return lib.QueryJSONPath(output, capture.Expression)
+	}
+
+	match := regex.FindStringSubmatch(output)
+	if match == nil {
+		return "", fmt.Errorf("the output doesn't match %s", capture.Expression)
+	}
+	if len(match) > 1 {
+		return match[1], nil
+	}
+	return match[0], nil
+}
+
+// Captures the values declared by the capture comments of a code block from
+// its output, and exports them to the code blocks that run after it.
+func captureVariables(block StatefulCodeBlock, output string) (map[string]string, error) {
+	captured := make(map[string]string)
+	for _, capture := range block.CodeBlock.Captures {
+		value, err := captureValue(capture, output)
+		if err != nil {
+			return nil, fmt.Errorf("failed to capture %s: %w", capture.Variable, err)
+		}
+		captured[capture.Variable] = value
+		logging.GlobalLogger.Infof("Captured %s from the output of the code block", capture.Variable)
+	}
+
+	// The values come from the unmasked output, so the ones that hold secrets
+	// are registered to be masked wherever they're displayed.
+	secrets.RegisterVariables(captured)
+	err := lib.AppendToEnvironmentStateFile(lib.DefaultEnvironmentStateFile, captured)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export the captured variables: %w", err)
+	}
+	return captured, nil
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+const vmOutput = `{
+  "name": "vm-1",
+  "publicIpAddress": "20.1.2.3",
+  "networkInterfaces": [{"id": "nic-1"}, {"id": "nic-2"}]
+}
+`
+
+const storageKey = "BwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyAhIiMkJSYnKCkqKywtLi8wMTIzNDU2Nzg5Ojs8PT4/QEFCQ0RFRg=="
+
+// The output of az storage account keys list.
+const storageKeysOutput = `[
+  {
+    "creationTime": "2024-01-01T00:00:00+00:00",
+    "keyName": "key1",
+    "permissions": "FULL",
+    "value": "` + storageKey + `"
+  }
+]
+`
+
+func TestCapturingValues(t *testing.T) {
+	t.Run("Captures values with JSONPaths and regexes", func(t *testing.T) {
+		for _, tc := range []struct {
+			expression string
+			expected   string
+		}{
+			{"$.publicIpAddress", "20.1.2.3"},
+			{"$.networkInterfaces[-1].id", "nic-2"},
+			{`/"name": "([^"]+)"/`, "vm-1"},
+			{`/nic-\d/`, "nic-1"},
+		} {
+			t.Run(tc.expression, func(t *testing.T) {
+				value, err := captureValue(parsers.Capture{Variable: "VALUE", Expression: tc.expression}, vmOutput)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expected, value)
+			})
+		}
+	})
+
+	t.Run("Fails when there is nothing to capture", func(t *testing.T) {
+		_, err := captureValue(parsers.Capture{Variable: "VALUE", Expression: "$.privateIpAddress"}, vmOutput)
+		assert.ErrorContains(t, err, "there is no")
+
+		_, err = captureValue(parsers.Capture{Variable: "VALUE", Expression: "/version (\\d+)/"}, vmOutput)
+		assert.ErrorContains(t, err, "the output doesn't match /version (\\d+)/")
+	})
+
+	t.Run("Invalid captures are reported", func(t *testing.T) {
+		err := ValidateCaptures(parsers.CodeBlock{Captures: []parsers.Capture{{Variable: "VM-IP", Expression: "$.ip"}}})
+		assert.ErrorContains(t, err, "invalid capture variable 'VM-IP'")
+
+		err = ValidateCaptures(parsers.CodeBlock{Captures: []parsers.Capture{{Variable: "VM_IP", Expression: "/(/"}}})
+		assert.ErrorContains(t, err, "invalid capture regex /(/ for VM_IP")
+
+		_, err = CreateScenarioFromSource(
+			"",
+			[]byte("# Capture\n\n```bash\necho hi\n```\n<!-- capture: GREETING=hi -->\n"),
+			[]string{"bash"},
+			nil,
+			"",
+			nil,
+			1,
+		)
+		assert.ErrorContains(t, err, "invalid capture expression 'hi' for GREETING")
+	})
+
+	t.Run("Exports the captured values to the code blocks after it", func(t *testing.T) {
+		defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		executor := shells.BashExecutor{}
+
+		result := RunCodeBlock(executor, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{
+				Language: "bash",
+				Content:  "export REGION=eastus\ncat <<'EOF'\n" + vmOutput + "EOF",
+				Captures: []parsers.Capture{{Variable: "VM_IP", Expression: "$.publicIpAddress"}},
+			},
+		}, shells.CommandConfiguration{})
+		assert.NoError(t, result.Error)
+		assert.Equal(t, map[string]string{"VM_IP": "20.1.2.3"}, result.Captured)
+
+		result = RunCodeBlock(executor, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{Language: "bash", Content: "echo $REGION $VM_IP"},
+		}, shells.CommandConfiguration{})
+		assert.NoError(t, result.Error)
+		assert.Equal(t, "eastus 20.1.2.3\n", result.StdOut)
+	})
+
+	t.Run("Fails the code block when a value can't be captured", func(t *testing.T) {
+		defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+		result := RunCodeBlock(shells.BashExecutor{}, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{
+				Language: "bash",
+				Content:  "echo not json",
+				Captures: []parsers.Capture{{Variable: "VM_IP", Expression: "$.publicIpAddress"}},
+			},
+		}, shells.CommandConfiguration{})
+		assert.ErrorContains(t, result.Error, "failed to capture VM_IP")
+		assert.Nil(t, result.Captured)
+	})
+
+	t.Run("Captures secrets unmasked and registers them", func(t *testing.T) {
+		defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		executor := shells.BashExecutor{}
+
+		result := RunCodeBlock(executor, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{
+				Language: "bash",
+				Content:  "cat <<'EOF'\n" + storageKeysOutput + "EOF",
+				Captures: []parsers.Capture{{Variable: "STORAGE_PRIMARY", Expression: "$[0].value"}},
+			},
+		}, shells.CommandConfiguration{})
+		assert.NoError(t, result.Error)
+		assert.Equal(t, map[string]string{"STORAGE_PRIMARY": storageKey}, result.Captured)
+
+		state, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		assert.NoError(t, err)
+		assert.Equal(t, storageKey, state["STORAGE_PRIMARY"])
+		assert.True(t, secrets.IsSecretVariable("STORAGE_PRIMARY", storageKey))
+		assert.Equal(t, "key: "+secrets.Mask, secrets.MaskString("key: "+storageKey))
+
+		result = RunCodeBlock(executor, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{Language: "bash", Content: "echo $STORAGE_PRIMARY"},
+		}, shells.CommandConfiguration{})
+		assert.NoError(t, result.Error)
+		assert.Equal(t, storageKey+"\n", result.StdOut)
+	})
+}
@@ -0,0 +1,173 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// Location where checkpoints are written to so that scenarios can be resumed.
+var DefaultCheckpointDirectory = "/tmp/ie-checkpoints"
+
+// The position of a code block within a scenario. Both numbers start at 0.
+type CodeBlockPosition struct {
+	StepNumber      int `json:"stepNumber"`
+	CodeBlockNumber int `json:"codeBlockNumber"`
+}
+
+// Checks if the position comes before another position.
+func (position CodeBlockPosition) IsBefore(other CodeBlockPosition) bool {
+	if position.StepNumber != other.StepNumber {
+		return position.StepNumber < other.StepNumber
+	}
+	return position.CodeBlockNumber < other.CodeBlockNumber
+}
+
+// Gets the position of the code block that follows this position within the
+// steps. Returns a position past the last step if there is no code block left.
+func (position CodeBlockPosition) Next(steps []Step) CodeBlockPosition {
+	next := CodeBlockPosition{
+		StepNumber:      position.StepNumber,
+		CodeBlockNumber: position.CodeBlockNumber + 1,
+	}
+
+	for next.StepNumber < len(steps) &&
+		next.CodeBlockNumber >= len(steps[next.StepNumber].CodeBlocks) {
+		next.StepNumber++
+		next.CodeBlockNumber = 0
+	}
+
+	return next
+}
+
+// The state of a scenario after its last successful code block.
+type Checkpoint struct {
+	Scenario             string            `json:"scenario"`
+	MarkdownHash         string            `json:"markdownHash"`
+	LastCodeBlock        CodeBlockPosition `json:"lastCodeBlock"`
+	EnvironmentVariables map[string]string `json:"environmentVariables"`
+	WorkingDirectory     string            `json:"workingDirectory"`
+	CreatedAt            time.Time         `json:"createdAt"`
+}
+
+// Hashes the markdown source of a scenario, so that changes to the markdown
+// since a checkpoint was written can be detected.
+func HashMarkdown(source []byte) string {
+	hash := sha256.Sum256(source)
+	return hex.EncodeToString(hash[:])
+}
+
+// Gets the path of the checkpoint file for the scenario at scenarioPath.
+func CheckpointPath(scenarioPath string) string {
+	if !isRemotePath(scenarioPath) {
+		if absolutePath, err := filepath.Abs(scenarioPath); err == nil {
+			scenarioPath = absolutePath
+		}
+	}
+
+	hash := sha256.Sum256([]byte(scenarioPath))
+	name := hex.EncodeToString(hash[:])[:16]
+
+	return filepath.Join(DefaultCheckpointDirectory, name+".json")
+}
+
+// Loads the checkpoint for a scenario. Returns nil if there isn't one.
+func LoadCheckpoint(scenario *Scenario) (*Checkpoint, error) {
+	path := CheckpointPath(scenario.Path)
+	if !fs.FileExists(path) {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the checkpoint '%s': %w", path, err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(contents, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse the checkpoint '%s': %w", path, err)
+	}
+
+	return &checkpoint, nil
+}
+
+// Writes a checkpoint for a scenario after a code block succeeds. The
+// environment is captured from the environment state file shared between code
+// blocks. A nil writer doesn't write anything.
+type CheckpointWriter struct {
+	path         string
+	scenario     string
+	markdownHash string
+}
+
+func NewCheckpointWriter(scenario *Scenario) *CheckpointWriter {
+	return &CheckpointWriter{
+		path:         CheckpointPath(scenario.Path),
+		scenario:     scenario.Path,
+		markdownHash: HashMarkdown(scenario.Source),
+	}
+}
+
+// Saves the state of the scenario after the code block at position succeeded.
+func (writer *CheckpointWriter) Save(position CodeBlockPosition) error {
+	if writer == nil {
+		return nil
+	}
+
+	environmentVariables, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if err != nil {
+		environmentVariables = make(map[string]string)
+	}
+
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	checkpoint := Checkpoint{
+		Scenario:             writer.scenario,
+		MarkdownHash:         writer.markdownHash,
+		LastCodeBlock:        position,
+		EnvironmentVariables: environmentVariables,
+		WorkingDirectory:     workingDirectory,
+		CreatedAt:            time.Now(),
+	}
+
+	contents, err := json.MarshalIndent(checkpoint, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(writer.path), 0700); err != nil {
+		return err
+	}
+
+	// The environment can hold secrets, so only the user can read checkpoints.
+	if err := os.WriteFile(writer.path, contents, 0600); err != nil {
+		return err
+	}
+
+	logging.GlobalLogger.Debugf(
+		"Wrote a checkpoint for step %d, code block %d to %s",
+		position.StepNumber+1,
+		position.CodeBlockNumber+1,
+		writer.path,
+	)
+	return nil
+}
+
+// Removes the checkpoint once the scenario has completed.
+func (writer *CheckpointWriter) Clear() error {
+	if writer == nil || !fs.FileExists(writer.path) {
+		return nil
+	}
+	return os.Remove(writer.path)
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodeBlockPositions(t *testing.T) {
+	steps := []Step{
+		{Name: "First", CodeBlocks: []parsers.CodeBlock{{}, {}}},
+		{Name: "Empty"},
+		{Name: "Last", CodeBlocks: []parsers.CodeBlock{{}}},
+	}
+
+	t.Run("Compare positions", func(t *testing.T) {
+		assert.True(t, CodeBlockPosition{0, 1}.IsBefore(CodeBlockPosition{1, 0}))
+		assert.True(t, CodeBlockPosition{0, 0}.IsBefore(CodeBlockPosition{0, 1}))
+		assert.False(t, CodeBlockPosition{0, 1}.IsBefore(CodeBlockPosition{0, 1}))
+		assert.False(t, CodeBlockPosition{2, 0}.IsBefore(CodeBlockPosition{1, 5}))
+	})
+
+	t.Run("Find the next code block", func(t *testing.T) {
+		assert.Equal(t, CodeBlockPosition{0, 1}, CodeBlockPosition{0, 0}.Next(steps))
+		assert.Equal(t, CodeBlockPosition{2, 0}, CodeBlockPosition{0, 1}.Next(steps))
+		assert.Equal(t, CodeBlockPosition{3, 0}, CodeBlockPosition{2, 0}.Next(steps))
+	})
+}
+
+func TestCheckpoints(t *testing.T) {
+	originalCheckpointDirectory := DefaultCheckpointDirectory
+	originalEnvironmentStateFile := lib.DefaultEnvironmentStateFile
+	defer func() {
+		DefaultCheckpointDirectory = originalCheckpointDirectory
+		lib.DefaultEnvironmentStateFile = originalEnvironmentStateFile
+	}()
+
+	directory := t.TempDir()
+	DefaultCheckpointDirectory = filepath.Join(directory, "checkpoints")
+	lib.DefaultEnvironmentStateFile = filepath.Join(directory, "env-vars")
+
+	scenario := &Scenario{Path: filepath.Join(directory, "scenario.md"), Source: []byte("# Scenario")}
+
+	t.Run("Scenarios without a checkpoint", func(t *testing.T) {
+		checkpoint, err := LoadCheckpoint(scenario)
+
+		assert.NoError(t, err)
+		assert.Nil(t, checkpoint)
+	})
+
+	t.Run("Save and load a checkpoint", func(t *testing.T) {
+		err := lib.WriteEnvironmentStateFile(
+			lib.DefaultEnvironmentStateFile,
+			map[string]string{"MY_GROUP": "my-group"},
+		)
+		assert.NoError(t, err)
+
+		writer := NewCheckpointWriter(scenario)
+		assert.NoError(t, writer.Save(CodeBlockPosition{StepNumber: 2, CodeBlockNumber: 1}))
+
+		info, err := os.Stat(CheckpointPath(scenario.Path))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		checkpoint, err := LoadCheckpoint(scenario)
+		assert.NoError(t, err)
+
+		workingDirectory, _ := os.Getwd()
+		assert.Equal(t, CodeBlockPosition{StepNumber: 2, CodeBlockNumber: 1}, checkpoint.LastCodeBlock)
+		assert.Equal(t, "my-group", checkpoint.EnvironmentVariables["MY_GROUP"])
+		assert.Equal(t, workingDirectory, checkpoint.WorkingDirectory)
+		assert.Equal(t, HashMarkdown(scenario.Source), checkpoint.MarkdownHash)
+
+		assert.NoError(t, writer.Clear())
+		checkpoint, err = LoadCheckpoint(scenario)
+		assert.NoError(t, err)
+		assert.Nil(t, checkpoint)
+	})
+
+	t.Run("A nil writer does nothing", func(t *testing.T) {
+		var writer *CheckpointWriter
+
+		assert.NoError(t, writer.Save(CodeBlockPosition{}))
+		assert.NoError(t, writer.Clear())
+	})
+}
@@ -1,6 +1,11 @@
 package common
 
-import "github.com/Azure/InnovationEngine/internal/parsers"
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
 
 // State for the codeblock in interactive mode. Used to keep track of the
 // state of each codeblock.
@@ -13,7 +18,13 @@ type StatefulCodeBlock struct {
 	StepName        string            `json:"stepName"`
 	StepNumber      int               `json:"stepNumber"`
 	Success         bool              `json:"success"`
+	Skipped         bool              `json:"skipped"`
 	SimilarityScore float64           `json:"similarityScore"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Captured        map[string]string `json:"captured,omitempty"`
+	// The values of the variables the code block assigned, which replaying the
+	// code block assigns again.
+	Variables map[string]string `json:"variables,omitempty"`
 }
 
 // Checks if a codeblock was executed by looking at the
@@ -21,3 +32,94 @@ type StatefulCodeBlock struct {
 func (s StatefulCodeBlock) WasExecuted() bool {
 	return s.StdOut != "" || s.StdErr != "" || s.Error != nil || s.Success
 }
+
+// The statuses of a code block after running a scenario.
+const (
+	CodeBlockPassed  = "passed"
+	CodeBlockFailed  = "failed"
+	CodeBlockSkipped = "skipped"
+	CodeBlockNotRun  = "not-run"
+)
+
+// Gets the status of the code block: whether it passed, failed, was skipped or
+// was never run.
+func (s StatefulCodeBlock) Status() string {
+	switch {
+	case s.Skipped:
+		return CodeBlockSkipped
+	case s.Success:
+		return CodeBlockPassed
+	case s.WasExecuted():
+		return CodeBlockFailed
+	default:
+		return CodeBlockNotRun
+	}
+}
+
+// The JSON representation of a StatefulCodeBlock, which stores the error as
+// its message so that reports can be loaded again.
+type statefulCodeBlockJSON struct {
+	CodeBlock       parsers.CodeBlock `json:"codeBlock"`
+	CodeBlockNumber int               `json:"codeBlockNumber"`
+	Error           *string           `json:"error"`
+	StdErr          string            `json:"stdErr"`
+	StdOut          string            `json:"stdOut"`
+	StepName        string            `json:"stepName"`
+	StepNumber      int               `json:"stepNumber"`
+	Success         bool              `json:"success"`
+	Skipped         bool              `json:"skipped"`
+	SimilarityScore float64           `json:"similarityScore"`
+	DurationSeconds float64           `json:"durationSeconds"`
+	Captured        map[string]string `json:"captured,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+}
+
+func (s StatefulCodeBlock) MarshalJSON() ([]byte, error) {
+	var message *string
+	if s.Error != nil {
+		text := s.Error.Error()
+		message = &text
+	}
+
+	return json.Marshal(statefulCodeBlockJSON{
+		CodeBlock:       s.CodeBlock,
+		CodeBlockNumber: s.CodeBlockNumber,
+		Error:           message,
+		StdErr:          s.StdErr,
+		StdOut:          s.StdOut,
+		StepName:        s.StepName,
+		StepNumber:      s.StepNumber,
+		Success:         s.Success,
+		Skipped:         s.Skipped,
+		SimilarityScore: s.SimilarityScore,
+		DurationSeconds: s.DurationSeconds,
+		Captured:        s.Captured,
+		Variables:       s.Variables,
+	})
+}
+
+func (s *StatefulCodeBlock) UnmarshalJSON(data []byte) error {
+	var block statefulCodeBlockJSON
+	if err := json.Unmarshal(data, &block); err != nil {
+		return err
+	}
+
+	*s = StatefulCodeBlock{
+		CodeBlock:       block.CodeBlock,
+		CodeBlockNumber: block.CodeBlockNumber,
+		StdErr:          block.StdErr,
+		StdOut:          block.StdOut,
+		StepName:        block.StepName,
+		StepNumber:      block.StepNumber,
+		Success:         block.Success,
+		Skipped:         block.Skipped,
+		SimilarityScore: block.SimilarityScore,
+		DurationSeconds: block.DurationSeconds,
+		Captured:        block.Captured,
+		Variables:       block.Variables,
+	}
+	if block.Error != nil {
+		s.Error = errors.New(*block.Error)
+	}
+	return nil
+}
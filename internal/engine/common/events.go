@@ -0,0 +1,232 @@
+package common
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/events"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The modes a scenario runs in, as reported by the scenario_started event.
+const (
+	ModeExecute     = "execute"
+	ModeTest        = "test"
+	ModeInteractive = "interactive"
+)
+
+// The events of the scenario being run. Every mode publishes the same events
+// here, so subscribers such as `--output jsonl` don't depend on how the
+// scenario is rendered.
+var Events = events.NewBus()
+
+// Remembers the scenario being run and its current step, so that the events of
+// a code block can say where it is and step_started is published when the step
+// changes.
+type eventPublisher struct {
+	mutex    sync.Mutex
+	scenario string
+	step     int
+}
+
+var publisher = eventPublisher{step: -1}
+
+// Publishes that a scenario started running in mode.
+func PublishScenarioStarted(scenario string, mode string, steps int) {
+	publisher.mutex.Lock()
+	publisher.scenario = scenario
+	publisher.step = -1
+	publisher.mutex.Unlock()
+
+	Events.Publish(events.Event{
+		Type:     events.ScenarioStarted,
+		Scenario: scenario,
+		Mode:     mode,
+		Steps:    steps,
+	})
+}
+
+// Publishes that the scenario finished, failing if err isn't nil.
+func PublishScenarioFinished(err error) {
+	event := events.Event{
+		Type:     events.ScenarioFinished,
+		Scenario: publisher.scenarioName(),
+		Status:   CodeBlockPassed,
+	}
+	if err != nil {
+		event.Status = CodeBlockFailed
+		event.Error = err.Error()
+	}
+	Events.Publish(event)
+}
+
+func (p *eventPublisher) scenarioName() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.scenario
+}
+
+// Creates an event about a code block, publishing step_started first if the
+// code block belongs to a step that hasn't started yet.
+func (p *eventPublisher) codeBlockEvent(eventType events.Type, block StatefulCodeBlock) events.Event {
+	p.mutex.Lock()
+	scenario := p.scenario
+	stepChanged := block.StepNumber != p.step
+	p.step = block.StepNumber
+	p.mutex.Unlock()
+
+	step := &events.Step{Number: block.StepNumber, Name: block.StepName}
+	if stepChanged {
+		Events.Publish(events.Event{Type: events.StepStarted, Scenario: scenario, Step: step})
+	}
+
+	codeBlockNumber := block.CodeBlockNumber
+	return events.Event{
+		Type:      eventType,
+		Scenario:  scenario,
+		Step:      step,
+		CodeBlock: &codeBlockNumber,
+	}
+}
+
+// Publishes that a code block was skipped by the --only and --skip selectors.
+func PublishCodeBlockSkipped(block StatefulCodeBlock) {
+	event := publisher.codeBlockEvent(events.CodeBlockFinished, block)
+	event.Status = CodeBlockSkipped
+	Events.Publish(event)
+}
+
+// The result of running a code block.
+type CodeBlockResult struct {
+	StdOut string
+	StdErr string
+	// The error the code block failed with, if any.
+	Error error
+	// Whether the code block failed because its output didn't match the
+	// expected output.
+	OutputMismatch  bool
+	SimilarityScore float64
+	Duration        time.Duration
+	// The variables captured from the output of the code block.
+	Captured map[string]string
+	// The values of the variables the code block assigns, once it ran.
+	Variables map[string]string
+}
+
+// Runs a code block with executor, honoring its attributes, and unless it's
+// interactive compares its output with the expected output. Publishes the code
+// block starting, its output as it's written and the code block finishing.
+func RunCodeBlock(
+	executor shells.Executor,
+	block StatefulCodeBlock,
+	config shells.CommandConfiguration,
+) CodeBlockResult {
+	started := publisher.codeBlockEvent(events.CodeBlockStarted, block)
+	started.Content = block.CodeBlock.Content
+	Events.Publish(started)
+
+	config.Language = block.CodeBlock.Language
+	config.OnOutput = func(stream string, chunk string) {
+		output := started
+		output.Type = events.Output
+		output.Content = ""
+		output.Stream = stream
+		output.Data = chunk
+		Events.Publish(output)
+	}
+
+	command := block.CodeBlock.Content
+	var err error
+	switch {
+	case block.CodeBlock.File() != "":
+		command = FileCommand(block.CodeBlock, commandVariables(config))
+		// The file is written by bash, whatever the language of its content, and
+		// its expanded content is kept out of the history.
+		config.Language = ""
+		config.WriteToHistory = false
+	case block.CodeBlock.Background():
+		command = BackgroundCommand(block, shells.FindInterpreter(executor, config.Language))
+		// Started by bash, which runs the interpreter of the language.
+		config.Language = ""
+	case IsTerraformConfiguration(block.CodeBlock):
+		var directory string
+		directory, err = terraformDirectory(config.WorkingDirectory)
+		command = TerraformCommand(block, directory)
+	default:
+		config.Strict = isStrict(block.CodeBlock)
+	}
+
+	start := time.Now()
+	var output shells.CommandOutput
+	var wait *Wait
+	if err == nil {
+		wait, err = ParseWait(block.CodeBlock)
+	}
+	if err == nil && wait != nil {
+		output, err = executeAndWait(executor, command, config, block, wait)
+	} else if err == nil {
+		output, err = executor.Execute(command, config)
+	}
+	if config.Strict {
+		err = locateUnsetVariable(block, err)
+	}
+	result := CodeBlockResult{
+		StdOut:   output.StdOut,
+		StdErr:   output.StdErr,
+		Error:    err,
+		Duration: time.Since(start),
+	}
+
+	if err == nil {
+		result.Variables = assignedVariables(executor, block.CodeBlock)
+	}
+
+	if err != nil {
+		logging.GlobalLogger.Errorf("Error executing command:\n %s", err.Error())
+	} else if block.CodeBlock.Background() {
+		// The output of background processes is only known once they stop, so
+		// it isn't compared with the expected output.
+		result.StdOut, result.Error = trackBackgroundProcess(block, output.StdOut)
+	} else if !config.InteractiveCommand {
+		expectedOutput := block.CodeBlock.ExpectedOutput
+		score, outputComparisonError := CompareCommandOutputs(
+			output.StdOut,
+			expectedOutput.Content,
+			expectedOutput.ExpectedSimilarity,
+			expectedOutput.ExpectedRegex,
+			expectedOutput.Language,
+		)
+		result.SimilarityScore = score
+
+		if outputComparisonError != nil {
+			logging.GlobalLogger.Errorf(
+				"Error comparing command outputs: %s",
+				outputComparisonError.Error(),
+			)
+			result.Error = outputComparisonError
+			result.OutputMismatch = true
+		} else if len(block.CodeBlock.Captures) > 0 {
+			result.Captured, result.Error = captureVariables(block, output.StdOut)
+		}
+	}
+
+	finished := started
+	finished.Type = events.CodeBlockFinished
+	finished.Content = ""
+	finished.Status = CodeBlockPassed
+	finished.StdOut = result.StdOut
+	finished.StdErr = result.StdErr
+	finished.DurationSeconds = result.Duration.Seconds()
+	if !config.InteractiveCommand {
+		score := result.SimilarityScore
+		finished.SimilarityScore = &score
+	}
+	if result.Error != nil {
+		finished.Status = CodeBlockFailed
+		finished.Error = result.Error.Error()
+	}
+	Events.Publish(finished)
+
+	return result
+}
@@ -0,0 +1,185 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/engine/events"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+// Collects the events published while running fn.
+func collectEvents(fn func()) []events.Event {
+	var published []events.Event
+	Events.Subscribe(func(event events.Event) {
+		published = append(published, event)
+	})
+	defer Events.Reset()
+
+	fn()
+	return published
+}
+
+func eventTypes(published []events.Event) []events.Type {
+	var types []events.Type
+	for _, event := range published {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestCodeBlockEvents(t *testing.T) {
+	executor := shells.ExecutorFunc(func(
+		command string,
+		config shells.CommandConfiguration,
+	) (shells.CommandOutput, error) {
+		if command == "exit 1" {
+			config.OnOutput("stderr", "oops\n")
+			return shells.CommandOutput{StdErr: "oops\n"}, errors.New("exit status 1")
+		}
+		config.OnOutput("stdout", "hello\n")
+		return shells.CommandOutput{StdOut: "hello\n"}, nil
+	})
+
+	blocks := []StatefulCodeBlock{
+		{
+			StepName:   "Greet",
+			StepNumber: 0,
+			CodeBlock: parsers.CodeBlock{
+				Content: "echo hello",
+				ExpectedOutput: parsers.ExpectedOutputBlock{
+					Language:           "text",
+					Content:            "hello\n",
+					ExpectedSimilarity: 1,
+				},
+			},
+		},
+		{
+			StepName:        "Greet",
+			StepNumber:      0,
+			CodeBlockNumber: 1,
+			CodeBlock:       parsers.CodeBlock{Content: "exit 1"},
+		},
+	}
+
+	t.Run("Publishes the lifecycle of a code block", func(t *testing.T) {
+		published := collectEvents(func() {
+			PublishScenarioStarted("Greetings", ModeTest, 1)
+			result := RunCodeBlock(executor, blocks[0], shells.CommandConfiguration{})
+			assert.NoError(t, result.Error)
+			PublishScenarioFinished(nil)
+		})
+
+		assert.Equal(t, []events.Type{
+			events.ScenarioStarted,
+			events.StepStarted,
+			events.CodeBlockStarted,
+			events.Output,
+			events.CodeBlockFinished,
+			events.ScenarioFinished,
+		}, eventTypes(published))
+
+		for _, event := range published {
+			assert.Equal(t, "Greetings", event.Scenario)
+		}
+
+		assert.Equal(t, ModeTest, published[0].Mode)
+		assert.Equal(t, "echo hello", published[2].Content)
+		assert.Equal(t, "hello\n", published[3].Data)
+		assert.Equal(t, "stdout", published[3].Stream)
+
+		finished := published[4]
+		assert.Equal(t, CodeBlockPassed, finished.Status)
+		assert.Equal(t, 1.0, *finished.SimilarityScore)
+		assert.Equal(t, "Greet", finished.Step.Name)
+		assert.Equal(t, 0, *finished.CodeBlock)
+
+		assert.Equal(t, CodeBlockPassed, published[5].Status)
+	})
+
+	t.Run("Publishes step_started once per step", func(t *testing.T) {
+		published := collectEvents(func() {
+			PublishScenarioStarted("Greetings", ModeExecute, 1)
+			RunCodeBlock(executor, blocks[0], shells.CommandConfiguration{})
+			result := RunCodeBlock(executor, blocks[1], shells.CommandConfiguration{})
+			assert.Error(t, result.Error)
+			assert.False(t, result.OutputMismatch)
+			PublishScenarioFinished(result.Error)
+		})
+
+		steps := 0
+		for _, event := range published {
+			if event.Type == events.StepStarted {
+				steps++
+			}
+		}
+		assert.Equal(t, 1, steps)
+
+		last := published[len(published)-1]
+		assert.Equal(t, events.ScenarioFinished, last.Type)
+		assert.Equal(t, CodeBlockFailed, last.Status)
+		assert.Equal(t, "exit status 1", last.Error)
+
+		finished := published[len(published)-2]
+		assert.Equal(t, CodeBlockFailed, finished.Status)
+		assert.Equal(t, 1, *finished.CodeBlock)
+		assert.Equal(t, "oops\n", finished.StdErr)
+	})
+
+	t.Run("Reports output that doesn't match", func(t *testing.T) {
+		block := blocks[0]
+		block.CodeBlock.ExpectedOutput.Content = "goodbye\n"
+
+		var result CodeBlockResult
+		published := collectEvents(func() {
+			PublishScenarioStarted("Greetings", ModeTest, 1)
+			result = RunCodeBlock(executor, block, shells.CommandConfiguration{})
+		})
+
+		assert.True(t, result.OutputMismatch)
+		assert.Equal(t, CodeBlockFailed, published[len(published)-1].Status)
+	})
+
+	t.Run("Publishes skipped code blocks", func(t *testing.T) {
+		published := collectEvents(func() {
+			PublishScenarioStarted("Greetings", ModeInteractive, 1)
+			PublishCodeBlockSkipped(blocks[1])
+		})
+
+		assert.Equal(t, []events.Type{
+			events.ScenarioStarted,
+			events.StepStarted,
+			events.CodeBlockFinished,
+		}, eventTypes(published))
+		assert.Equal(t, CodeBlockSkipped, published[2].Status)
+	})
+
+	t.Run("Compares the unmasked output and masks it in events", func(t *testing.T) {
+		secretExecutor := shells.ExecutorFunc(func(
+			command string,
+			config shells.CommandConfiguration,
+		) (shells.CommandOutput, error) {
+			secrets.Register("events-test-password")
+			config.OnOutput("stdout", "events-test-password\n")
+			return shells.CommandOutput{StdOut: "events-test-password\n"}, nil
+		})
+		block := blocks[0]
+		block.CodeBlock.ExpectedOutput.Content = "events-test-password\n"
+
+		var result CodeBlockResult
+		published := collectEvents(func() {
+			PublishScenarioStarted("Greetings", ModeTest, 1)
+			result = RunCodeBlock(secretExecutor, block, shells.CommandConfiguration{})
+		})
+
+		assert.NoError(t, result.Error)
+		assert.Equal(t, "events-test-password\n", result.StdOut)
+		for _, event := range published {
+			assert.NotContains(t, event.Data+event.StdOut, "events-test-password")
+		}
+		assert.Equal(t, secrets.Mask+"\n", published[len(published)-1].StdOut)
+	})
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// Builds the command that writes the content of a code block to the file set
+// by its file attribute, relative to the working directory. References to the
+// variables given are expanded before the content is written, and its parent
+// directories are created if they don't exist.
+func FileCommand(block parsers.CodeBlock, variables map[string]string) string {
+	path := block.File()
+	content := lib.ExpandUnquotedVariables(block.Content, variables)
+
+	var lines []string
+	if directory := filepath.Dir(path); directory != "." {
+		lines = append(lines, fmt.Sprintf("mkdir -p %s", parsers.QuoteBashValue(directory)))
+	}
+	lines = append(lines, fmt.Sprintf(
+		"printf '%%s' %s > %s",
+		parsers.QuoteBashValue(content),
+		parsers.QuoteBashValue(path),
+	))
+
+	return strings.Join(lines, "\n")
+}
+
+// Gets the variables that commands run with config see: the environment of
+// ie when it's inherited, the variables of the configuration and the ones
+// shared by the commands that ran before.
+func commandVariables(config shells.CommandConfiguration) map[string]string {
+	variables := make(map[string]string)
+	if config.InheritEnvironment {
+		variables = lib.GetEnvironmentVariables()
+	}
+	variables = lib.MergeMaps(variables, config.EnvironmentVariables)
+
+	state, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if err == nil {
+		variables = lib.MergeMaps(variables, state)
+	}
+	return variables
+}
+
+// Renders the values of the variables a code block references in its content,
+// using the variables of the scenario and the ones shared by the code blocks
+// that ran before, so that it can be shown the way it runs. Nothing is run to
+// render it, and file blocks have their variables expanded like the files they
+// write.
+func RenderValues(block parsers.CodeBlock, env map[string]string) string {
+	variables := commandVariables(shells.CommandConfiguration{
+		EnvironmentVariables: env,
+		InheritEnvironment:   true,
+	})
+	if block.File() != "" {
+		return lib.ExpandUnquotedVariables(block.Content, variables)
+	}
+	return lib.ExpandShellVariables(block.Content, variables)
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: $APP_NAME
+spec:
+  replicas: ${REPLICAS}
+  template:
+    spec:
+      containers:
+        - image: '$IMAGE'
+`
+
+func TestWritingFiles(t *testing.T) {
+	t.Run("Builds a command that writes the expanded content", func(t *testing.T) {
+		command := FileCommand(
+			parsers.CodeBlock{
+				Language:   "yaml",
+				Content:    "name: $APP_NAME\n",
+				Attributes: map[string]string{"file": "k8s/app's deployment.yaml"},
+			},
+			map[string]string{"APP_NAME": "web"},
+		)
+
+		assert.Equal(
+			t,
+			"mkdir -p k8s\nprintf '%s' 'name: web\n' > 'k8s/app'\\''s deployment.yaml'",
+			command,
+		)
+	})
+
+	t.Run("Writes the file with the variables set by earlier code blocks", func(t *testing.T) {
+		defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		directory := t.TempDir()
+		executor := shells.BashExecutor{}
+
+		var result CodeBlockResult
+		err := fs.UsingDirectory(directory, func() error {
+			exported := RunCodeBlock(executor, StatefulCodeBlock{
+				CodeBlock: parsers.CodeBlock{Language: "bash", Content: "export REPLICAS=3"},
+			}, shells.CommandConfiguration{})
+			assert.NoError(t, exported.Error)
+
+			result = RunCodeBlock(executor, StatefulCodeBlock{
+				CodeBlock: parsers.CodeBlock{
+					Language:   "yaml",
+					Content:    deployment,
+					Attributes: map[string]string{"file": "manifests/deployment.yaml"},
+				},
+			}, shells.CommandConfiguration{
+				EnvironmentVariables: map[string]string{"APP_NAME": "web"},
+			})
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, result.Error)
+
+		contents, err := os.ReadFile(filepath.Join(directory, "manifests", "deployment.yaml"))
+		assert.NoError(t, err)
+		// $IMAGE isn't set, so it's written as it is.
+		assert.Equal(t, `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+        - image: '$IMAGE'
+`, string(contents))
+	})
+}
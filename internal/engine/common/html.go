@@ -0,0 +1,194 @@
+package common
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+)
+
+//go:embed templates/report.html.tmpl
+var htmlReportTemplate string
+
+var htmlReport = template.Must(template.New("report").Parse(htmlReportTemplate))
+
+type htmlProperty struct {
+	Name  string
+	Value string
+}
+
+type htmlCodeBlock struct {
+	Number             int
+	Language           string
+	File               string
+	Content            string
+	Description        string
+	Status             string
+	StatusText         string
+	StdOut             string
+	StdErr             string
+	Error              string
+	Expected           string
+	ExpectedRegex      string
+	ExpectedSimilarity float64
+	SimilarityScore    float64
+	Diff               template.HTML
+	DurationSeconds    float64
+	TimingPercent      float64
+	// The process started by the code block if it ran in the background.
+	BackgroundPID  int
+	BackgroundLogs string
+	// The variables captured from the output of the code block.
+	Captured []htmlProperty
+}
+
+type htmlStep struct {
+	Number int
+	Name   string
+	Blocks []htmlCodeBlock
+}
+
+// The data the HTML report is rendered from. Every value is masked before it's
+// put into the page.
+type htmlReportData struct {
+	Name            string
+	Success         bool
+	Error           string
+	Seed            int64
+	Properties      []htmlProperty
+	Variables       []htmlProperty
+	Passed          int
+	Failed          int
+	Skipped         int
+	DurationSeconds float64
+	Steps           []htmlStep
+}
+
+func sortedProperties[V any](values map[string]V) []htmlProperty {
+	var properties []htmlProperty
+	for name, value := range values {
+		properties = append(properties, htmlProperty{
+			Name:  secrets.MaskString(name),
+			Value: secrets.MaskString(fmt.Sprintf("%v", value)),
+		})
+	}
+	sort.Slice(properties, func(i, j int) bool { return properties[i].Name < properties[j].Name })
+	return properties
+}
+
+func (report *Report) toHTMLReportData() htmlReportData {
+	codeBlocks := report.sortedCodeBlocks()
+
+	data := htmlReportData{
+		Name:       secrets.MaskString(report.Name),
+		Success:    report.Success,
+		Error:      displayText(report.Error),
+		Seed:       report.Seed,
+		Properties: sortedProperties(report.Properties),
+		Variables:  sortedProperties(report.EnvironmentVariables),
+	}
+
+	longest := 0.0
+	for _, block := range codeBlocks {
+		if block.DurationSeconds > longest {
+			longest = block.DurationSeconds
+		}
+	}
+
+	for _, block := range codeBlocks {
+		if len(data.Steps) == 0 || data.Steps[len(data.Steps)-1].Number != block.StepNumber+1 {
+			data.Steps = append(data.Steps, htmlStep{
+				Number: block.StepNumber + 1,
+				Name:   secrets.MaskString(block.StepName),
+			})
+		}
+
+		expected := block.CodeBlock.ExpectedOutput
+		rendered := htmlCodeBlock{
+			Number:             block.CodeBlockNumber + 1,
+			Language:           block.CodeBlock.Language,
+			File:               block.CodeBlock.File(),
+			Content:            secrets.MaskString(block.CodeBlock.Content),
+			Description:        secrets.MaskString(block.CodeBlock.Description),
+			StdOut:             displayText(block.StdOut),
+			StdErr:             displayText(block.StdErr),
+			Expected:           secrets.MaskString(expected.Content),
+			ExpectedSimilarity: expected.ExpectedSimilarity,
+			SimilarityScore:    block.SimilarityScore,
+			DurationSeconds:    block.DurationSeconds,
+		}
+		if expected.ExpectedRegex != nil {
+			rendered.ExpectedRegex = secrets.MaskString(expected.ExpectedRegex.String())
+		}
+		if block.Error != nil {
+			rendered.Error = displayText(block.Error.Error())
+		}
+		if process, ok := report.backgroundProcess(block); ok {
+			rendered.BackgroundPID = process.PID
+			rendered.BackgroundLogs = displayText(process.Logs)
+		}
+		rendered.Captured = sortedProperties(block.Captured)
+		if longest > 0 {
+			rendered.TimingPercent = block.DurationSeconds / longest * 100
+		}
+
+		rendered.Status = block.Status()
+		switch rendered.Status {
+		case CodeBlockSkipped:
+			rendered.StatusText = "Skipped"
+			data.Skipped++
+		case CodeBlockPassed:
+			rendered.StatusText = "Passed"
+			data.Passed++
+		case CodeBlockFailed:
+			rendered.StatusText = "Failed"
+			data.Failed++
+		default:
+			rendered.StatusText = "Not run"
+		}
+
+		// The diff is only useful when the output didn't match.
+		if expected.Content != "" && expected.ExpectedRegex == nil && rendered.Status == CodeBlockFailed {
+			rendered.Diff = template.HTML(lib.GetHTMLDifferenceBetweenStrings(
+				rendered.Expected,
+				rendered.StdOut,
+			))
+		}
+
+		data.DurationSeconds += block.DurationSeconds
+		step := &data.Steps[len(data.Steps)-1]
+		step.Blocks = append(step.Blocks, rendered)
+	}
+
+	return data
+}
+
+// Renders the report as a self-contained HTML page.
+func (report *Report) ToHTML() (string, error) {
+	var page bytes.Buffer
+	if err := htmlReport.Execute(&page, report.toHTMLReportData()); err != nil {
+		return "", err
+	}
+	return page.String(), nil
+}
+
+// Writes the report to a file as a self-contained HTML page.
+func (report *Report) WriteToHTMLFile(outputPath string) error {
+	page, err := report.ToHTML()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(outputPath, []byte(page), 0644); err != nil {
+		return err
+	}
+
+	logging.GlobalLogger.Infof("Wrote the HTML report to %s", outputPath)
+	return nil
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTMLReports(t *testing.T) {
+	secrets.Register("hunter2")
+
+	report := BuildReport("Deploy <an> app")
+	report.
+		WithSeed(42).
+		WithProperties(map[string]interface{}{"region": "eastus"}).
+		WithEnvironmentVariables(map[string]string{"PASSWORD": "hunter2"}).
+		WithError(errors.New("failed to execute code block 0 on step 1.")).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:        "Verify",
+				StepNumber:      1,
+				CodeBlockNumber: 0,
+				StdOut:          "goodbye\n",
+				Error:           errors.New("Expected output does not match actual output."),
+				DurationSeconds: 0.5,
+				CodeBlock: parsers.CodeBlock{
+					Language: "bash",
+					Content:  "echo goodbye",
+					ExpectedOutput: parsers.ExpectedOutputBlock{
+						Content:            "hello\n",
+						ExpectedSimilarity: 1.0,
+					},
+				},
+			},
+			{
+				StepName:        "Create",
+				StepNumber:      0,
+				CodeBlockNumber: 0,
+				StdOut:          "created\n",
+				Success:         true,
+				DurationSeconds: 2,
+				Captured:        map[string]string{"APP_URL": "http://10.0.0.4"},
+				CodeBlock: parsers.CodeBlock{
+					Language:    "bash",
+					Content:     "echo created && echo hunter2 > /dev/null",
+					Description: "Create the <app>.",
+				},
+			},
+			{
+				StepName:        "Create",
+				StepNumber:      0,
+				CodeBlockNumber: 1,
+				Skipped:         true,
+			},
+			{
+				StepName:        "Create",
+				StepNumber:      0,
+				CodeBlockNumber: 2,
+				Success:         true,
+				CodeBlock: parsers.CodeBlock{
+					Language:   "yaml",
+					Content:    "replicas: 3\n",
+					Attributes: map[string]string{"file": "deployment.yaml"},
+				},
+			},
+		})
+
+	page, err := report.ToHTML()
+	assert.NoError(t, err)
+
+	t.Run("The page includes the scenario title and properties", func(t *testing.T) {
+		assert.Contains(t, page, "<h1>Deploy &lt;an&gt; app</h1>")
+		assert.Contains(t, page, "<tr><th>region</th><td>eastus</td></tr>")
+		assert.Contains(t, page, "<tr><th>Seed</th><td>42</td></tr>")
+		assert.Contains(t, page, "2 passed, 1 failed, 1 skipped")
+	})
+
+	t.Run("Steps are rendered in the order of the scenario", func(t *testing.T) {
+		create := strings.Index(page, "Step 1: Create")
+		verify := strings.Index(page, "Step 2: Verify")
+		assert.True(t, create >= 0 && verify > create)
+		assert.Contains(t, page, "Create the &lt;app&gt;.")
+	})
+
+	t.Run("Code blocks written to files name the file", func(t *testing.T) {
+		assert.Contains(t, page, "File deployment.yaml (yaml)")
+	})
+
+	t.Run("Captured variables are listed with their code block", func(t *testing.T) {
+		assert.Contains(t, page, "<tr><th>APP_URL</th><td>http://10.0.0.4</td></tr>")
+	})
+
+	t.Run("Failed blocks include a diff of the expected output", func(t *testing.T) {
+		assert.Contains(t, page, "<del")
+		assert.Contains(t, page, "<ins")
+		assert.Contains(t, page, "expected at least 1.00")
+	})
+
+	t.Run("Timing bars are relative to the longest block", func(t *testing.T) {
+		assert.Contains(t, page, "width: 100.0%")
+		assert.Contains(t, page, "width: 25.0%")
+	})
+
+	t.Run("Secrets are masked", func(t *testing.T) {
+		assert.NotContains(t, page, "hunter2")
+	})
+
+	t.Run("The report can be written to a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.html")
+		assert.NoError(t, report.WriteToFile(path, ReportFormatHTML))
+
+		contents, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, page, string(contents))
+	})
+}
@@ -0,0 +1,214 @@
+package common
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// A set of JUnit test suites, used when reporting on several scenarios.
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+}
+
+// A scenario, reported as a JUnit test suite.
+type JUnitTestSuite struct {
+	XMLName    xml.Name        `xml:"testsuite"`
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []JUnitProperty `xml:"properties>property,omitempty"`
+	TestCases  []JUnitTestCase `xml:"testcase"`
+}
+
+type JUnitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+// A code block, reported as a JUnit test case.
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Skipped   *JUnitSkipped `xml:"skipped,omitempty"`
+	SystemOut *JUnitOutput  `xml:"system-out,omitempty"`
+	SystemErr *JUnitOutput  `xml:"system-err,omitempty"`
+}
+
+type JUnitFailure struct {
+	Message  string `xml:"message,attr"`
+	Type     string `xml:"type,attr,omitempty"`
+	Contents string `xml:",cdata"`
+}
+
+type JUnitOutput struct {
+	Contents string `xml:",cdata"`
+}
+
+// Creates the output of a test case, or nil if there wasn't any.
+func junitOutput(output string) *JUnitOutput {
+	if output == "" {
+		return nil
+	}
+	return &JUnitOutput{Contents: displayText(output)}
+}
+
+type JUnitSkipped struct {
+	Message string `xml:"message,attr,omitempty"`
+}
+
+// Formats a duration in seconds the way JUnit expects it.
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+// Describes why a code block failed, including how its output differs from
+// the expected output when that is what failed.
+func junitFailureContents(block StatefulCodeBlock) string {
+	var contents strings.Builder
+
+	if block.Error != nil {
+		contents.WriteString(block.Error.Error() + "\n")
+	}
+
+	expected := block.CodeBlock.ExpectedOutput
+	actual := strings.TrimRight(block.StdOut, "\n")
+	if expected.ExpectedRegex != nil {
+		fmt.Fprintf(&contents, "\nExpected output to match: %s\n", expected.ExpectedRegex)
+		fmt.Fprintf(&contents, "\nActual output:\n%s\n", actual)
+	} else if expected.Content != "" {
+		fmt.Fprintf(&contents, "\nExpected output:\n%s\n", strings.TrimRight(expected.Content, "\n"))
+		fmt.Fprintf(&contents, "\nActual output:\n%s\n", actual)
+		fmt.Fprintf(
+			&contents,
+			"\nDiff (-expected +actual):\n%s",
+			lib.GetLineDiffBetweenStrings(expected.Content, block.StdOut),
+		)
+	}
+
+	return displayText(contents.String())
+}
+
+// Converts the report into a JUnit test suite, with a test case for each code
+// block in the order they appear in the scenario.
+func (report *Report) ToJUnitTestSuite() JUnitTestSuite {
+	codeBlocks := report.sortedCodeBlocks()
+
+	suite := JUnitTestSuite{
+		Name: displayText(report.Name),
+		Properties: []JUnitProperty{
+			{Name: "seed", Value: fmt.Sprintf("%d", report.Seed)},
+		},
+	}
+
+	total := 0.0
+	failed := false
+	for _, block := range codeBlocks {
+		testCase := JUnitTestCase{
+			Name: displayText(fmt.Sprintf(
+				"Step %d.%d: %s",
+				block.StepNumber+1,
+				block.CodeBlockNumber+1,
+				block.StepName,
+			)),
+			ClassName: suite.Name,
+			Time:      junitTime(block.DurationSeconds),
+			SystemOut: junitOutput(block.StdOut),
+			SystemErr: junitOutput(block.StdErr),
+		}
+		total += block.DurationSeconds
+
+		// The output of a background process is only known once it's stopped.
+		if process, ok := report.backgroundProcess(block); ok && process.Logs != "" {
+			testCase.SystemOut = junitOutput(fmt.Sprintf(
+				"%s\nOutput of the background process:\n%s",
+				block.StdOut,
+				process.Logs,
+			))
+		}
+
+		switch {
+		case block.Skipped:
+			testCase.Skipped = &JUnitSkipped{Message: "Skipped by --only or --skip"}
+			suite.Skipped++
+		case block.Success:
+		case block.WasExecuted():
+			message := "The code block failed"
+			if block.Error != nil {
+				message, _, _ = strings.Cut(displayText(block.Error.Error()), "\n")
+			}
+			testCase.Failure = &JUnitFailure{
+				Message:  message,
+				Type:     "CodeBlockFailure",
+				Contents: junitFailureContents(block),
+			}
+			suite.Failures++
+			failed = true
+		case failed:
+			testCase.Skipped = &JUnitSkipped{Message: "Not run because an earlier code block failed"}
+			suite.Skipped++
+		default:
+			testCase.Skipped = &JUnitSkipped{Message: "Not run"}
+			suite.Skipped++
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	// A scenario can fail without any of its code blocks failing, i.e. when it
+	// couldn't be set up.
+	if !report.Success && !failed {
+		message, _, _ := strings.Cut(displayText(report.Error), "\n")
+		suite.TestCases = append(suite.TestCases, JUnitTestCase{
+			Name:      "Scenario",
+			ClassName: suite.Name,
+			Time:      junitTime(0),
+			Failure: &JUnitFailure{
+				Message:  message,
+				Type:     "ScenarioFailure",
+				Contents: displayText(report.Error),
+			},
+		})
+		suite.Failures++
+	}
+
+	suite.Tests = len(suite.TestCases)
+	suite.Time = junitTime(total)
+	return suite
+}
+
+// Writes a JUnit test suite or set of test suites to a file.
+func WriteJUnitFile(outputPath string, value interface{}) error {
+	contents, err := xml.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	contents = append([]byte(xml.Header), contents...)
+	logging.GlobalLogger.Infof("Generated the JUnit report:\n %s", contents)
+
+	if err := os.WriteFile(outputPath, append(contents, '\n'), 0644); err != nil {
+		return err
+	}
+
+	logging.GlobalLogger.Infof("Wrote the JUnit report to %s", outputPath)
+	return nil
+}
+
+// Writes the report to a file as JUnit XML.
+func (report *Report) WriteToJUnitFile(outputPath string) error {
+	return WriteJUnitFile(outputPath, report.ToJUnitTestSuite())
+}
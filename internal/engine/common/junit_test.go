@@ -0,0 +1,120 @@
+package common
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJUnitReports(t *testing.T) {
+	report := BuildReport("Deploy an app")
+	report.
+		WithSeed(42).
+		WithError(errors.New("failed to execute code block 0 on step 1.")).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:        "Verify",
+				StepNumber:      1,
+				CodeBlockNumber: 0,
+				StdOut:          "goodbye\n",
+				Error:           errors.New("Expected output does not match actual output."),
+				DurationSeconds: 0.5,
+				CodeBlock: parsers.CodeBlock{
+					Content: "echo goodbye",
+					ExpectedOutput: parsers.ExpectedOutputBlock{
+						Content: "hello\n",
+					},
+				},
+			},
+			{
+				StepName:        "Create",
+				StepNumber:      0,
+				CodeBlockNumber: 0,
+				StdOut:          "created\n",
+				Success:         true,
+				DurationSeconds: 1.25,
+			},
+			{
+				StepName:        "Create",
+				StepNumber:      0,
+				CodeBlockNumber: 1,
+				Skipped:         true,
+			},
+			{
+				StepName:        "Clean up",
+				StepNumber:      2,
+				CodeBlockNumber: 0,
+			},
+		})
+
+	suite := report.ToJUnitTestSuite()
+
+	t.Run("Code blocks become test cases in the order of the scenario", func(t *testing.T) {
+		var names []string
+		for _, testCase := range suite.TestCases {
+			names = append(names, testCase.Name)
+		}
+
+		assert.Equal(t, []string{
+			"Step 1.1: Create",
+			"Step 1.2: Create",
+			"Step 2.1: Verify",
+			"Step 3.1: Clean up",
+		}, names)
+		assert.Equal(t, "Deploy an app", suite.Name)
+		assert.Equal(t, 4, suite.Tests)
+		assert.Equal(t, 1, suite.Failures)
+		assert.Equal(t, 2, suite.Skipped)
+		assert.Equal(t, "1.750", suite.Time)
+	})
+
+	t.Run("Test cases include durations, outputs and failures", func(t *testing.T) {
+		passed := suite.TestCases[0]
+		assert.Equal(t, "1.250", passed.Time)
+		assert.Equal(t, "created\n", passed.SystemOut.Contents)
+		assert.Nil(t, passed.Failure)
+
+		assert.Equal(t, "Skipped by --only or --skip", suite.TestCases[1].Skipped.Message)
+
+		failed := suite.TestCases[2]
+		assert.Equal(t, "Expected output does not match actual output.", failed.Failure.Message)
+		assert.Contains(t, failed.Failure.Contents, "Diff (-expected +actual):\n-hello\n+goodbye\n")
+
+		assert.Equal(t, "Not run because an earlier code block failed", suite.TestCases[3].Skipped.Message)
+	})
+
+	t.Run("Reports are written as JUnit XML", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.xml")
+		assert.NoError(t, report.WriteToFile(path, ReportFormatJUnit))
+
+		contents, err := os.ReadFile(path)
+		assert.NoError(t, err)
+
+		var written JUnitTestSuite
+		assert.NoError(t, xml.Unmarshal(contents, &written))
+		assert.Equal(t, suite.Tests, written.Tests)
+		assert.Equal(t, "42", written.Properties[0].Value)
+		assert.Equal(t, suite.TestCases[2].Failure.Contents, written.TestCases[2].Failure.Contents)
+	})
+
+	t.Run("Scenarios that fail without a failed code block get a failed test case", func(t *testing.T) {
+		report := BuildReport("Broken")
+		report.WithError(errors.New("failed to set the subscription"))
+
+		suite := report.ToJUnitTestSuite()
+
+		assert.Equal(t, 1, suite.Tests)
+		assert.Equal(t, 1, suite.Failures)
+		assert.Equal(t, "failed to set the subscription", suite.TestCases[0].Failure.Message)
+	})
+
+	t.Run("Unknown formats are rejected", func(t *testing.T) {
+		assert.False(t, IsValidReportFormat("yaml"))
+		assert.Error(t, report.WriteToFile(filepath.Join(t.TempDir(), "report"), "yaml"))
+	})
+}
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// Gets the values of the variables a shell code block assigns from the
+// environment state file, once the code block ran. Reports record them so that
+// replaying the code block assigns the same values.
+func assignedVariables(executor shells.Executor, block parsers.CodeBlock) map[string]string {
+	if !holdsShellCommands(executor, block) {
+		return nil
+	}
+
+	state, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if err != nil {
+		return nil
+	}
+
+	var variables map[string]string
+	for _, assignment := range parsers.FindBashAssignments(block.Content) {
+		value, ok := state[assignment.Name]
+		if !ok {
+			continue
+		}
+		if variables == nil {
+			variables = make(map[string]string)
+		}
+		variables[assignment.Name] = value
+	}
+	return variables
+}
+
+// Loads a JSON report written by `ie test --report`.
+func LoadReport(path string) (*Report, []byte, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the report '%s': %w", path, err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(contents, &report); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the report '%s': %w", path, err)
+	}
+
+	major, _, _ := strings.Cut(report.SchemaVersion, ".")
+	supportedMajor, _, _ := strings.Cut(ReportSchemaVersion, ".")
+	if report.SchemaVersion != "" && major != supportedMajor {
+		return nil, nil, fmt.Errorf(
+			"the report '%s' uses version %s of the report schema, which this version of ie can't read. Supported version: %s",
+			path,
+			report.SchemaVersion,
+			ReportSchemaVersion,
+		)
+	}
+
+	// Reports written before the schema was versioned don't record where the
+	// scenario failed and may have their code blocks out of order.
+	if report.SchemaVersion == "" {
+		report.WithCodeBlocks(report.CodeBlocks)
+	}
+
+	return &report, contents, nil
+}
+
+// Gets the selectors for the code blocks that were skipped with --only or
+// --skip, so that they can be skipped again when the report is replayed.
+func (report *Report) SkippedCodeBlockSelectors() []string {
+	var selectors []string
+	for _, block := range report.sortedCodeBlocks() {
+		if block.Skipped {
+			selectors = append(
+				selectors,
+				fmt.Sprintf("%d.%d", block.StepNumber+1, block.CodeBlockNumber+1),
+			)
+		}
+	}
+	return selectors
+}
+
+// Rebuilds the scenario recorded by a report, so that it can be run again with
+// the same variables. The values each code block assigned override its
+// assignments, while the values of the other variables override their
+// assignments everywhere, just like --var does. Only the assignments of shell
+// code blocks are rewritten, the other languages and files are left as is. Secrets are masked inside of
+// reports, so their values have to be given again through
+// environmentVariableOverrides. When untilFailure is set, the scenario stops
+// at the code block that failed.
+func CreateScenarioFromReport(
+	path string,
+	environmentVariableOverrides map[string]string,
+	untilFailure bool,
+) (*Scenario, error) {
+	report, source, err := LoadReport(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secretVariables, err := extractStringListFromProperties(report.Properties, secretsProperty)
+	if err != nil {
+		return nil, err
+	}
+	secrets.MarkAsSecret(secretVariables...)
+	secrets.RegisterVariables(environmentVariableOverrides)
+
+	codeBlocks := report.sortedCodeBlocks()
+
+	// Variables assigned by the code blocks are assigned the values they had
+	// once each code block ran, instead of the values they ended up with.
+	assignedByCodeBlocks := make(map[string]bool)
+	for _, block := range codeBlocks {
+		for key := range block.Variables {
+			assignedByCodeBlocks[key] = true
+		}
+	}
+
+	environmentVariables := make(map[string]string)
+	variableSources := make(map[string]string)
+	for key, value := range report.EnvironmentVariables {
+		if assignedByCodeBlocks[key] {
+			continue
+		}
+		environmentVariables[key] = value
+		variableSources[key] = path
+	}
+	for key, value := range environmentVariableOverrides {
+		environmentVariables[key] = value
+		variableSources[key] = "--var"
+	}
+
+	if untilFailure {
+		failed, ok := report.FailedCodeBlock()
+		if !ok {
+			return nil, fmt.Errorf("the report '%s' doesn't record a failed code block", path)
+		}
+
+		for index, block := range codeBlocks {
+			if block.StepNumber == failed.StepNumber &&
+				block.CodeBlockNumber == failed.CodeBlockNumber {
+				codeBlocks = codeBlocks[:index+1]
+				break
+			}
+		}
+	}
+
+	masked := make(map[string]bool)
+	for key, value := range environmentVariables {
+		if strings.Contains(value, secrets.Mask) {
+			masked[key] = true
+		}
+	}
+	for _, block := range codeBlocks {
+		for key, value := range block.Variables {
+			_, overridden := environmentVariableOverrides[key]
+			if !overridden && strings.Contains(value, secrets.Mask) {
+				masked[key] = true
+			}
+		}
+	}
+	if len(masked) > 0 {
+		var names []string
+		for key := range masked {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf(
+			"the report masks the values of %s. Set them with --var <key>=<value> to replay the scenario",
+			strings.Join(names, ", "),
+		)
+	}
+
+	blocks := make([]parsers.CodeBlock, len(codeBlocks))
+	for index, block := range codeBlocks {
+		blocks[index] = block.CodeBlock
+		if strings.Contains(block.CodeBlock.Content, secrets.Mask) {
+			logging.GlobalLogger.Warnf(
+				"The code block %d.%d contains a masked value and may not run as it did originally",
+				block.StepNumber+1,
+				block.CodeBlockNumber+1,
+			)
+		}
+	}
+
+	for _, key := range sortedKeys(environmentVariables) {
+		overrideVariableAssignments(blocks, key, environmentVariables[key])
+	}
+	for index, block := range codeBlocks {
+		for _, key := range sortedKeys(block.Variables) {
+			if _, overridden := environmentVariableOverrides[key]; overridden {
+				continue
+			}
+			overrideVariableAssignments(blocks[index:index+1], key, block.Variables[key])
+		}
+	}
+
+	var steps []Step
+	for index, block := range codeBlocks {
+		if index == 0 || codeBlocks[index-1].StepNumber != block.StepNumber {
+			steps = append(steps, Step{Name: block.StepName})
+		}
+		steps[len(steps)-1].CodeBlocks = append(steps[len(steps)-1].CodeBlocks, blocks[index])
+	}
+
+	return &Scenario{
+		Name:            report.Name,
+		Path:            path,
+		Steps:           steps,
+		Properties:      report.Properties,
+		Environment:     environmentVariables,
+		VariableSources: variableSources,
+		Seed:            report.Seed,
+		Source:          source,
+	}, nil
+}
@@ -0,0 +1,288 @@
+package common
+
+import (
+	"errors"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestReport(t *testing.T, report Report) string {
+	path := filepath.Join(t.TempDir(), "report.json")
+	assert.NoError(t, report.WriteToJSONFile(path))
+	return path
+}
+
+func TestReplayingReports(t *testing.T) {
+	report := BuildReport("Deploy an app")
+	report.
+		WithSeed(42).
+		WithEnvironmentVariables(map[string]string{"RESOURCE_GROUP": "rg-1a2b3c"}).
+		WithError(errors.New("failed to execute code block 0 on step 1.")).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:        "Verify",
+				StepNumber:      1,
+				CodeBlockNumber: 0,
+				StdOut:          "goodbye\n",
+				Error:           errors.New("Expected output does not match actual output."),
+				CodeBlock: parsers.CodeBlock{
+					Language: "bash",
+					Content:  "echo goodbye",
+					ExpectedOutput: parsers.ExpectedOutputBlock{
+						Content:       "hello\n",
+						ExpectedRegex: regexp.MustCompile("^hello"),
+					},
+				},
+			},
+			{
+				StepName:        "Create",
+				StepNumber:      0,
+				CodeBlockNumber: 0,
+				StdOut:          "created\n",
+				Success:         true,
+				CodeBlock: parsers.CodeBlock{
+					Language: "bash",
+					Content:  "export RESOURCE_GROUP=rg-$RANDOM\necho created",
+				},
+			},
+			{
+				StepName:        "Create",
+				StepNumber:      0,
+				CodeBlockNumber: 1,
+				Skipped:         true,
+				CodeBlock:       parsers.CodeBlock{Language: "bash", Content: "echo skipped"},
+			},
+			{
+				StepName:        "Clean up",
+				StepNumber:      2,
+				CodeBlockNumber: 0,
+				CodeBlock:       parsers.CodeBlock{Language: "bash", Content: "echo bye"},
+			},
+		})
+	path := writeTestReport(t, report)
+
+	t.Run("Reports can be loaded again, including errors", func(t *testing.T) {
+		loaded, _, err := LoadReport(path)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "Deploy an app", loaded.Name)
+		assert.Equal(t, int64(42), loaded.Seed)
+		assert.Len(t, loaded.CodeBlocks, 4)
+		assert.EqualError(
+			t,
+			loaded.CodeBlocks[2].Error,
+			"Expected output does not match actual output.",
+		)
+		assert.Nil(t, loaded.CodeBlocks[0].Error)
+		assert.Equal(t, "^hello", loaded.CodeBlocks[2].CodeBlock.ExpectedOutput.ExpectedRegex.String())
+		assert.Equal(t, []string{"1.2"}, loaded.SkippedCodeBlockSelectors())
+
+		failed, ok := loaded.FailedCodeBlock()
+		assert.True(t, ok)
+		assert.Equal(t, "Verify", failed.StepName)
+	})
+
+	t.Run("The scenario uses the recorded values of the variables", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, map[string]string{}, false)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "Deploy an app", scenario.Name)
+		assert.Equal(t, int64(42), scenario.Seed)
+		assert.Equal(t, "rg-1a2b3c", scenario.Environment["RESOURCE_GROUP"])
+
+		var names []string
+		for _, step := range scenario.Steps {
+			names = append(names, step.Name)
+		}
+		assert.Equal(t, []string{"Create", "Verify", "Clean up"}, names)
+		assert.Len(t, scenario.Steps[0].CodeBlocks, 2)
+		assert.Equal(
+			t,
+			"export RESOURCE_GROUP=rg-1a2b3c\necho created",
+			scenario.Steps[0].CodeBlocks[0].Content,
+		)
+	})
+
+	t.Run("The scenario can stop at the code block that failed", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, map[string]string{}, true)
+		assert.NoError(t, err)
+
+		assert.Len(t, scenario.Steps, 2)
+		assert.Equal(t, "echo goodbye", scenario.Steps[1].CodeBlocks[0].Content)
+	})
+
+	t.Run("Variables can be overridden", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(
+			path,
+			map[string]string{"RESOURCE_GROUP": "rg-other"},
+			false,
+		)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "rg-other", scenario.Environment["RESOURCE_GROUP"])
+		assert.Equal(t, "--var", scenario.VariableSources["RESOURCE_GROUP"])
+	})
+}
+
+func TestReplayingTheValuesOfEachCodeBlock(t *testing.T) {
+	report := BuildReport("Scale")
+	report.
+		WithEnvironmentVariables(map[string]string{"REGION": "westus", "NODE_COUNT": "3"}).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:  "Create",
+				Success:   true,
+				CodeBlock: parsers.CodeBlock{Language: "bash", Content: "export NODE_COUNT=$((RANDOM % 3))"},
+				Variables: map[string]string{"NODE_COUNT": "1"},
+			},
+			{
+				StepName:        "Scale",
+				StepNumber:      1,
+				Success:         true,
+				CodeBlock:       parsers.CodeBlock{Language: "bash", Content: "export NODE_COUNT=$((NODE_COUNT + 2))\necho $REGION"},
+				Variables:       map[string]string{"NODE_COUNT": "3"},
+				CodeBlockNumber: 0,
+			},
+		})
+	path := writeTestReport(t, report)
+
+	t.Run("Code blocks assign the values they assigned when the report was written", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, map[string]string{}, false)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "export NODE_COUNT=1", scenario.Steps[0].CodeBlocks[0].Content)
+		assert.Equal(t, "export NODE_COUNT=3\necho $REGION", scenario.Steps[1].CodeBlocks[0].Content)
+		assert.Equal(t, map[string]string{"REGION": "westus"}, scenario.Environment)
+	})
+
+	t.Run("Running a code block records the values it assigned", func(t *testing.T) {
+		defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+		result := RunCodeBlock(shells.BashExecutor{}, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{
+				Language: "bash",
+				Content:  "export NODE_COUNT=$((1 + 2))\nexport REGION=eastus\necho $NODE_COUNT",
+			},
+		}, shells.CommandConfiguration{})
+		assert.NoError(t, result.Error)
+		assert.Equal(t, map[string]string{"NODE_COUNT": "3", "REGION": "eastus"}, result.Variables)
+	})
+
+	t.Run("Code blocks that aren't shell commands don't record variables", func(t *testing.T) {
+		defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		assert.NoError(t, lib.WriteEnvironmentStateFile(
+			lib.DefaultEnvironmentStateFile,
+			map[string]string{"NODE_COUNT": "3"},
+		))
+
+		result := RunCodeBlock(shells.BashExecutor{}, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{Language: "python", Content: "NODE_COUNT=5\nprint(NODE_COUNT)"},
+		}, shells.CommandConfiguration{})
+		assert.NoError(t, result.Error)
+		assert.Nil(t, result.Variables)
+	})
+
+	t.Run("Variables given again override every assignment", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, map[string]string{"NODE_COUNT": "5"}, false)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "export NODE_COUNT=5", scenario.Steps[0].CodeBlocks[0].Content)
+		assert.Equal(t, "5", scenario.Environment["NODE_COUNT"])
+	})
+}
+
+func TestReplayingCodeBlocksInOtherLanguages(t *testing.T) {
+	report := BuildReport("Languages")
+	report.
+		WithEnvironmentVariables(map[string]string{"REGION": "westus"}).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:  "Shell",
+				Success:   true,
+				CodeBlock: parsers.CodeBlock{Language: "bash", Content: "export REGION=eastus"},
+			},
+			{
+				StepName:        "Python",
+				Success:         true,
+				CodeBlockNumber: 1,
+				CodeBlock:       parsers.CodeBlock{Language: "python", Content: "REGION='eastus'"},
+			},
+			{
+				StepName:        "File",
+				Success:         true,
+				CodeBlockNumber: 2,
+				CodeBlock: parsers.CodeBlock{
+					Language:   "text",
+					Content:    "REGION=eastus",
+					Attributes: map[string]string{"file": "config.env"},
+				},
+			},
+		})
+	path := writeTestReport(t, report)
+
+	t.Run("Only the assignments of shell code blocks are rewritten", func(t *testing.T) {
+		scenario, err := CreateScenarioFromReport(path, map[string]string{}, false)
+		assert.NoError(t, err)
+
+		blocks := scenario.Steps[0].CodeBlocks
+		assert.Equal(t, "export REGION=westus", blocks[0].Content)
+		assert.Equal(t, "REGION='eastus'", blocks[1].Content)
+		assert.Equal(t, "REGION=eastus", blocks[2].Content)
+	})
+}
+
+func TestReplayingReportsWithSecrets(t *testing.T) {
+	report := BuildReport("Secrets")
+	report.WithEnvironmentVariables(map[string]string{"ADMIN_PASSWORD": "Sup3r$ecretValue!"})
+	path := writeTestReport(t, report)
+
+	t.Run("Masked variables have to be given again", func(t *testing.T) {
+		_, err := CreateScenarioFromReport(path, map[string]string{}, false)
+		assert.ErrorContains(t, err, "ADMIN_PASSWORD")
+
+		scenario, err := CreateScenarioFromReport(
+			path,
+			map[string]string{"ADMIN_PASSWORD": "An0ther$ecretValue!"},
+			false,
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, "An0ther$ecretValue!", scenario.Environment["ADMIN_PASSWORD"])
+	})
+
+	t.Run("Values that contain masked secrets have to be given again", func(t *testing.T) {
+		secrets.Register("replay-test-secret")
+		report := BuildReport("Database")
+		report.
+			WithEnvironmentVariables(map[string]string{
+				"DATABASE_URL": "postgres://admin:replay-test-secret@db:5432",
+			}).
+			WithCodeBlocks([]StatefulCodeBlock{
+				{
+					StepName:  "Connect",
+					Success:   true,
+					CodeBlock: parsers.CodeBlock{Language: "bash", Content: "export LOGIN=admin:$(cat secret.txt)"},
+					Variables: map[string]string{"LOGIN": "admin:replay-test-secret"},
+				},
+			})
+		path := writeTestReport(t, report)
+
+		_, err := CreateScenarioFromReport(path, map[string]string{}, false)
+		assert.ErrorContains(t, err, "the report masks the values of DATABASE_URL, LOGIN.")
+	})
+
+	t.Run("Reports without a failure can't be replayed until the failure", func(t *testing.T) {
+		_, err := CreateScenarioFromReport(
+			path,
+			map[string]string{"ADMIN_PASSWORD": "An0ther$ecretValue!"},
+			true,
+		)
+		assert.ErrorContains(t, err, "doesn't record a failed code block")
+	})
+}
@@ -0,0 +1,367 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// A code block only counts as slower when it takes this many times as long as
+// it used to, and at least durationRegressionMinimum seconds more, so that the
+// noise of fast code blocks isn't reported.
+const (
+	durationRegressionRatio   = 1.5
+	durationRegressionMinimum = 1.0
+)
+
+// How a code block or variable changed between two reports.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// The differences of a code block between two reports.
+type CodeBlockDiff struct {
+	StepName        string `json:"stepName"`
+	StepNumber      int    `json:"stepNumber"`
+	CodeBlockNumber int    `json:"codeBlockNumber"`
+	Change          string `json:"change"`
+	StatusBefore    string `json:"statusBefore,omitempty"`
+	StatusAfter     string `json:"statusAfter,omitempty"`
+	// Line diffs of the command and its output, empty when they didn't change.
+	ContentDiff           string  `json:"contentDiff,omitempty"`
+	OutputDiff            string  `json:"outputDiff,omitempty"`
+	SimilarityBefore      float64 `json:"similarityScoreBefore"`
+	SimilarityAfter       float64 `json:"similarityScoreAfter"`
+	DurationSecondsBefore float64 `json:"durationSecondsBefore"`
+	DurationSecondsAfter  float64 `json:"durationSecondsAfter"`
+	DurationRegression    bool    `json:"durationRegression"`
+	ErrorAfter            string  `json:"errorAfter,omitempty"`
+}
+
+// The difference of a variable between two reports.
+type VariableDiff struct {
+	Name   string `json:"name"`
+	Change string `json:"change"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// The differences between an earlier and a later report of a scenario. Only
+// the code blocks and variables that changed are included.
+type ReportDiff struct {
+	NameBefore    string          `json:"nameBefore"`
+	NameAfter     string          `json:"nameAfter"`
+	SuccessBefore bool            `json:"successBefore"`
+	SuccessAfter  bool            `json:"successAfter"`
+	CodeBlocks    []CodeBlockDiff `json:"codeBlocks"`
+	Variables     []VariableDiff  `json:"variables"`
+}
+
+// Gets the keys that match the code blocks of a scenario across reports, in
+// the order of blocks. Code blocks are matched by their step name and position
+// within the step, so that adding a step to a scenario doesn't make every
+// later block differ. Steps sharing a name are told apart by how many steps
+// with that name come before them.
+func CodeBlockKeys(blocks []StatefulCodeBlock) []string {
+	stepNumbers := make(map[string][]int)
+	for _, block := range blocks {
+		stepNumbers[block.StepName] = append(stepNumbers[block.StepName], block.StepNumber)
+	}
+	for _, numbers := range stepNumbers {
+		sort.Ints(numbers)
+	}
+
+	keys := make([]string, len(blocks))
+	for i, block := range blocks {
+		// Steps with several code blocks appear several times, so the occurrence
+		// is the number of distinct steps before this one.
+		occurrence := 0
+		numbers := stepNumbers[block.StepName]
+		for j, number := range numbers {
+			if number >= block.StepNumber {
+				break
+			}
+			if j == 0 || numbers[j-1] != number {
+				occurrence++
+			}
+		}
+		keys[i] = fmt.Sprintf("%s\x00%d\x00%d", block.StepName, occurrence, block.CodeBlockNumber)
+	}
+	return keys
+}
+
+// Compares an earlier report of a scenario with a later one.
+func DiffReports(before *Report, after *Report) ReportDiff {
+	diff := ReportDiff{
+		NameBefore:    secrets.MaskString(before.Name),
+		NameAfter:     secrets.MaskString(after.Name),
+		SuccessBefore: before.Success,
+		SuccessAfter:  after.Success,
+		CodeBlocks:    []CodeBlockDiff{},
+		Variables:     []VariableDiff{},
+	}
+
+	sortedBefore := before.sortedCodeBlocks()
+	keysBefore := CodeBlockKeys(sortedBefore)
+	blocksBefore := make(map[string]StatefulCodeBlock)
+	for i, block := range sortedBefore {
+		blocksBefore[keysBefore[i]] = block
+	}
+
+	sortedAfter := after.sortedCodeBlocks()
+	keysAfter := CodeBlockKeys(sortedAfter)
+	matched := make(map[string]bool)
+	for i, block := range sortedAfter {
+		key := keysAfter[i]
+		earlier, ok := blocksBefore[key]
+		if !ok {
+			diff.CodeBlocks = append(diff.CodeBlocks, CodeBlockDiff{
+				StepName:             secrets.MaskString(block.StepName),
+				StepNumber:           block.StepNumber,
+				CodeBlockNumber:      block.CodeBlockNumber,
+				Change:               ChangeAdded,
+				StatusAfter:          block.Status(),
+				SimilarityAfter:      block.SimilarityScore,
+				DurationSecondsAfter: block.DurationSeconds,
+				ErrorAfter:           codeBlockError(block),
+			})
+			continue
+		}
+
+		matched[key] = true
+		if blockDiff, changed := diffCodeBlocks(earlier, block); changed {
+			diff.CodeBlocks = append(diff.CodeBlocks, blockDiff)
+		}
+	}
+
+	for i, block := range sortedBefore {
+		if matched[keysBefore[i]] {
+			continue
+		}
+		diff.CodeBlocks = append(diff.CodeBlocks, CodeBlockDiff{
+			StepName:              secrets.MaskString(block.StepName),
+			StepNumber:            block.StepNumber,
+			CodeBlockNumber:       block.CodeBlockNumber,
+			Change:                ChangeRemoved,
+			StatusBefore:          block.Status(),
+			SimilarityBefore:      block.SimilarityScore,
+			DurationSecondsBefore: block.DurationSeconds,
+		})
+	}
+
+	diff.Variables = diffVariables(before.EnvironmentVariables, after.EnvironmentVariables)
+	return diff
+}
+
+func codeBlockError(block StatefulCodeBlock) string {
+	if block.Error == nil {
+		return ""
+	}
+	return displayText(block.Error.Error())
+}
+
+// Compares two runs of the same code block, returning whether anything worth
+// reporting changed.
+func diffCodeBlocks(before StatefulCodeBlock, after StatefulCodeBlock) (CodeBlockDiff, bool) {
+	diff := CodeBlockDiff{
+		StepName:              secrets.MaskString(after.StepName),
+		StepNumber:            after.StepNumber,
+		CodeBlockNumber:       after.CodeBlockNumber,
+		Change:                ChangeChanged,
+		StatusBefore:          before.Status(),
+		StatusAfter:           after.Status(),
+		SimilarityBefore:      before.SimilarityScore,
+		SimilarityAfter:       after.SimilarityScore,
+		DurationSecondsBefore: before.DurationSeconds,
+		DurationSecondsAfter:  after.DurationSeconds,
+		ErrorAfter:            codeBlockError(after),
+	}
+
+	if before.CodeBlock.Content != after.CodeBlock.Content {
+		diff.ContentDiff = displayText(lib.GetLineDiffBetweenStrings(
+			before.CodeBlock.Content,
+			after.CodeBlock.Content,
+		))
+	}
+	if before.StdOut != after.StdOut {
+		diff.OutputDiff = displayText(lib.GetLineDiffBetweenStrings(before.StdOut, after.StdOut))
+	}
+
+	diff.DurationRegression = after.DurationSeconds >= before.DurationSeconds*durationRegressionRatio &&
+		after.DurationSeconds-before.DurationSeconds >= durationRegressionMinimum
+
+	changed := diff.StatusBefore != diff.StatusAfter ||
+		diff.ContentDiff != "" ||
+		diff.OutputDiff != "" ||
+		math.Abs(diff.SimilarityBefore-diff.SimilarityAfter) > 0.001 ||
+		diff.DurationRegression
+	return diff, changed
+}
+
+// Compares the variables of two reports. Secrets are already masked inside of
+// reports, so a secret only shows up as added or removed.
+func diffVariables(before map[string]string, after map[string]string) []VariableDiff {
+	diffs := []VariableDiff{}
+
+	for _, name := range sortedKeys(after) {
+		earlier, ok := before[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, VariableDiff{Name: name, Change: ChangeAdded, After: after[name]})
+		case earlier != after[name]:
+			diffs = append(diffs, VariableDiff{
+				Name:   name,
+				Change: ChangeChanged,
+				Before: earlier,
+				After:  after[name],
+			})
+		}
+	}
+
+	for _, name := range sortedKeys(before) {
+		if _, ok := after[name]; !ok {
+			diffs = append(diffs, VariableDiff{Name: name, Change: ChangeRemoved, Before: before[name]})
+		}
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool { return diffs[i].Name < diffs[j].Name })
+	for index := range diffs {
+		diffs[index].Before = secrets.MaskString(diffs[index].Before)
+		diffs[index].After = secrets.MaskString(diffs[index].After)
+	}
+	return diffs
+}
+
+// Checks if the reports differ at all.
+func (diff ReportDiff) HasChanges() bool {
+	return diff.SuccessBefore != diff.SuccessAfter ||
+		len(diff.CodeBlocks) > 0 ||
+		len(diff.Variables) > 0
+}
+
+func renderStatus(status string) string {
+	switch status {
+	case CodeBlockPassed:
+		return ui.CheckStyle.Render(status)
+	case CodeBlockFailed:
+		return ui.ErrorStyle.Render(status)
+	default:
+		return ui.SkippedStyle.Render(status)
+	}
+}
+
+func renderSuccess(success bool) string {
+	if success {
+		return renderStatus(CodeBlockPassed)
+	}
+	return renderStatus(CodeBlockFailed)
+}
+
+func indent(text string, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix) + "\n"
+}
+
+// Renders the differences for the terminal.
+func (diff ReportDiff) Render() string {
+	var text strings.Builder
+
+	fmt.Fprintf(
+		&text,
+		"%s: %s -> %s\n",
+		ui.ScenarioTitleStyle.Render(diff.NameAfter),
+		renderSuccess(diff.SuccessBefore),
+		renderSuccess(diff.SuccessAfter),
+	)
+	if diff.NameBefore != diff.NameAfter {
+		fmt.Fprintf(&text, "Renamed from %s\n", diff.NameBefore)
+	}
+
+	if !diff.HasChanges() {
+		text.WriteString("\nNo differences between the reports.\n")
+		return text.String()
+	}
+
+	for _, block := range diff.CodeBlocks {
+		title := fmt.Sprintf(
+			"Step %d.%d: %s",
+			block.StepNumber+1,
+			block.CodeBlockNumber+1,
+			block.StepName,
+		)
+
+		switch block.Change {
+		case ChangeAdded:
+			fmt.Fprintf(&text, "\n%s (added, %s)\n", title, renderStatus(block.StatusAfter))
+		case ChangeRemoved:
+			fmt.Fprintf(&text, "\n%s (removed)\n", title)
+			continue
+		default:
+			if block.StatusBefore != block.StatusAfter {
+				fmt.Fprintf(
+					&text,
+					"\n%s %s -> %s\n",
+					title,
+					renderStatus(block.StatusBefore),
+					renderStatus(block.StatusAfter),
+				)
+			} else {
+				fmt.Fprintf(&text, "\n%s %s\n", title, renderStatus(block.StatusAfter))
+			}
+		}
+
+		if block.Change == ChangeChanged &&
+			math.Abs(block.SimilarityBefore-block.SimilarityAfter) > 0.001 {
+			fmt.Fprintf(
+				&text,
+				"  Similarity: %.2f -> %.2f\n",
+				block.SimilarityBefore,
+				block.SimilarityAfter,
+			)
+		}
+
+		duration := fmt.Sprintf(
+			"  Duration: %.1fs -> %.1fs",
+			block.DurationSecondsBefore,
+			block.DurationSecondsAfter,
+		)
+		if block.DurationRegression {
+			text.WriteString(ui.WarningStyle.Render(duration+" (slower)") + "\n")
+		} else if block.Change == ChangeChanged {
+			text.WriteString(duration + "\n")
+		}
+
+		if block.ContentDiff != "" {
+			text.WriteString("  Command:\n" + indent(block.ContentDiff, "    "))
+		}
+		if block.OutputDiff != "" {
+			text.WriteString("  Output:\n" + indent(block.OutputDiff, "    "))
+		}
+		if block.ErrorAfter != "" && block.StatusAfter == CodeBlockFailed {
+			text.WriteString("  Error:\n" + indent(block.ErrorAfter, "    "))
+		}
+	}
+
+	if len(diff.Variables) > 0 {
+		text.WriteString("\nVariables:\n")
+		for _, variable := range diff.Variables {
+			switch variable.Change {
+			case ChangeAdded:
+				fmt.Fprintf(&text, "  %s: added %s\n", variable.Name, variable.After)
+			case ChangeRemoved:
+				fmt.Fprintf(&text, "  %s: removed, was %s\n", variable.Name, variable.Before)
+			default:
+				fmt.Fprintf(&text, "  %s: %s -> %s\n", variable.Name, variable.Before, variable.After)
+			}
+		}
+	}
+
+	return text.String()
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportDiffs(t *testing.T) {
+	before := BuildReport("Deploy an app")
+	before.
+		WithEnvironmentVariables(map[string]string{
+			"RESOURCE_GROUP": "rg-1a2b3c",
+			"LOCATION":       "eastus",
+			"OLD_VARIABLE":   "1",
+		}).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:        "Create",
+				StdOut:          "created\n",
+				Success:         true,
+				DurationSeconds: 2,
+				CodeBlock:       parsers.CodeBlock{Content: "az group create"},
+			},
+			{
+				StepName:        "Verify",
+				StepNumber:      1,
+				StdOut:          "hello\n",
+				Success:         true,
+				SimilarityScore: 1,
+				DurationSeconds: 1,
+				CodeBlock:       parsers.CodeBlock{Content: "echo hello"},
+			},
+			{
+				StepName:        "Unchanged",
+				StepNumber:      2,
+				StdOut:          "same\n",
+				Success:         true,
+				DurationSeconds: 1,
+				CodeBlock:       parsers.CodeBlock{Content: "echo same"},
+			},
+			{StepName: "Removed", StepNumber: 3, Success: true},
+		})
+
+	after := BuildReport("Deploy an app")
+	after.
+		WithEnvironmentVariables(map[string]string{
+			"RESOURCE_GROUP": "rg-4d5e6f",
+			"LOCATION":       "eastus",
+			"NEW_VARIABLE":   "2",
+		}).
+		WithError(errors.New("failed to execute code block 0 on step 2.")).
+		WithCodeBlocks([]StatefulCodeBlock{
+			{
+				StepName:        "Create",
+				StdOut:          "created\n",
+				Success:         true,
+				DurationSeconds: 10,
+				CodeBlock:       parsers.CodeBlock{Content: "az group create"},
+			},
+			{
+				StepName:        "Added",
+				StepNumber:      1,
+				Success:         true,
+				DurationSeconds: 1,
+			},
+			{
+				StepName:        "Verify",
+				StepNumber:      2,
+				StdOut:          "goodbye\n",
+				Error:           errors.New("Expected output does not match actual output."),
+				SimilarityScore: 0.5,
+				DurationSeconds: 1.2,
+				CodeBlock:       parsers.CodeBlock{Content: "echo goodbye"},
+			},
+			{
+				StepName:        "Unchanged",
+				StepNumber:      3,
+				StdOut:          "same\n",
+				Success:         true,
+				DurationSeconds: 1.2,
+				CodeBlock:       parsers.CodeBlock{Content: "echo same"},
+			},
+		})
+
+	diff := DiffReports(&before, &after)
+
+	t.Run("Only the code blocks that changed are included", func(t *testing.T) {
+		var changes []string
+		for _, block := range diff.CodeBlocks {
+			changes = append(changes, block.StepName+": "+block.Change)
+		}
+
+		assert.Equal(t, []string{
+			"Create: changed",
+			"Added: added",
+			"Verify: changed",
+			"Removed: removed",
+		}, changes)
+		assert.True(t, diff.SuccessBefore)
+		assert.False(t, diff.SuccessAfter)
+		assert.True(t, diff.HasChanges())
+	})
+
+	t.Run("Status, output, similarity and duration changes are recorded", func(t *testing.T) {
+		created := diff.CodeBlocks[0]
+		assert.True(t, created.DurationRegression)
+		assert.Empty(t, created.OutputDiff)
+
+		verify := diff.CodeBlocks[2]
+		assert.Equal(t, CodeBlockPassed, verify.StatusBefore)
+		assert.Equal(t, CodeBlockFailed, verify.StatusAfter)
+		assert.Equal(t, "-hello\n+goodbye\n", verify.OutputDiff)
+		assert.Equal(t, "-echo hello\n+echo goodbye\n", verify.ContentDiff)
+		assert.Equal(t, 1.0, verify.SimilarityBefore)
+		assert.Equal(t, 0.5, verify.SimilarityAfter)
+		assert.False(t, verify.DurationRegression)
+		assert.Equal(t, "Expected output does not match actual output.", verify.ErrorAfter)
+	})
+
+	t.Run("Variable changes are recorded", func(t *testing.T) {
+		assert.Equal(t, []VariableDiff{
+			{Name: "NEW_VARIABLE", Change: ChangeAdded, After: "2"},
+			{Name: "OLD_VARIABLE", Change: ChangeRemoved, Before: "1"},
+			{Name: "RESOURCE_GROUP", Change: ChangeChanged, Before: "rg-1a2b3c", After: "rg-4d5e6f"},
+		}, diff.Variables)
+	})
+
+	t.Run("The differences can be rendered for the terminal", func(t *testing.T) {
+		rendered := diff.Render()
+
+		assert.Contains(t, rendered, "Step 3.1: Verify")
+		assert.Contains(t, rendered, "Similarity: 1.00 -> 0.50")
+		assert.Contains(t, rendered, "Duration: 2.0s -> 10.0s (slower)")
+		assert.Contains(t, rendered, "    -hello\n    +goodbye\n")
+		assert.Contains(t, rendered, "RESOURCE_GROUP: rg-1a2b3c -> rg-4d5e6f")
+		assert.Contains(t, rendered, "Step 4.1: Removed (removed)")
+	})
+
+	t.Run("Identical reports have no differences", func(t *testing.T) {
+		same := DiffReports(&after, &after)
+		assert.False(t, same.HasChanges())
+		assert.Contains(t, same.Render(), "No differences between the reports.")
+	})
+
+	t.Run("Steps sharing a name are matched in order", func(t *testing.T) {
+		verify := func(stepNumber int, output string) StatefulCodeBlock {
+			return StatefulCodeBlock{StepName: "Verify", StepNumber: stepNumber, StdOut: output, Success: true}
+		}
+		before := BuildReport("Deploy an app")
+		before.WithCodeBlocks([]StatefulCodeBlock{verify(0, "first\n"), verify(2, "second\n")})
+		after := BuildReport("Deploy an app")
+		after.WithCodeBlocks([]StatefulCodeBlock{
+			verify(0, "first\n"),
+			{StepName: "Added", StepNumber: 1, Success: true},
+			verify(2, "changed\n"),
+			verify(3, "third\n"),
+		})
+
+		diff := DiffReports(&before, &after)
+
+		var changes []string
+		for _, block := range diff.CodeBlocks {
+			changes = append(changes, fmt.Sprintf("%s %d: %s", block.StepName, block.StepNumber, block.Change))
+		}
+		assert.Equal(t, []string{"Added 1: added", "Verify 2: changed", "Verify 3: added"}, changes)
+		assert.Contains(t, diff.CodeBlocks[1].OutputDiff, "second")
+	})
+}
@@ -2,19 +2,61 @@ package common
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"regexp"
+	"sort"
 
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+)
+
+// The formats that reports can be written in.
+const (
+	ReportFormatJSON  = "json"
+	ReportFormatJUnit = "junit"
+	ReportFormatHTML  = "html"
+)
+
+// Checks if the format is one that reports can be written in.
+func IsValidReportFormat(format string) bool {
+	switch format {
+	case ReportFormatJSON, ReportFormatJUnit, ReportFormatHTML:
+		return true
+	}
+	return false
+}
+
+// The version of the schema that reports follow, see
+// docs/specs/report.schema.json. The major version changes whenever a change
+// to the schema would break the tools reading reports.
+const ReportSchemaVersion = "1.0"
+
+// The version and commit of ie, stamped into every report. Set by the CLI from
+// the values given to the build.
+var (
+	IEVersion = "dev"
+	IECommit  = "N/A"
 )
 
 type Report struct {
+	SchemaVersion        string                 `json:"schemaVersion"`
+	IEVersion            string                 `json:"ieVersion"`
+	IECommit             string                 `json:"ieCommit"`
 	Name                 string                 `json:"name"`
 	Properties           map[string]interface{} `json:"properties"`
 	EnvironmentVariables map[string]string      `json:"environmentVariables"`
 	Success              bool                   `json:"success"`
 	Error                string                 `json:"error"`
-	FailedAtStep         int                    `json:"failedAtStep"`
-	CodeBlocks           []StatefulCodeBlock    `json:"steps"`
+	// The step and code block that failed, starting at 0, or -1 if no code
+	// block failed.
+	FailedAtStep      int                 `json:"failedAtStep"`
+	FailedAtCodeBlock int                 `json:"failedAtCodeBlock"`
+	Seed              int64               `json:"seed"`
+	CodeBlocks        []StatefulCodeBlock `json:"steps"`
+	// The processes started by background code blocks, stopped once the
+	// scenario ended.
+	BackgroundProcesses []BackgroundProcess `json:"backgroundProcesses,omitempty"`
 }
 
 func (report *Report) WithProperties(properties map[string]interface{}) *Report {
@@ -23,12 +65,37 @@ func (report *Report) WithProperties(properties map[string]interface{}) *Report
 }
 
 func (report *Report) WithEnvironmentVariables(envVars map[string]string) *Report {
-	report.EnvironmentVariables = envVars
+	report.EnvironmentVariables = secrets.MaskVariables(envVars)
+	return report
+}
+
+func (report *Report) WithSeed(seed int64) *Report {
+	report.Seed = seed
 	return report
 }
 
+// Sets the code blocks of the report in the order they appear in the scenario,
+// along with the position of the code block that failed. The values of the
+// secret variables they assigned are masked.
 func (report *Report) WithCodeBlocks(codeBlocks []StatefulCodeBlock) *Report {
 	report.CodeBlocks = codeBlocks
+	report.CodeBlocks = report.sortedCodeBlocks()
+	for index, block := range report.CodeBlocks {
+		if block.Variables != nil {
+			report.CodeBlocks[index].Variables = secrets.MaskVariables(block.Variables)
+		}
+	}
+
+	report.FailedAtStep, report.FailedAtCodeBlock = -1, -1
+	if failed, ok := report.FailedCodeBlock(); ok {
+		report.FailedAtStep = failed.StepNumber
+		report.FailedAtCodeBlock = failed.CodeBlockNumber
+	}
+	return report
+}
+
+func (report *Report) WithBackgroundProcesses(processes []BackgroundProcess) *Report {
+	report.BackgroundProcesses = processes
 	return report
 }
 
@@ -42,12 +109,99 @@ func (report *Report) WithError(err error) *Report {
 	return report
 }
 
+// Gets a copy of the report with the secrets in it masked. Code blocks & errors
+// can contain secrets too, I.E. when a secret was passed in with --var and
+// rewritten into a code block. Masking has to happen before the report is
+// encoded, as encoding escapes characters that secrets may contain.
+func (report Report) Masked() Report {
+	masked := report
+	masked.Name = secrets.MaskString(report.Name)
+	masked.Error = secrets.MaskString(report.Error)
+	if report.EnvironmentVariables != nil {
+		masked.EnvironmentVariables = secrets.MaskVariables(report.EnvironmentVariables)
+	}
+
+	masked.CodeBlocks = append([]StatefulCodeBlock(nil), report.CodeBlocks...)
+	for index, block := range masked.CodeBlocks {
+		block.StepName = secrets.MaskString(block.StepName)
+		block.StdOut = secrets.MaskString(block.StdOut)
+		block.StdErr = secrets.MaskString(block.StdErr)
+		block.Error = secrets.MaskError(block.Error)
+		block.CodeBlock.Content = secrets.MaskString(block.CodeBlock.Content)
+		block.CodeBlock.Description = secrets.MaskString(block.CodeBlock.Description)
+		block.CodeBlock.ExpectedOutput.Content = secrets.MaskString(block.CodeBlock.ExpectedOutput.Content)
+		block.Captured = maskValues(block.Captured)
+		block.Variables = maskValues(block.Variables)
+		masked.CodeBlocks[index] = block
+	}
+
+	masked.BackgroundProcesses = append([]BackgroundProcess(nil), report.BackgroundProcesses...)
+	for index, process := range masked.BackgroundProcesses {
+		process.Logs = secrets.MaskString(process.Logs)
+		masked.BackgroundProcesses[index] = process
+	}
+	return masked
+}
+
+// Masks the secrets within each of the values.
+func maskValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(values))
+	for name, value := range values {
+		masked[name] = secrets.MaskString(value)
+	}
+	return masked
+}
+
+var ansiEscapeSequence = regexp.MustCompile(`\x1b\[[0-9;]*[a-zA-Z]`)
+
+// Removes the terminal colors from text and masks any secrets in it, so that
+// reports other than JSON ones can show it.
+func displayText(text string) string {
+	return secrets.MaskString(ansiEscapeSequence.ReplaceAllString(text, ""))
+}
+
+// Gets the code blocks of the report in the order they appear in the scenario.
+func (report *Report) sortedCodeBlocks() []StatefulCodeBlock {
+	codeBlocks := append([]StatefulCodeBlock{}, report.CodeBlocks...)
+	sort.SliceStable(codeBlocks, func(i, j int) bool {
+		if codeBlocks[i].StepNumber != codeBlocks[j].StepNumber {
+			return codeBlocks[i].StepNumber < codeBlocks[j].StepNumber
+		}
+		return codeBlocks[i].CodeBlockNumber < codeBlocks[j].CodeBlockNumber
+	})
+	return codeBlocks
+}
+
+// Gets the process started by a code block if it ran in the background.
+func (report *Report) backgroundProcess(block StatefulCodeBlock) (BackgroundProcess, bool) {
+	for _, process := range report.BackgroundProcesses {
+		if process.StepNumber == block.StepNumber && process.CodeBlockNumber == block.CodeBlockNumber {
+			return process, true
+		}
+	}
+	return BackgroundProcess{}, false
+}
+
+// Gets the code block the scenario failed at, if it failed at one.
+func (report *Report) FailedCodeBlock() (StatefulCodeBlock, bool) {
+	for _, block := range report.sortedCodeBlocks() {
+		if !block.Skipped && !block.Success && block.WasExecuted() {
+			return block, true
+		}
+	}
+	return StatefulCodeBlock{}, false
+}
+
 // TODO(vmarcella): Implement this to write the report to JSON.
 func (report *Report) WriteToJSONFile(outputPath string) error {
-	jsonReport, err := json.MarshalIndent(report, "", "    ")
+	jsonReport, err := json.MarshalIndent(report.Masked(), "", "    ")
 	if err != nil {
 		return err
 	}
+
 	logging.GlobalLogger.Infof("Generated the test report:\n %s", jsonReport)
 
 	file, err := os.Create(outputPath)
@@ -67,13 +221,31 @@ func (report *Report) WriteToJSONFile(outputPath string) error {
 	return nil
 }
 
+// Writes the report to a file in the given format.
+func (report *Report) WriteToFile(outputPath string, format string) error {
+	switch format {
+	case ReportFormatJSON, "":
+		return report.WriteToJSONFile(outputPath)
+	case ReportFormatJUnit:
+		return report.WriteToJUnitFile(outputPath)
+	case ReportFormatHTML:
+		return report.WriteToHTMLFile(outputPath)
+	default:
+		return fmt.Errorf("unknown report format '%s'", format)
+	}
+}
+
 func BuildReport(name string) Report {
 	return Report{
+		SchemaVersion:        ReportSchemaVersion,
+		IEVersion:            IEVersion,
+		IECommit:             IECommit,
 		Name:                 name,
 		Properties:           make(map[string]interface{}),
 		EnvironmentVariables: make(map[string]string),
 		Success:              true,
 		Error:                "",
 		FailedAtStep:         -1,
+		FailedAtCodeBlock:    -1,
 	}
 }
@@ -0,0 +1,296 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+const reportSchemaPath = "../../../docs/specs/report.schema.json"
+
+// Validates a JSON value against the subset of JSON Schema used by the report
+// schema: $ref, type, required, properties, additionalProperties, items,
+// minimum and pattern.
+func validateAgainstSchema(
+	root map[string]interface{},
+	schema map[string]interface{},
+	value interface{},
+	path string,
+) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		definition := root["$defs"].(map[string]interface{})[name].(map[string]interface{})
+		return validateAgainstSchema(root, definition, value, path)
+	}
+
+	var problems []string
+	if types, ok := schema["type"]; ok {
+		var allowed []string
+		switch types := types.(type) {
+		case string:
+			allowed = []string{types}
+		case []interface{}:
+			for _, t := range types {
+				allowed = append(allowed, t.(string))
+			}
+		}
+
+		matched := false
+		for _, t := range allowed {
+			if jsonType(value) == t || (t == "number" && jsonType(value) == "integer") {
+				matched = true
+			}
+		}
+		if !matched {
+			return []string{fmt.Sprintf("%s: expected %v, got %s", path, allowed, jsonType(value))}
+		}
+	}
+
+	if minimum, ok := schema["minimum"].(float64); ok {
+		if number, ok := value.(float64); ok && number < minimum {
+			problems = append(problems, fmt.Sprintf("%s: %v is less than %v", path, number, minimum))
+		}
+	}
+
+	if pattern, ok := schema["pattern"].(string); ok {
+		if text, ok := value.(string); ok && !regexp.MustCompile(pattern).MatchString(text) {
+			problems = append(problems, fmt.Sprintf("%s: '%s' doesn't match %s", path, text, pattern))
+		}
+	}
+
+	if object, ok := value.(map[string]interface{}); ok {
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing %s", path, name))
+				}
+			}
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		var names []string
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			propertyPath := path + "." + name
+			if property, ok := properties[name]; ok {
+				problems = append(problems, validateAgainstSchema(
+					root, property.(map[string]interface{}), object[name], propertyPath,
+				)...)
+				continue
+			}
+
+			switch additional := schema["additionalProperties"].(type) {
+			case bool:
+				if !additional {
+					problems = append(problems, fmt.Sprintf("%s: unexpected property", propertyPath))
+				}
+			case map[string]interface{}:
+				problems = append(problems, validateAgainstSchema(
+					root, additional, object[name], propertyPath,
+				)...)
+			}
+		}
+	}
+
+	if array, ok := value.([]interface{}); ok {
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for index, item := range array {
+				problems = append(problems, validateAgainstSchema(
+					root, items, item, fmt.Sprintf("%s[%d]", path, index),
+				)...)
+			}
+		}
+	}
+
+	return problems
+}
+
+func jsonType(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if value == float64(int64(value)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func TestReportSchema(t *testing.T) {
+	contents, err := os.ReadFile(reportSchemaPath)
+	assert.NoError(t, err)
+
+	var schema map[string]interface{}
+	assert.NoError(t, json.Unmarshal(contents, &schema))
+
+	validate := func(t *testing.T, report Report) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		assert.NoError(t, report.WriteToJSONFile(path))
+
+		contents, err := os.ReadFile(path)
+		assert.NoError(t, err)
+
+		var value interface{}
+		assert.NoError(t, json.Unmarshal(contents, &value))
+		assert.Empty(t, validateAgainstSchema(schema, schema, value, "$"))
+	}
+
+	t.Run("Reports of failed scenarios match the schema", func(t *testing.T) {
+		report := BuildReport("Deploy an app")
+		report.
+			WithSeed(42).
+			WithProperties(map[string]interface{}{"ms.author": "someone"}).
+			WithEnvironmentVariables(map[string]string{"RESOURCE_GROUP": "rg-1a2b3c"}).
+			WithError(errors.New("failed to execute code block 0 on step 1.")).
+			WithCodeBlocks([]StatefulCodeBlock{
+				{
+					StepName:        "Verify",
+					StepNumber:      1,
+					StdOut:          "goodbye\n",
+					Error:           errors.New("Expected output does not match actual output."),
+					DurationSeconds: 0.25,
+					CodeBlock: parsers.CodeBlock{
+						Language:   "bash",
+						Content:    "echo goodbye",
+						Attributes: map[string]string{"tags": "slow"},
+						Tags:       []string{"slow"},
+						ExpectedOutput: parsers.ExpectedOutputBlock{
+							ExpectedRegex: regexp.MustCompile("^hello"),
+						},
+					},
+				},
+				{
+					StepName:   "Create",
+					StepNumber: 0,
+					Success:    true,
+					StdOut:     "{\"publicIpAddress\": \"10.0.0.4\"}\n",
+					Captured:   map[string]string{"VM_IP": "10.0.0.4"},
+					CodeBlock: parsers.CodeBlock{
+						Language: "bash",
+						Content:  "az vm create",
+						Captures: []parsers.Capture{{Variable: "VM_IP", Expression: "$.publicIpAddress"}},
+					},
+				},
+			}).
+			WithBackgroundProcesses([]BackgroundProcess{
+				{StepNumber: 0, CodeBlockNumber: 0, PID: 4242, LogFile: "/tmp/ie-1-1.log", Logs: "serving\n"},
+			})
+
+		validate(t, report)
+	})
+
+	t.Run("Reports of scenarios that never ran match the schema", func(t *testing.T) {
+		validate(t, BuildReport("Empty"))
+	})
+
+	t.Run("Invalid reports don't match the schema", func(t *testing.T) {
+		problems := validateAgainstSchema(schema, schema, map[string]interface{}{
+			"schemaVersion": "2.0",
+			"failedAtStep":  float64(-2),
+			"steps":         []interface{}{map[string]interface{}{"error": map[string]interface{}{}}},
+		}, "$")
+
+		assert.Contains(t, problems, "$: missing name")
+		assert.Contains(t, problems, "$.failedAtStep: -2 is less than -1")
+		assert.Contains(t, problems, "$.schemaVersion: '2.0' doesn't match ^1\\.[0-9]+$")
+		assert.Contains(t, problems, "$.steps[0].error: expected [string null], got object")
+	})
+}
+
+func TestReportFailurePositions(t *testing.T) {
+	t.Run("Code blocks are sorted and the failure is recorded", func(t *testing.T) {
+		report := BuildReport("Scenario")
+		report.WithCodeBlocks([]StatefulCodeBlock{
+			{StepNumber: 2, CodeBlockNumber: 0},
+			{StepNumber: 1, CodeBlockNumber: 1, Error: errors.New("failed")},
+			{StepNumber: 1, CodeBlockNumber: 0, Success: true},
+			{StepNumber: 0, CodeBlockNumber: 0, Success: true},
+		})
+
+		var positions []string
+		for _, block := range report.CodeBlocks {
+			positions = append(positions, fmt.Sprintf("%d.%d", block.StepNumber, block.CodeBlockNumber))
+		}
+		assert.Equal(t, []string{"0.0", "1.0", "1.1", "2.0"}, positions)
+		assert.Equal(t, 1, report.FailedAtStep)
+		assert.Equal(t, 1, report.FailedAtCodeBlock)
+	})
+
+	t.Run("Successful scenarios don't record a failure", func(t *testing.T) {
+		report := BuildReport("Scenario")
+		report.WithCodeBlocks([]StatefulCodeBlock{{Success: true}})
+
+		assert.Equal(t, -1, report.FailedAtStep)
+		assert.Equal(t, -1, report.FailedAtCodeBlock)
+		assert.Equal(t, ReportSchemaVersion, report.SchemaVersion)
+	})
+
+	t.Run("Reports from newer versions of the schema can't be loaded", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.json")
+		assert.NoError(t, os.WriteFile(path, []byte(`{"schemaVersion": "2.0", "name": "Future"}`), 0644))
+
+		_, _, err := LoadReport(path)
+		assert.ErrorContains(t, err, "version 2.0 of the report schema")
+	})
+}
+
+func TestWritingJSONReports(t *testing.T) {
+	t.Run("Secrets are masked even when JSON escapes them", func(t *testing.T) {
+		secret := `Pa<ss>&"word\`
+		secrets.Register(secret)
+
+		report := BuildReport("Scenario")
+		report.
+			WithEnvironmentVariables(map[string]string{"LOGIN": "admin:" + secret}).
+			WithError(errors.New("failed with " + secret)).
+			WithCodeBlocks([]StatefulCodeBlock{{
+				StdOut:    "logged in with " + secret + "\n",
+				StdErr:    secret,
+				Error:     errors.New("rejected " + secret),
+				CodeBlock: parsers.CodeBlock{Content: "login '" + secret + "'"},
+			}})
+
+		path := filepath.Join(t.TempDir(), "report.json")
+		assert.NoError(t, report.WriteToJSONFile(path))
+
+		contents, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		assert.True(t, json.Valid(contents))
+		escaped, _ := json.Marshal(secret)
+		assert.NotContains(t, string(contents), strings.Trim(string(escaped), `"`))
+		assert.NotContains(t, string(contents), "Pa\\u003css")
+
+		loaded, _, err := LoadReport(path)
+		assert.NoError(t, err)
+		assert.Equal(t, "failed with "+secrets.Mask, loaded.Error)
+		assert.Equal(t, "admin:"+secrets.Mask, loaded.EnvironmentVariables["LOGIN"])
+		assert.Equal(t, "logged in with "+secrets.Mask+"\n", loaded.CodeBlocks[0].StdOut)
+		assert.Equal(t, secrets.Mask, loaded.CodeBlocks[0].StdErr)
+		assert.EqualError(t, loaded.CodeBlocks[0].Error, "rejected "+secrets.Mask)
+		assert.Equal(t, "login '"+secrets.Mask+"'", loaded.CodeBlocks[0].CodeBlock.Content)
+	})
+}
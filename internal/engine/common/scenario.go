@@ -3,16 +3,20 @@ package common
 import (
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/lib/fs"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/parsers"
-	"github.com/Azure/InnovationEngine/internal/patterns"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/yuin/goldmark/ast"
 )
 
@@ -24,12 +28,20 @@ type Step struct {
 
 // Scenarios are the top-level object that represents a scenario to be executed.
 type Scenario struct {
-	Name        string
+	Name string
+	// The path or URL of the markdown the scenario was created from.
+	Path        string
 	MarkdownAst ast.Node
 	Steps       []Step
 	Properties  map[string]interface{}
 	Environment map[string]string
-	Source      []byte
+	// Where the value of each variable inside of Environment came from.
+	VariableSources map[string]string
+	// The seed used for the values generated within the variables block, along
+	// with the names of the variables that use them.
+	Seed               int64
+	GeneratedVariables []string
+	Source             []byte
 }
 
 // Get the markdown source for the scenario as a string.
@@ -75,58 +87,363 @@ func downloadScenarioMarkdown(url string) ([]byte, error) {
 	return body, nil
 }
 
+// Checks if a path points to a file served over http(s).
+func isRemotePath(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// Given either a local or remote path to a file, resolve the path and return
+// the contents of the file. kind describes the file in error messages.
+func resolveSource(path string, kind string) ([]byte, error) {
+	if isRemotePath(path) {
+		return downloadScenarioMarkdown(path)
+	}
+
+	if !fs.FileExists(path) {
+		return nil, fmt.Errorf("%s file '%s' does not exist", kind, path)
+	}
+
+	return os.ReadFile(path)
+}
+
 // Given either a local or remote path to a markdown file, resolve the path to
 // the markdown file and return the contents of the file.
 func resolveMarkdownSource(path string) ([]byte, error) {
-	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
-		return downloadScenarioMarkdown(path)
+	return resolveSource(path, "markdown")
+}
+
+// Resolves a path that is relative to the markdown file of a scenario. Remote
+// markdown files resolve relative paths against their URL.
+func resolvePathRelativeToMarkdown(markdownPath string, path string) (string, error) {
+	if isRemotePath(path) || filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	if isRemotePath(markdownPath) {
+		base, err := url.Parse(markdownPath)
+		if err != nil {
+			return "", err
+		}
+
+		reference, err := url.Parse(path)
+		if err != nil {
+			return "", err
+		}
+
+		return base.ResolveReference(reference).String(), nil
+	}
+
+	return filepath.Join(filepath.Dir(markdownPath), path), nil
+}
+
+// A set of variables that were all loaded from the same source.
+type variableLayer struct {
+	source    string
+	variables map[string]string
+}
+
+// Builds the variable layers for the contents of an INI file. When a profile
+// is provided, the default section is loaded first and the section matching
+// the profile (if the file declares it) is layered on top of it. Without a
+// profile, every section is flattened into a single layer. Also returns the
+// profiles declared by the file.
+func buildINILayers(
+	path string,
+	contents []byte,
+	profile string,
+) ([]variableLayer, []string, error) {
+	sections, err := parsers.ParseINISections(contents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the INI file '%s': %w", path, err)
 	}
 
+	profiles := parsers.INIProfileNames(sections)
+
+	if profile == "" {
+		if len(profiles) > 0 {
+			logging.GlobalLogger.Warnf(
+				"INI file '%s' declares the profiles %v but none was selected. Values from every section will be merged, use --profile to select one.",
+				path,
+				profiles,
+			)
+		}
+
+		variables, err := parsers.ParseINI(contents)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return []variableLayer{{source: path, variables: variables}}, profiles, nil
+	}
+
+	layers := []variableLayer{
+		{
+			source:    fmt.Sprintf("%s [%s]", path, parsers.DefaultINISection),
+			variables: sections[parsers.DefaultINISection],
+		},
+	}
+
+	if _, ok := sections[profile]; ok {
+		layers = append(layers, variableLayer{
+			source:    fmt.Sprintf("%s [%s]", path, profile),
+			variables: sections[profile],
+		})
+	} else {
+		logging.GlobalLogger.Infof(
+			"INI file '%s' doesn't declare the profile '%s', only loading the [%s] section",
+			path,
+			profile,
+			parsers.DefaultINISection,
+		)
+	}
+
+	return layers, profiles, nil
+}
+
+// Loads the variables declared in the INI file that shares the base name of the
+// markdown file. Also returns the profiles declared by the file.
+func loadINIVariables(path string, profile string) ([]variableLayer, []string, error) {
 	if !fs.FileExists(path) {
-		return nil, fmt.Errorf("markdown file '%s' does not exist", path)
+		logging.GlobalLogger.Infof("INI file '%s' does not exist, skipping...", path)
+		return nil, nil, nil
 	}
 
-	return os.ReadFile(path)
+	logging.GlobalLogger.Infof("INI file '%s' exists, loading...", path)
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return buildINILayers(path, contents, profile)
+}
+
+// Loads the variables declared in an env file. Files with the .ini extension
+// are parsed as INI files and every other file is parsed as a dotenv file.
+// Also returns the profiles declared by the file.
+func loadEnvFile(path string, profile string) ([]variableLayer, []string, error) {
+	contents, err := resolveSource(path, "env")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logging.GlobalLogger.Infof("Loading variables from the env file '%s'", path)
+
+	if strings.EqualFold(filepath.Ext(path), ".ini") {
+		return buildINILayers(path, contents, profile)
+	}
+
+	variables, err := parsers.ParseDotEnv(contents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the env file '%s': %w", path, err)
+	}
+
+	return []variableLayer{{source: path, variables: variables}}, nil, nil
+}
+
+// The frontmatter property that lists the env files to load by default for a
+// scenario. Paths are relative to the markdown file of the scenario.
+const envFilesProperty = "envFiles"
+
+// The source of the variables declared by the variables block of the markdown.
+const scenarioVariablesSource = "markdown variables block"
+
+// The name of scenarios without a title that weren't read from a file.
+const untitledScenario = "Untitled scenario"
+
+// The frontmatter property that lists the variables to treat as secrets for a
+// scenario, in addition to the ones detected by name or value.
+const secretsProperty = "secrets"
+
+// Extracts a list of strings declared in the frontmatter of a scenario. The
+// property can either be a single string or a list of strings.
+func extractStringListFromProperties(
+	properties map[string]interface{},
+	property string,
+) ([]string, error) {
+	switch value := properties[property].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{value}, nil
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			text, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf(
+					"the '%s' property must only contain strings, found %v",
+					property,
+					item,
+				)
+			}
+			items = append(items, text)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf(
+			"the '%s' property must be a string or a list of strings, found %v",
+			property,
+			value,
+		)
+	}
 }
 
 // Creates a scenario object from a given markdown file. languagesToExecute is
 // used to filter out code blocks that should not be parsed out of the markdown
-// file.
+// file. Variables are layered in the following order, with later layers
+// overriding earlier ones:
+//
+//  1. The [DEFAULT] section of the INI file paired with the markdown file.
+//  2. The section of the INI file matching the profile (if one is provided).
+//  3. The env files listed by the `envFiles` frontmatter property, in order.
+//     INI env files are layered the same way as the paired INI file.
+//  4. The variables block declared within the markdown file.
+//  5. The envFiles (I.E. --env-file), in order.
+//  6. The environmentVariableOverrides (I.E. --var).
+//
+// Value generators within the variables block (I.E. {{ uuid }}) draw from the
+// seed, so the same seed always produces the same values.
 func CreateScenarioFromMarkdown(
 	path string,
 	languagesToExecute []string,
 	environmentVariableOverrides map[string]string,
+	profile string,
+	envFiles []string,
+	seed int64,
 ) (*Scenario, error) {
 	source, err := resolveMarkdownSource(path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Load environment variables
-	markdownINI := strings.TrimSuffix(path, filepath.Ext(path)) + ".ini"
-	environmentVariables := make(map[string]string)
+	return CreateScenarioFromSource(
+		path,
+		source,
+		languagesToExecute,
+		environmentVariableOverrides,
+		profile,
+		envFiles,
+		seed,
+	)
+}
 
-	// Check if the INI file exists & load it.
-	if !fs.FileExists(markdownINI) {
-		logging.GlobalLogger.Infof("INI file '%s' does not exist, skipping...", markdownINI)
-	} else {
-		logging.GlobalLogger.Infof("INI file '%s' exists, loading...", markdownINI)
-		environmentVariables, err = parsers.ParseINIFile(markdownINI)
+// Creates a scenario object from markdown that was already read, the same way
+// CreateScenarioFromMarkdown does. The path is only used to find the INI file
+// paired with the markdown and to resolve the env files it lists, and may be
+// empty when the markdown didn't come from a file.
+func CreateScenarioFromSource(
+	path string,
+	source []byte,
+	languagesToExecute []string,
+	environmentVariableOverrides map[string]string,
+	profile string,
+	envFiles []string,
+	seed int64,
+) (*Scenario, error) {
+	// Load environment variables
+	var layers []variableLayer
+	var profiles []string
+	if path != "" {
+		markdownINI := strings.TrimSuffix(path, filepath.Ext(path)) + ".ini"
+		var err error
+		layers, profiles, err = loadINIVariables(markdownINI, profile)
 		if err != nil {
 			return nil, err
 		}
-
-		for key, value := range environmentVariables {
-			logging.GlobalLogger.Debugf("Setting %s=%s\n", key, value)
-		}
 	}
 
 	// Convert the markdonw into an AST and extract the scenario variables.
 	markdown := parsers.ParseMarkdownIntoAst(source)
 	properties := parsers.ExtractYamlMetadataFromAst(markdown)
 	scenarioVariables := parsers.ExtractScenarioVariablesFromAst(markdown, source)
-	for key, value := range scenarioVariables {
-		environmentVariables[key] = value
+
+	secretVariables, err := extractStringListFromProperties(properties, secretsProperty)
+	if err != nil {
+		return nil, err
+	}
+	secrets.MarkAsSecret(secretVariables...)
+
+	generatedVariables, err := generateScenarioVariables(scenarioVariables, seed)
+	if err != nil {
+		return nil, err
+	}
+
+	strict, err := extractStrictModeFromProperties(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	defaultEnvFiles, err := extractStringListFromProperties(properties, envFilesProperty)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, envFile := range defaultEnvFiles {
+		envFilePath, err := resolvePathRelativeToMarkdown(path, envFile)
+		if err != nil {
+			return nil, err
+		}
+
+		envFileLayers, envFileProfiles, err := loadEnvFile(envFilePath, profile)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, envFileLayers...)
+		profiles = append(profiles, envFileProfiles...)
+	}
+
+	layers = append(
+		layers,
+		variableLayer{source: scenarioVariablesSource, variables: scenarioVariables},
+	)
+
+	for _, envFile := range envFiles {
+		envFileLayers, envFileProfiles, err := loadEnvFile(envFile, profile)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, envFileLayers...)
+		profiles = append(profiles, envFileProfiles...)
+	}
+
+	if profile != "" && !lib.SliceContains(profiles, profile) {
+		return nil, fmt.Errorf(
+			"the profile '%s' is not declared by any of the INI files loaded for the scenario. Available profiles: %v",
+			profile,
+			profiles,
+		)
+	}
+
+	layers = append(
+		layers,
+		variableLayer{source: "--var", variables: environmentVariableOverrides},
+	)
+
+	// Register secrets before anything logs the values of the variables.
+	for _, layer := range layers {
+		secrets.RegisterVariables(layer.variables)
+	}
+
+	environmentVariables := make(map[string]string)
+	variableSources := make(map[string]string)
+	for _, layer := range layers {
+		for key, value := range layer.variables {
+			logging.GlobalLogger.Debugf("Setting %s=%s from %s", key, value, layer.source)
+			environmentVariables[key] = value
+			variableSources[key] = layer.source
+		}
+	}
+
+	for _, key := range sortedKeys(variableSources) {
+		logging.GlobalLogger.Infof("Variable %s was set by %s", key, variableSources[key])
+	}
+
+	// Generated values that were overridden by a later layer aren't used.
+	var usedGeneratedVariables []string
+	for _, key := range generatedVariables {
+		if variableSources[key] == scenarioVariablesSource {
+			usedGeneratedVariables = append(usedGeneratedVariables, key)
+		}
 	}
 
 	// Extract the code blocks from the markdown file.
@@ -134,38 +451,29 @@ func CreateScenarioFromMarkdown(
 	logging.GlobalLogger.WithField("CodeBlocks", codeBlocks).
 		Debugf("Found %d code blocks", len(codeBlocks))
 
+	// Mistakes in the wait and strict attributes and captures are reported
+	// before anything runs.
+	for _, block := range codeBlocks {
+		if _, err := ParseWait(block); err != nil {
+			return nil, err
+		}
+		if err := validateStrictAttribute(block); err != nil {
+			return nil, err
+		}
+		if err := ValidateCaptures(block); err != nil {
+			return nil, err
+		}
+	}
+
 	varsToExport := lib.CopyMap(environmentVariableOverrides)
-	for key, value := range environmentVariableOverrides {
-		environmentVariables[key] = value
+	for _, key := range sortedKeys(environmentVariableOverrides) {
+		value := environmentVariableOverrides[key]
 		logging.GlobalLogger.Debugf("Attempting to override %s with %s", key, value)
-		exportRegex := patterns.ExportVariableRegex(key)
-
-		for index, codeBlock := range codeBlocks {
-			matches := exportRegex.FindAllStringSubmatch(codeBlock.Content, -1)
-
-			if len(matches) != 0 {
-				logging.GlobalLogger.Debugf(
-					"Found %d matches for %s, deleting from varsToExport",
-					len(matches),
-					key,
-				)
-				delete(varsToExport, key)
-			} else {
-				logging.GlobalLogger.Debugf("Found no matches for %s inside of %s", key, codeBlock.Content)
-			}
-
-			for _, match := range matches {
-				oldLine := match[0]
-				oldValue := match[1]
-
-				// Replace the old export with the new export statement
-				newLine := strings.Replace(oldLine, oldValue, value+" ", 1)
-				logging.GlobalLogger.Debugf("Replacing '%s' with '%s'", oldLine, newLine)
-
-				// Update the code block with the new export statement
-				codeBlocks[index].Content = strings.Replace(codeBlock.Content, oldLine, newLine, 1)
-			}
 
+		if overrideVariableAssignments(codeBlocks, key, value) {
+			delete(varsToExport, key)
+		} else {
+			logging.GlobalLogger.Debugf("Found no definition of %s inside of the code blocks", key)
 		}
 	}
 
@@ -184,7 +492,7 @@ func CreateScenarioFromMarkdown(
 			ExpectedOutput: parsers.ExpectedOutputBlock{},
 		}
 		for key, value := range varsToExport {
-			exportCodeBlock.Content += fmt.Sprintf("export %s=\"%s\"\n", key, value)
+			exportCodeBlock.Content += fmt.Sprintf("export %s=%s\n", key, parsers.QuoteBashValue(value))
 		}
 
 		codeBlocks = append([]parsers.CodeBlock{exportCodeBlock}, codeBlocks...)
@@ -202,34 +510,163 @@ func CreateScenarioFromMarkdown(
 			err,
 		)
 		title = filepath.Base(path)
+		if path == "" {
+			title = untitledScenario
+		}
 	}
 
 	logging.GlobalLogger.Infof("Successfully built out the scenario: %s", title)
 
-	return &Scenario{
-		Name:        title,
-		Environment: environmentVariables,
-		Steps:       steps,
-		Properties:  properties,
-		MarkdownAst: markdown,
-		Source:      source,
-	}, nil
+	scenario := &Scenario{
+		Name:               title,
+		Path:               path,
+		Environment:        environmentVariables,
+		VariableSources:    variableSources,
+		Seed:               seed,
+		GeneratedVariables: usedGeneratedVariables,
+		Steps:              steps,
+		Properties:         properties,
+		MarkdownAst:        markdown,
+		Source:             source,
+	}
+	if strict {
+		scenario.EnableStrictMode()
+	}
+	return scenario, nil
 }
 
-// Convert a scenario into a shell script
-func (s *Scenario) ToShellScript() string {
+// Expands the value generators used by the scenario variables in place.
+// Variables are expanded in alphabetical order so that each one draws the
+// same values from the seed regardless of map ordering. Returns the names of
+// the variables that used a generator.
+func generateScenarioVariables(variables map[string]string, seed int64) ([]string, error) {
+	random := rand.New(rand.NewSource(seed))
+	var generated []string
+
+	for _, key := range sortedKeys(variables) {
+		if !lib.HasValueGenerators(variables[key]) {
+			continue
+		}
+
+		value, err := lib.ExpandValueGenerators(variables[key], random)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate a value for %s: %w", key, err)
+		}
+
+		// Generated passwords are always secret, whatever the variable is named.
+		if lib.HasPasswordGenerator(variables[key]) {
+			secrets.MarkAsSecret(key)
+		}
+		secrets.RegisterVariables(map[string]string{key: value})
+
+		logging.GlobalLogger.Infof("Generated %s=%s using the seed %d", key, value, seed)
+		variables[key] = value
+		generated = append(generated, key)
+	}
+
+	return generated, nil
+}
+
+// Returns the keys of a map sorted alphabetically.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Convert a scenario into a shell script. Code blocks in languages whose
+// interpreter isn't a shell are run with their interpreter, found in
+// interpreters first and then in the default ones.
+func (s *Scenario) ToShellScript(interpreters map[string]shells.Interpreter) string {
 	var script strings.Builder
 
 	for key, value := range s.Environment {
 		script.WriteString(fmt.Sprintf("export %s=\"%s\"\n", key, value))
 	}
 
+	executor := shells.BashExecutor{Interpreters: interpreters}
 	for _, step := range s.Steps {
 		script.WriteString(fmt.Sprintf("# %s\n", step.Name))
 		for _, block := range step.CodeBlocks {
-			script.WriteString(fmt.Sprintf("%s\n", block.Content))
+			content := block.Content
+			if interpreter := executor.Interpreter(block.Language); !interpreter.Shell {
+				content = interpreter.CommandLine(content)
+			}
+			script.WriteString(fmt.Sprintf("%s\n", content))
 		}
 	}
 
 	return script.String()
 }
+
+// Whether a code block holds shell commands, whose variable assignments can be
+// found and rewritten. Code blocks written to files, terraform configuration
+// and code blocks run by interpreters that aren't shells, like python, don't.
+func holdsShellCommands(executor shells.Executor, block parsers.CodeBlock) bool {
+	if block.File() != "" || IsTerraformConfiguration(block) {
+		return false
+	}
+	return shells.FindInterpreter(executor, block.Language).Shell
+}
+
+// Rewrites the statements that define a variable within the shell code blocks
+// so that they assign the overridden value instead. The first definition of the
+// variable is always rewritten, whichever form it takes. Later definitions are
+// rewritten as well unless they derive their value from the variable itself,
+// as they would otherwise discard the override. Returns whether or not the
+// variable was defined in any of the code blocks.
+func overrideVariableAssignments(codeBlocks []parsers.CodeBlock, key string, value string) bool {
+	defined := false
+
+	for index := range codeBlocks {
+		if !holdsShellCommands(shells.BashExecutor{}, codeBlocks[index]) {
+			continue
+		}
+		content := codeBlocks[index].Content
+
+		var assignmentsToRewrite []parsers.BashAssignment
+		for _, assignment := range parsers.FindBashAssignments(content) {
+			if assignment.Name != key {
+				continue
+			}
+
+			if defined && assignment.IsSelfReferencing() {
+				logging.GlobalLogger.Debugf(
+					"Keeping `%s` as it derives %s from its overridden value",
+					assignment.Statement(content),
+					key,
+				)
+				continue
+			}
+
+			assignmentsToRewrite = append(assignmentsToRewrite, assignment)
+			defined = true
+		}
+
+		// Rewrite from the end of the block so that the offsets of the
+		// remaining assignments stay valid.
+		for i := len(assignmentsToRewrite) - 1; i >= 0; i-- {
+			assignment := assignmentsToRewrite[i]
+			rewritten := parsers.RewriteBashAssignment(content, assignment, value)
+			newStatementEnd := assignment.StatementEnd + len(rewritten) - len(content)
+
+			logging.GlobalLogger.Infof(
+				"Overriding %s in the code block under '%s' (line %d): replaced `%s` with `%s`",
+				key,
+				codeBlocks[index].Header,
+				assignment.Line(content),
+				assignment.Statement(content),
+				rewritten[assignment.StatementStart:newStatementEnd],
+			)
+
+			content = rewritten
+		}
+
+		codeBlocks[index].Content = content
+	}
+
+	return defined
+}
@@ -9,6 +9,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -99,7 +102,7 @@ func TestScenarioParsing(t *testing.T) {
 
 		path := temporaryFile.Name()
 
-		scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil)
+		scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil, "", nil, 0)
 
 		assert.NoError(t, err)
 		fmt.Println(scenario)
@@ -124,12 +127,31 @@ func TestScenarioParsing(t *testing.T) {
 
 		path := temporaryFile.Name()
 
-		scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil)
+		scenario, err := CreateScenarioFromMarkdown(path, []string{"bash"}, nil, "", nil, 0)
 
 		assert.NoError(t, err)
 		fmt.Println(scenario)
 		assert.Equal(t, "Scenario-title", scenario.Name)
 	})
+
+	t.Run("Parse scenario from markdown that wasn't read from a file", func(t *testing.T) {
+		content := "# Scenario-title\n\n```bash\necho hello\n```\n"
+
+		scenario, err := CreateScenarioFromSource("", []byte(content), []string{"bash"}, nil, "", nil, 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Scenario-title", scenario.Name)
+		assert.Equal(t, "", scenario.Path)
+		assert.Len(t, scenario.Steps, 1)
+		assert.Equal(t, "echo hello\n", scenario.Steps[0].CodeBlocks[0].Content)
+	})
+
+	t.Run("Parse untitled scenario that wasn't read from a file", func(t *testing.T) {
+		scenario, err := CreateScenarioFromSource("", []byte("No title"), []string{"bash"}, nil, "", nil, 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, untitledScenario, scenario.Name)
+	})
 }
 
 func TestVariableOverrides(t *testing.T) {
@@ -142,6 +164,9 @@ func TestVariableOverrides(t *testing.T) {
 			map[string]string{
 				"MY_VAR": "my_value",
 			},
+			"",
+			nil,
+			0,
 		)
 
 		assert.NoError(t, err)
@@ -158,6 +183,9 @@ func TestVariableOverrides(t *testing.T) {
 				map[string]string{
 					"NEXT_VAR": "next_value",
 				},
+				"",
+				nil,
+				0,
 			)
 
 			assert.NoError(t, err)
@@ -180,6 +208,9 @@ func TestVariableOverrides(t *testing.T) {
 					"THIS_VAR": "this_value",
 					"THAT_VAR": "that_value",
 				},
+				"",
+				nil,
+				0,
 			)
 
 			assert.NoError(t, err)
@@ -188,7 +219,7 @@ func TestVariableOverrides(t *testing.T) {
 			assert.Contains(
 				t,
 				scenario.Steps[2].CodeBlocks[0].Content,
-				`export THIS_VAR=this_value ; export THAT_VAR=that_value`,
+				`export THIS_VAR=this_value; export THAT_VAR=that_value`,
 			)
 		})
 
@@ -199,6 +230,9 @@ func TestVariableOverrides(t *testing.T) {
 			map[string]string{
 				"SUBSHELL_VARIABLE": "subshell_value",
 			},
+			"",
+			nil,
+			0,
 		)
 
 		assert.NoError(t, err)
@@ -217,6 +251,9 @@ func TestVariableOverrides(t *testing.T) {
 			map[string]string{
 				"VAR2": "var2_value",
 			},
+			"",
+			nil,
+			0,
 		)
 
 		assert.NoError(t, err)
@@ -227,4 +264,334 @@ func TestVariableOverrides(t *testing.T) {
 			`export VAR2=var2_value`,
 		)
 	})
+
+	t.Run("Override variables that aren't defined with export", func(t *testing.T) {
+		markdownPath := filepath.Join(t.TempDir(), "scenario.md")
+		markdown := "# Assignments\n\n```bash\n" +
+			"LOCATION=eastus\n" +
+			"declare -r GROUP=\"my group\"\n" +
+			"NAME=${NAME:-default-name}\n" +
+			"read -p \"Enter a region: \" REGION\n" +
+			"if [ -z \"$ZONE\" ]; then\n  ZONE=1\nfi\n" +
+			"ZONE=\"$ZONE-suffix\"\n" +
+			"```\n"
+		if err := os.WriteFile(markdownPath, []byte(markdown), 0644); err != nil {
+			t.Fatalf("Error writing markdown file: %v", err)
+		}
+
+		scenario, err := CreateScenarioFromMarkdown(
+			markdownPath,
+			[]string{"bash"},
+			map[string]string{
+				"LOCATION": "westus",
+				"GROUP":    "it's mine",
+				"NAME":     "override",
+				"REGION":   "westus2",
+				"ZONE":     "2",
+			},
+			"",
+			nil,
+			0,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(scenario.Steps))
+		assert.Equal(
+			t,
+			"LOCATION=westus\n"+
+				"declare -r GROUP='it'\\''s mine'\n"+
+				"NAME=override\n"+
+				"REGION=westus2\n"+
+				"if [ -z \"$ZONE\" ]; then\n  ZONE=2\nfi\n"+
+				"ZONE=\"$ZONE-suffix\"\n",
+			scenario.Steps[0].CodeBlocks[0].Content,
+		)
+	})
+
+	t.Run("Only the assignments of shell code blocks are overridden", func(t *testing.T) {
+		markdown := "# Languages\n\n" +
+			"```bash\nexport NAME=bash\n```\n\n" +
+			"```python\nNAME='python'\nCOUNT=1\n```\n\n" +
+			"```text {file=config.env}\nNAME=file\n```\n"
+
+		scenario, err := CreateScenarioFromSource(
+			"",
+			[]byte(markdown),
+			[]string{"bash", "python"},
+			map[string]string{"NAME": "override", "COUNT": "2"},
+			"",
+			nil,
+			0,
+		)
+
+		assert.NoError(t, err)
+		var contents []string
+		for _, step := range scenario.Steps {
+			for _, block := range step.CodeBlocks {
+				contents = append(contents, block.Content)
+			}
+		}
+		// COUNT is only assigned by python, so it's exported by a code block of
+		// its own instead.
+		assert.Equal(t, []string{
+			"export COUNT=2\n",
+			"export NAME=override\n",
+			"NAME='python'\nCOUNT=1\n",
+			"NAME=file\n",
+		}, contents)
+	})
+}
+
+func TestINIProfiles(t *testing.T) {
+	directory := t.TempDir()
+	markdownPath := filepath.Join(directory, "scenario.md")
+	iniPath := filepath.Join(directory, "scenario.ini")
+
+	markdown := "# Profiles\n\n```bash\necho $GROUP\n```\n"
+	ini := "LOCATION=eastus\nGROUP=default-group\n[dev]\nGROUP=dev-group\n[prod]\nGROUP=prod-group\nLOCATION=westus\n"
+
+	if err := os.WriteFile(markdownPath, []byte(markdown), 0644); err != nil {
+		t.Fatalf("Error writing markdown file: %v", err)
+	}
+	if err := os.WriteFile(iniPath, []byte(ini), 0644); err != nil {
+		t.Fatalf("Error writing INI file: %v", err)
+	}
+
+	t.Run("Selecting a profile layers it over the default section", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(markdownPath, []string{"bash"}, nil, "prod", nil, 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "prod-group", scenario.Environment["GROUP"])
+		assert.Equal(t, "westus", scenario.Environment["LOCATION"])
+		assert.Equal(t, iniPath+" [prod]", scenario.VariableSources["GROUP"])
+	})
+
+	t.Run("Values missing from a profile come from the default section", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(markdownPath, []string{"bash"}, nil, "dev", nil, 0)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "dev-group", scenario.Environment["GROUP"])
+		assert.Equal(t, "eastus", scenario.Environment["LOCATION"])
+		assert.Equal(t, iniPath+" [DEFAULT]", scenario.VariableSources["LOCATION"])
+	})
+
+	t.Run("CLI variables override the selected profile", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(
+			markdownPath,
+			[]string{"bash"},
+			map[string]string{"GROUP": "cli-group"},
+			"prod",
+			nil,
+			0,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "cli-group", scenario.Environment["GROUP"])
+		assert.Equal(t, "--var", scenario.VariableSources["GROUP"])
+		assert.Equal(t, "westus", scenario.Environment["LOCATION"])
+	})
+
+	t.Run("Selecting a profile that doesn't exist fails", func(t *testing.T) {
+		_, err := CreateScenarioFromMarkdown(markdownPath, []string{"bash"}, nil, "staging", nil, 0)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "[dev prod]")
+	})
+}
+
+func TestEnvFiles(t *testing.T) {
+	directory := t.TempDir()
+	markdownPath := filepath.Join(directory, "scenario.md")
+
+	markdown := `---
+envFiles: [defaults.env]
+---
+# Env files
+
+<!--
+` + "```variables" + `
+export FROM_BLOCK=block
+export SHARED=block
+` + "```" + `
+-->
+
+` + "```bash\necho $SHARED\n```\n"
+
+	files := map[string]string{
+		markdownPath:                             markdown,
+		filepath.Join(directory, "defaults.env"): "FROM_DEFAULTS=defaults\nSHARED=defaults\nFROM_BLOCK=defaults\n",
+		filepath.Join(directory, "first.env"):    "SHARED=first\nFROM_FIRST=first\n",
+		filepath.Join(directory, "second.ini"):   "SHARED=second\n[prod]\nSHARED=second-prod\n",
+	}
+
+	for path, contents := range files {
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Error writing %s: %v", path, err)
+		}
+	}
+
+	t.Run("Env files are layered in their documented order", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(
+			markdownPath,
+			[]string{"bash"},
+			nil,
+			"",
+			[]string{filepath.Join(directory, "first.env")},
+			0,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "defaults", scenario.Environment["FROM_DEFAULTS"])
+		assert.Equal(t, "block", scenario.Environment["FROM_BLOCK"])
+		assert.Equal(t, "first", scenario.Environment["FROM_FIRST"])
+		assert.Equal(t, "first", scenario.Environment["SHARED"])
+		assert.Equal(t, filepath.Join(directory, "defaults.env"), scenario.VariableSources["FROM_DEFAULTS"])
+	})
+
+	t.Run("Later env files and --var override earlier ones", func(t *testing.T) {
+		secondINI := filepath.Join(directory, "second.ini")
+		scenario, err := CreateScenarioFromMarkdown(
+			markdownPath,
+			[]string{"bash"},
+			map[string]string{"FROM_FIRST": "cli"},
+			"prod",
+			[]string{filepath.Join(directory, "first.env"), secondINI},
+			0,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "second-prod", scenario.Environment["SHARED"])
+		assert.Equal(t, secondINI+" [prod]", scenario.VariableSources["SHARED"])
+		assert.Equal(t, "cli", scenario.Environment["FROM_FIRST"])
+	})
+
+	t.Run("Missing env files fail", func(t *testing.T) {
+		_, err := CreateScenarioFromMarkdown(
+			markdownPath,
+			[]string{"bash"},
+			nil,
+			"",
+			[]string{filepath.Join(directory, "missing.env")},
+			0,
+		)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Default env files are resolved relative to remote scenarios", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/docs/scenario.md":
+				fmt.Fprint(w, "---\nenvFiles:\n  - config/remote.env\n---\n# Remote\n")
+			case "/docs/config/remote.env":
+				fmt.Fprint(w, "REMOTE=remote-value\n")
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+
+		scenario, err := CreateScenarioFromMarkdown(
+			server.URL+"/docs/scenario.md",
+			[]string{"bash"},
+			nil,
+			"",
+			nil,
+			0,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "remote-value", scenario.Environment["REMOTE"])
+		assert.Equal(t, server.URL+"/docs/config/remote.env", scenario.VariableSources["REMOTE"])
+	})
+}
+
+func TestGeneratedVariables(t *testing.T) {
+	markdownPath := filepath.Join(t.TempDir(), "scenario.md")
+	markdown := "# Generated\n\n<!--\n```variables\n" +
+		"export SUFFIX={{ random_suffix 8 }}\n" +
+		"export GROUP=rg-{{ random_suffix }}\n" +
+		"export ID={{ uuid }}\n" +
+		"export PLAIN=value\n" +
+		"```\n-->\n\n```bash\necho $GROUP\n```\n"
+	if err := os.WriteFile(markdownPath, []byte(markdown), 0644); err != nil {
+		t.Fatalf("Error writing markdown file: %v", err)
+	}
+
+	t.Run("The same seed generates the same values", func(t *testing.T) {
+		first, err := CreateScenarioFromMarkdown(markdownPath, []string{"bash"}, nil, "", nil, 42)
+		assert.NoError(t, err)
+		second, err := CreateScenarioFromMarkdown(markdownPath, []string{"bash"}, nil, "", nil, 42)
+		assert.NoError(t, err)
+		third, err := CreateScenarioFromMarkdown(markdownPath, []string{"bash"}, nil, "", nil, 7)
+		assert.NoError(t, err)
+
+		assert.Equal(t, first.Environment, second.Environment)
+		assert.NotEqual(t, first.Environment["GROUP"], third.Environment["GROUP"])
+		assert.Regexp(t, `^rg-[a-z0-9]{6}$`, first.Environment["GROUP"])
+		assert.Equal(t, "value", first.Environment["PLAIN"])
+		assert.Equal(t, int64(42), first.Seed)
+		assert.Equal(t, []string{"GROUP", "ID", "SUFFIX"}, first.GeneratedVariables)
+	})
+
+	t.Run("Overrides replace generated values", func(t *testing.T) {
+		scenario, err := CreateScenarioFromMarkdown(
+			markdownPath,
+			[]string{"bash"},
+			map[string]string{"GROUP": "my-group"},
+			"",
+			nil,
+			42,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "my-group", scenario.Environment["GROUP"])
+		assert.Equal(t, []string{"ID", "SUFFIX"}, scenario.GeneratedVariables)
+	})
+}
+
+func TestSecretVariables(t *testing.T) {
+	markdownPath := filepath.Join(t.TempDir(), "scenario.md")
+	markdown := "---\nsecrets:\n  - ADMIN_USER\n---\n# Secrets\n\n<!--\n```variables\n" +
+		"export ADMIN_USER=azure-admin\n" +
+		"export ADMIN_LOGIN={{ password 12 }}\n" +
+		"export LOCATION=eastus\n" +
+		"```\n-->\n\n```bash\necho $ADMIN_USER\n```\n"
+	if err := os.WriteFile(markdownPath, []byte(markdown), 0644); err != nil {
+		t.Fatalf("Error writing markdown file: %v", err)
+	}
+
+	scenario, err := CreateScenarioFromMarkdown(markdownPath, []string{"bash"}, nil, "", nil, 1)
+	assert.NoError(t, err)
+
+	t.Run("Variables marked in the frontmatter are masked", func(t *testing.T) {
+		assert.Equal(t, secrets.Mask, secrets.MaskString(scenario.Environment["ADMIN_USER"]))
+	})
+
+	t.Run("Generated passwords are masked", func(t *testing.T) {
+		assert.Equal(t, secrets.Mask, secrets.MaskString(scenario.Environment["ADMIN_LOGIN"]))
+	})
+
+	t.Run("Other variables are left alone", func(t *testing.T) {
+		assert.Equal(t, "eastus", secrets.MaskString(scenario.Environment["LOCATION"]))
+	})
+}
+
+func TestConvertingScenariosToShellScripts(t *testing.T) {
+	scenario := &Scenario{
+		Steps: []Step{{
+			Name: "Greet",
+			CodeBlocks: []parsers.CodeBlock{
+				{Language: "bash", Content: "echo hello"},
+				{Language: "python", Content: "print('hello')"},
+				{Language: "shout", Content: "hello"},
+			},
+		}},
+	}
+
+	script := scenario.ToShellScript(map[string]shells.Interpreter{
+		"shout": {Command: []string{"printf", "%s!"}},
+	})
+
+	assert.Equal(t, "# Greet\necho hello\npython3 -c 'print('\\''hello'\\'')'\nprintf '%s!' hello\n", script)
 }
@@ -0,0 +1,169 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+)
+
+// Selects steps or code blocks of a scenario. Selectors are written as:
+//
+//	3          step 3
+//	3.2        code block 2 of step 3
+//	tag:setup  code blocks tagged with setup
+//	Create*    steps with a name matching the glob pattern, ignoring case
+//
+// Step and code block numbers start at 1.
+type selector struct {
+	raw             string
+	stepNumber      int
+	codeBlockNumber int
+	tag             string
+	namePattern     string
+}
+
+func parseSelector(raw string) (selector, error) {
+	value := strings.TrimSpace(raw)
+	if value == "" {
+		return selector{}, fmt.Errorf("empty selector")
+	}
+
+	if tag, found := strings.CutPrefix(value, "tag:"); found {
+		if tag == "" {
+			return selector{}, fmt.Errorf("selector '%s' is missing the tag", raw)
+		}
+		return selector{raw: raw, tag: tag}, nil
+	}
+
+	step, block, hasBlock := strings.Cut(value, ".")
+	if stepNumber, err := strconv.Atoi(step); err == nil {
+		if stepNumber < 1 {
+			return selector{}, fmt.Errorf("selector '%s' must use step numbers starting at 1", raw)
+		}
+		if !hasBlock {
+			return selector{raw: raw, stepNumber: stepNumber}, nil
+		}
+
+		codeBlockNumber, err := strconv.Atoi(block)
+		if err != nil || codeBlockNumber < 1 {
+			return selector{}, fmt.Errorf("selector '%s' must use code block numbers starting at 1", raw)
+		}
+		return selector{raw: raw, stepNumber: stepNumber, codeBlockNumber: codeBlockNumber}, nil
+	}
+
+	pattern := strings.ToLower(value)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return selector{}, fmt.Errorf("selector '%s' is not a valid pattern: %w", raw, err)
+	}
+	return selector{raw: raw, namePattern: pattern}, nil
+}
+
+// Checks if the code block at blockNumber of the step at stepNumber matches
+// the selector. Both numbers start at 0.
+func (s selector) matches(step Step, stepNumber int, blockNumber int) bool {
+	switch {
+	case s.tag != "":
+		return lib.SliceContains(step.CodeBlocks[blockNumber].Tags, s.tag)
+	case s.stepNumber != 0:
+		if s.stepNumber != stepNumber+1 {
+			return false
+		}
+		return s.codeBlockNumber == 0 || s.codeBlockNumber == blockNumber+1
+	default:
+		matched, _ := path.Match(s.namePattern, strings.ToLower(step.Name))
+		return matched
+	}
+}
+
+// Decides which code blocks of a scenario run, based on the --only and --skip
+// selectors. A code block runs if it matches any of the --only selectors (or
+// there are none) and none of the --skip selectors.
+type BlockFilter struct {
+	only  []selector
+	skip  []selector
+	start CodeBlockPosition
+}
+
+func NewBlockFilter(only []string, skip []string) (BlockFilter, error) {
+	var filter BlockFilter
+
+	for _, raw := range only {
+		s, err := parseSelector(raw)
+		if err != nil {
+			return BlockFilter{}, fmt.Errorf("invalid --only selector: %w", err)
+		}
+		filter.only = append(filter.only, s)
+	}
+
+	for _, raw := range skip {
+		s, err := parseSelector(raw)
+		if err != nil {
+			return BlockFilter{}, fmt.Errorf("invalid --skip selector: %w", err)
+		}
+		filter.skip = append(filter.skip, s)
+	}
+
+	return filter, nil
+}
+
+// Gets a copy of the filter that also skips every code block before start,
+// for scenarios that are resumed partway through.
+func (filter BlockFilter) StartingAt(start CodeBlockPosition) BlockFilter {
+	filter.start = start
+	return filter
+}
+
+// Checks if the code block at blockNumber of the step at stepNumber should be
+// skipped. Both numbers start at 0.
+func (filter BlockFilter) IsSkipped(step Step, stepNumber int, blockNumber int) bool {
+	position := CodeBlockPosition{StepNumber: stepNumber, CodeBlockNumber: blockNumber}
+	if position.IsBefore(filter.start) {
+		return true
+	}
+
+	if len(filter.only) > 0 {
+		selected := false
+		for _, s := range filter.only {
+			if s.matches(step, stepNumber, blockNumber) {
+				selected = true
+				break
+			}
+		}
+		if !selected {
+			return true
+		}
+	}
+
+	for _, s := range filter.skip {
+		if s.matches(step, stepNumber, blockNumber) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Checks for selectors that don't match any code block in the steps, which
+// usually means that they were mistyped.
+func (filter BlockFilter) UnmatchedSelectors(steps []Step) []string {
+	var unmatched []string
+
+	for _, s := range append(append([]selector{}, filter.only...), filter.skip...) {
+		matched := false
+		for stepNumber, step := range steps {
+			for blockNumber := range step.CodeBlocks {
+				if s.matches(step, stepNumber, blockNumber) {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, s.raw)
+		}
+	}
+
+	return unmatched
+}
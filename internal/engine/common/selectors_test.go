@@ -0,0 +1,92 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockFilter(t *testing.T) {
+	steps := []Step{
+		{
+			Name: "Create a resource group",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "az group create", Tags: []string{"setup"}},
+			},
+		},
+		{
+			Name: "Deploy the app",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "az webapp create"},
+				{Content: "curl $URL", Tags: []string{"verify"}},
+			},
+		},
+		{
+			Name: "Clean up",
+			CodeBlocks: []parsers.CodeBlock{
+				{Content: "az group delete", Tags: []string{"cleanup"}},
+			},
+		},
+	}
+
+	skipped := func(filter BlockFilter) []bool {
+		var result []bool
+		for stepNumber, step := range steps {
+			for blockNumber := range step.CodeBlocks {
+				result = append(result, filter.IsSkipped(step, stepNumber, blockNumber))
+			}
+		}
+		return result
+	}
+
+	t.Run("No selectors runs everything", func(t *testing.T) {
+		filter, err := NewBlockFilter(nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{false, false, false, false}, skipped(filter))
+	})
+
+	t.Run("Only a step number", func(t *testing.T) {
+		filter, err := NewBlockFilter([]string{"2"}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, false, false, true}, skipped(filter))
+	})
+
+	t.Run("Only a code block number", func(t *testing.T) {
+		filter, err := NewBlockFilter([]string{"2.2"}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{true, true, false, true}, skipped(filter))
+	})
+
+	t.Run("Skip a tag", func(t *testing.T) {
+		filter, err := NewBlockFilter(nil, []string{"tag:cleanup"})
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{false, false, false, true}, skipped(filter))
+	})
+
+	t.Run("Step names match as case insensitive globs", func(t *testing.T) {
+		filter, err := NewBlockFilter([]string{"create*", "deploy THE app"}, []string{"tag:verify"})
+		assert.NoError(t, err)
+		assert.Equal(t, []bool{false, false, true, true}, skipped(filter))
+	})
+
+	t.Run("Invalid selectors", func(t *testing.T) {
+		_, err := NewBlockFilter([]string{"0"}, nil)
+		assert.Error(t, err)
+
+		_, err = NewBlockFilter(nil, []string{"1.x"})
+		assert.Error(t, err)
+
+		_, err = NewBlockFilter(nil, []string{"tag:"})
+		assert.Error(t, err)
+
+		_, err = NewBlockFilter([]string{"[create"}, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("Selectors that match nothing are reported", func(t *testing.T) {
+		filter, err := NewBlockFilter([]string{"7", "tag:setup"}, []string{"tag:missing"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"7", "tag:missing"}, filter.UnmatchedSelectors(steps))
+	})
+}
@@ -0,0 +1,77 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The frontmatter property that runs the code blocks of a scenario in strict
+// mode.
+const strictProperty = "strict"
+
+// The attribute that turns strict mode on or off for a code block, i.e.
+// {strict=false}.
+const strictAttribute = "strict"
+
+// Gets whether the frontmatter of a scenario turns on strict mode.
+func extractStrictModeFromProperties(properties map[string]interface{}) (bool, error) {
+	switch value := properties[strictProperty].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return value, nil
+	default:
+		return false, fmt.Errorf("the '%s' property must be true or false, found %v", strictProperty, value)
+	}
+}
+
+// Checks that the strict attribute of a code block is either true or false.
+func validateStrictAttribute(block parsers.CodeBlock) error {
+	value, ok := block.Attributes[strictAttribute]
+	if ok && value != "true" && value != "false" {
+		return fmt.Errorf("invalid %s '%s', expected true or false", strictAttribute, value)
+	}
+	return nil
+}
+
+// Runs the code blocks of the scenario in strict mode, which fails them when
+// they use a variable that isn't set or a command of a pipeline fails. Code
+// blocks that turn it off with {strict=false} are left as they are.
+func (scenario *Scenario) EnableStrictMode() {
+	for i := range scenario.Steps {
+		for j := range scenario.Steps[i].CodeBlocks {
+			block := &scenario.Steps[i].CodeBlocks[j]
+			if _, ok := block.Attributes[strictAttribute]; ok {
+				continue
+			}
+			if block.Attributes == nil {
+				block.Attributes = make(map[string]string)
+			}
+			block.Attributes[strictAttribute] = "true"
+		}
+	}
+}
+
+// Checks whether a code block runs in strict mode.
+func isStrict(block parsers.CodeBlock) bool {
+	return block.Attributes[strictAttribute] == "true"
+}
+
+// Adds where the variable that isn't set was used to the error of a code block
+// that failed in strict mode.
+func locateUnsetVariable(block StatefulCodeBlock, err error) error {
+	var unset *shells.UnsetVariableError
+	if !errors.As(err, &unset) {
+		return err
+	}
+	return fmt.Errorf(
+		"%w of code block %d in step %d (%s)",
+		unset,
+		block.CodeBlockNumber+1,
+		block.StepNumber+1,
+		block.StepName,
+	)
+}
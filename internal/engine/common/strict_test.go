@@ -0,0 +1,78 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+const strictScenario = `---
+strict: true
+---
+
+# Strict
+
+## Create
+
+` + "```bash\necho $RESOURCE_GROUP\n```\n\n```bash {strict=false}\necho $OPTIONAL\n```\n"
+
+func createScenario(t *testing.T, markdown string) (*Scenario, error) {
+	t.Helper()
+	return CreateScenarioFromSource("", []byte(markdown), []string{"bash"}, nil, "", nil, 1)
+}
+
+func TestStrictMode(t *testing.T) {
+	t.Run("The frontmatter runs the code blocks that don't opt out in strict mode", func(t *testing.T) {
+		scenario, err := createScenario(t, strictScenario)
+		assert.NoError(t, err)
+
+		blocks := scenario.Steps[0].CodeBlocks
+		assert.True(t, isStrict(blocks[0]))
+		assert.False(t, isStrict(blocks[1]))
+	})
+
+	t.Run("Strict mode can be turned on for a scenario", func(t *testing.T) {
+		scenario, err := createScenario(t, "# Lenient\n\n```bash\necho $A\n```\n\n```bash {strict=false}\necho $B\n```\n")
+		assert.NoError(t, err)
+		assert.False(t, isStrict(scenario.Steps[0].CodeBlocks[0]))
+
+		scenario.EnableStrictMode()
+		assert.True(t, isStrict(scenario.Steps[0].CodeBlocks[0]))
+		assert.False(t, isStrict(scenario.Steps[0].CodeBlocks[1]))
+	})
+
+	t.Run("Invalid strict settings are reported", func(t *testing.T) {
+		_, err := createScenario(t, "---\nstrict: sometimes\n---\n\n# Strict\n\n```bash\necho hi\n```\n")
+		assert.ErrorContains(t, err, "the 'strict' property must be true or false, found sometimes")
+
+		_, err = createScenario(t, "# Strict\n\n```bash {strict=yes}\necho hi\n```\n")
+		assert.ErrorContains(t, err, "invalid strict 'yes'")
+	})
+
+	t.Run("Reports where a variable that isn't set is used", func(t *testing.T) {
+		defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+		result := RunCodeBlock(shells.BashExecutor{}, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{
+				Language:   "bash",
+				Content:    "export RESOURCE_GROUP=rg\naz group show --name $RESOURCE_GRUOP",
+				Attributes: map[string]string{"strict": "true"},
+			},
+			StepName:        "Create a VM",
+			StepNumber:      1,
+			CodeBlockNumber: 0,
+		}, shells.CommandConfiguration{})
+
+		assert.EqualError(
+			t,
+			result.Error,
+			"the variable RESOURCE_GRUOP isn't set on line 2 of code block 1 in step 2 (Create a VM)",
+		)
+		var unset *shells.UnsetVariableError
+		assert.True(t, errors.As(result.Error, &unset))
+	})
+}
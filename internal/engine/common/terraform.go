@@ -0,0 +1,250 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The language of terraform code blocks.
+const terraformLanguage = "terraform"
+
+var (
+	// The first statement of terraform configuration, a top level block of HCL.
+	terraformBlockRegex = regexp.MustCompile(
+		`^(terraform|provider|resource|data|module|variable|output|locals|check|import|moved|removed)(\s+"[^"]*")*\s*\{`,
+	)
+	terraformOutputRegex = regexp.MustCompile(`(?m)^\s*output\s+"([^"]+)"\s*\{`)
+	terraformSensitive   = regexp.MustCompile(`(?m)^\s*sensitive\s*=\s*true\b`)
+	nonVariableCharacter = regexp.MustCompile(`[^A-Z0-9_]`)
+)
+
+// Checks whether a code block holds terraform configuration written in HCL,
+// rather than commands that run terraform.
+func IsTerraformConfiguration(block parsers.CodeBlock) bool {
+	if block.Language != terraformLanguage {
+		return false
+	}
+
+	for _, line := range strings.Split(block.Content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
+			continue
+		}
+		return terraformBlockRegex.MatchString(line)
+	}
+	return false
+}
+
+// An output declared by terraform configuration.
+type TerraformOutput struct {
+	Name string
+	// The name of the variable the output is exported as.
+	Variable  string
+	Sensitive bool
+}
+
+// Finds the outputs declared by terraform configuration. They're exported as
+// variables named after them in upper case, with characters that can't be
+// part of a variable name replaced by underscores.
+func FindTerraformOutputs(configuration string) []TerraformOutput {
+	var outputs []TerraformOutput
+	for _, match := range terraformOutputRegex.FindAllStringSubmatchIndex(configuration, -1) {
+		name := configuration[match[2]:match[3]]
+		body := terraformBlockBody(configuration[match[1]:])
+
+		outputs = append(outputs, TerraformOutput{
+			Name:      name,
+			Variable:  nonVariableCharacter.ReplaceAllString(strings.ToUpper(name), "_"),
+			Sensitive: terraformSensitive.MatchString(body),
+		})
+	}
+	return outputs
+}
+
+// Gets the body of a block of HCL from the text that follows its opening
+// brace, up to the brace that closes it.
+func terraformBlockBody(text string) string {
+	depth := 1
+	for i, character := range text {
+		switch character {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}
+
+// The file that the terraform configuration of a code block is written to.
+func terraformFile(block StatefulCodeBlock) string {
+	return fmt.Sprintf("ie-%d-%d.tf", block.StepNumber+1, block.CodeBlockNumber+1)
+}
+
+// The variable that holds the directory terraform configuration is applied in,
+// for code blocks that run terraform themselves.
+const TerraformDirectoryVariable = "IE_TERRAFORM_DIRECTORY"
+
+// Builds the command that applies the terraform configuration of a code block
+// in directory. The configuration is written to a .tf file in the directory,
+// so that configuration from earlier code blocks is applied along with it,
+// and its outputs are exported as variables of the scenario. Sensitive outputs
+// are masked.
+func TerraformCommand(block StatefulCodeBlock, directory string) string {
+	configuration := block.CodeBlock.Content
+	if !strings.HasSuffix(configuration, "\n") {
+		configuration += "\n"
+	}
+
+	terraform := "terraform -chdir=" + parsers.QuoteBashValue(directory)
+	lines := []string{
+		fmt.Sprintf(
+			"cat > %s <<'IE_TERRAFORM_CONFIGURATION'",
+			parsers.QuoteBashValue(filepath.Join(directory, terraformFile(block))),
+		),
+		configuration + "IE_TERRAFORM_CONFIGURATION",
+		terraform + " init -input=false -no-color > /dev/null",
+		terraform + " plan -input=false -no-color -out=.ie.tfplan > /dev/null",
+		terraform + " apply -input=false -no-color .ie.tfplan",
+		"rm -f " + parsers.QuoteBashValue(filepath.Join(directory, ".ie.tfplan")),
+		fmt.Sprintf("export %s=%s", TerraformDirectoryVariable, parsers.QuoteBashValue(directory)),
+	}
+
+	for _, output := range FindTerraformOutputs(block.CodeBlock.Content) {
+		if output.Sensitive {
+			secrets.MarkAsSecret(output.Variable)
+		}
+		// Outputs that aren't strings, numbers or booleans are exported as JSON,
+		// on a single line so that the environment state file can hold them.
+		lines = append(lines, fmt.Sprintf(
+			"export %s=\"$(%s output -raw %s 2>/dev/null || %s output -json %s | tr -d '\\n')\"",
+			output.Variable,
+			terraform,
+			output.Name,
+			terraform,
+			output.Name,
+		))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Builds the command that destroys what terraform configuration applied in a
+// directory created.
+func TerraformDestroyCommand(directory string) string {
+	return fmt.Sprintf(
+		"terraform -chdir=%s destroy -auto-approve -input=false -no-color",
+		parsers.QuoteBashValue(directory),
+	)
+}
+
+// The directories that the scenario applies terraform configuration in, one
+// for each working directory it applies configuration from. They keep the
+// configuration and state away from the files of the scenario, and are
+// destroyed & removed once it ends.
+var terraformDirectories struct {
+	sync.Mutex
+	byWorkingDirectory map[string]string
+	applied            []string
+}
+
+// Gets the directory to apply terraform configuration from a working
+// directory in, creating it the first time. The current working directory is
+// used when workingDirectory is empty. The directory is tracked from then on,
+// even if applying the configuration fails, so that what it created can be
+// destroyed once the scenario ends.
+func terraformDirectory(workingDirectory string) (string, error) {
+	if workingDirectory == "" {
+		var err error
+		if workingDirectory, err = os.Getwd(); err != nil {
+			return "", fmt.Errorf("failed to find the working directory: %w", err)
+		}
+	}
+
+	terraformDirectories.Lock()
+	defer terraformDirectories.Unlock()
+	if directory, ok := terraformDirectories.byWorkingDirectory[workingDirectory]; ok {
+		return directory, nil
+	}
+
+	directory, err := os.MkdirTemp("", "ie-terraform-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create the terraform directory: %w", err)
+	}
+	if terraformDirectories.byWorkingDirectory == nil {
+		terraformDirectories.byWorkingDirectory = make(map[string]string)
+	}
+	terraformDirectories.byWorkingDirectory[workingDirectory] = directory
+	terraformDirectories.applied = append(terraformDirectories.applied, directory)
+	logging.GlobalLogger.Infof("Applying the terraform configuration of %s in %s", workingDirectory, directory)
+	return directory, nil
+}
+
+// Stops tracking the directories that the scenario applied terraform
+// configuration in without destroying or removing them, returning them.
+func ForgetTerraformDirectories() []string {
+	terraformDirectories.Lock()
+	defer terraformDirectories.Unlock()
+
+	directories := terraformDirectories.applied
+	terraformDirectories.applied = nil
+	terraformDirectories.byWorkingDirectory = nil
+	return directories
+}
+
+// The outcome of destroying what terraform configuration applied in a
+// directory.
+type TerraformDestruction struct {
+	Directory string
+	Error     error
+}
+
+// Destroys what the scenario applied with terraform configuration in each
+// directory with executor, in the reverse order they were applied in. The
+// directories are removed once destroyed, and kept along with the state when
+// destroying fails.
+func DestroyTerraformConfigurations(
+	executor shells.Executor,
+	environment map[string]string,
+) []TerraformDestruction {
+	directories := ForgetTerraformDirectories()
+
+	var destructions []TerraformDestruction
+	for i := len(directories) - 1; i >= 0; i-- {
+		directory := directories[i]
+		logging.GlobalLogger.Infof("Destroying the terraform configuration applied in %s", directory)
+		_, err := executor.Execute(
+			TerraformDestroyCommand(directory),
+			shells.CommandConfiguration{
+				EnvironmentVariables: lib.CopyMap(environment),
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+			},
+		)
+		if err != nil {
+			logging.GlobalLogger.Errorf(
+				"Error destroying the terraform configuration applied in %s: %s",
+				directory,
+				err.Error(),
+			)
+		} else if removeErr := os.RemoveAll(directory); removeErr != nil {
+			logging.GlobalLogger.Warnf("Failed to remove the terraform directory %s: %s", directory, removeErr)
+		}
+		destructions = append(destructions, TerraformDestruction{Directory: directory, Error: err})
+	}
+	return destructions
+}
@@ -0,0 +1,254 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+const terraformConfiguration = `# Keeps a greeting in the state.
+resource "terraform_data" "greeting" {
+  input = "hello"
+}
+
+output "greeting" {
+  value = terraform_data.greeting.output
+}
+
+output "api-key" {
+  value     = "not-so-secret"
+  sensitive = true
+}
+`
+
+func TestTerraformConfiguration(t *testing.T) {
+	t.Run("Detects terraform configuration", func(t *testing.T) {
+		for _, content := range []string{
+			terraformConfiguration,
+			"terraform {\n  required_version = \">= 1.4\"\n}\n",
+			"// Inputs\nvariable \"name\" {}\n",
+			"locals {\n  name = \"ie\"\n}\n",
+		} {
+			block := parsers.CodeBlock{Language: "terraform", Content: content}
+			assert.True(t, IsTerraformConfiguration(block), content)
+		}
+	})
+
+	t.Run("Commands that run terraform aren't configuration", func(t *testing.T) {
+		for _, block := range []parsers.CodeBlock{
+			{Language: "terraform", Content: "terraform init\nterraform apply -auto-approve\n"},
+			{Language: "terraform", Content: "cat > main.tf <<EOF\nresource \"terraform_data\" \"x\" {}\nEOF\n"},
+			{Language: "bash", Content: terraformConfiguration},
+		} {
+			assert.False(t, IsTerraformConfiguration(block), block.Content)
+		}
+	})
+
+	t.Run("Finds the outputs of the configuration", func(t *testing.T) {
+		assert.Equal(t, []TerraformOutput{
+			{Name: "greeting", Variable: "GREETING", Sensitive: false},
+			{Name: "api-key", Variable: "API_KEY", Sensitive: true},
+		}, FindTerraformOutputs(terraformConfiguration))
+	})
+
+	t.Run("Writes the configuration to a file and exports its outputs", func(t *testing.T) {
+		command := TerraformCommand(StatefulCodeBlock{
+			CodeBlock:       parsers.CodeBlock{Language: "terraform", Content: terraformConfiguration},
+			StepNumber:      1,
+			CodeBlockNumber: 0,
+		}, "/tmp/ie-terraform")
+
+		assert.True(t, strings.HasPrefix(command, "cat > /tmp/ie-terraform/ie-2-1.tf <<'IE_TERRAFORM_CONFIGURATION'\n"+terraformConfiguration))
+		assert.Contains(t, command, "terraform -chdir=/tmp/ie-terraform apply -input=false -no-color .ie.tfplan\n")
+		assert.Contains(t, command, "export IE_TERRAFORM_DIRECTORY=/tmp/ie-terraform\n")
+		assert.Contains(t, command, "export GREETING=\"$(terraform -chdir=/tmp/ie-terraform output -raw greeting 2>/dev/null || terraform -chdir=/tmp/ie-terraform output -json greeting | tr -d '\\n')\"")
+		assert.Contains(t, command, "export API_KEY=")
+	})
+
+	t.Run("Destroys the configuration applied in a directory", func(t *testing.T) {
+		assert.Equal(
+			t,
+			"terraform -chdir='/tmp/my scenario' destroy -auto-approve -input=false -no-color",
+			TerraformDestroyCommand("/tmp/my scenario"),
+		)
+	})
+}
+
+// Runs a terraform code block from a new working directory, returning the
+// result, the working directory and the directory the configuration was
+// applied in.
+func runTerraformCodeBlock(t *testing.T, environment map[string]string) (CodeBlockResult, string, string) {
+	workingDirectory := t.TempDir()
+	block := StatefulCodeBlock{
+		CodeBlock: parsers.CodeBlock{Language: "terraform", Content: terraformConfiguration},
+	}
+
+	var result CodeBlockResult
+	err := fs.UsingDirectory(workingDirectory, func() error {
+		result = RunCodeBlock(shells.BashExecutor{}, block, shells.CommandConfiguration{
+			EnvironmentVariables: environment,
+			InheritEnvironment:   true,
+		})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	state, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	assert.NoError(t, err)
+	return result, workingDirectory, state[TerraformDirectoryVariable]
+}
+
+func TestApplyingTerraformConfiguration(t *testing.T) {
+	defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	defer func() {
+		for _, directory := range ForgetTerraformDirectories() {
+			os.RemoveAll(directory)
+		}
+	}()
+
+	t.Run("Applies the configuration with terraform in a directory of its own", func(t *testing.T) {
+		// A stand-in for terraform that records its arguments in the directory
+		// it's given with -chdir.
+		bin := t.TempDir()
+		fake := "#!/bin/sh\n" +
+			"case \"$1\" in -chdir=*) cd \"${1#-chdir=}\"; shift ;; esac\n" +
+			"echo \"$@\" >> terraform.log\n" +
+			"case \"$1 $2\" in\n" +
+			"  'apply '*) echo 'Apply complete!' ;;\n" +
+			"  'output -raw') printf 'value of %s' \"$3\" ;;\n" +
+			"esac\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(bin, "terraform"), []byte(fake), 0755))
+
+		result, workingDirectory, directory := runTerraformCodeBlock(t, map[string]string{
+			"PATH": bin + ":" + os.Getenv("PATH"),
+		})
+
+		assert.NoError(t, result.Error)
+		assert.Equal(t, "Apply complete!\n", result.StdOut)
+		assert.NotEmpty(t, directory)
+		assert.NotEqual(t, workingDirectory, directory)
+
+		// Nothing is left in the working directory of the scenario.
+		files, err := os.ReadDir(workingDirectory)
+		assert.NoError(t, err)
+		assert.Empty(t, files)
+
+		configuration, err := os.ReadFile(filepath.Join(directory, "ie-1-1.tf"))
+		assert.NoError(t, err)
+		assert.Equal(t, terraformConfiguration, string(configuration))
+
+		calls, err := os.ReadFile(filepath.Join(directory, "terraform.log"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			"init -input=false -no-color",
+			"plan -input=false -no-color -out=.ie.tfplan",
+			"apply -input=false -no-color .ie.tfplan",
+			"output -raw greeting",
+			"output -raw api-key",
+		}, strings.Split(strings.TrimSpace(string(calls)), "\n"))
+
+		state, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "value of greeting", state["GREETING"])
+		assert.Equal(t, "value of api-key", state["API_KEY"])
+	})
+
+	t.Run("Applies the configuration with the real terraform", func(t *testing.T) {
+		if _, err := exec.LookPath("terraform"); err != nil {
+			t.Skip("terraform isn't installed")
+		}
+		ForgetTerraformDirectories()
+
+		// terraform_data is built into terraform, so no provider is downloaded.
+		result, _, directory := runTerraformCodeBlock(t, nil)
+
+		assert.NoError(t, result.Error)
+		assert.FileExists(t, filepath.Join(directory, "terraform.tfstate"))
+
+		state, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", state["GREETING"])
+		assert.Equal(t, "not-so-secret", state["API_KEY"])
+
+		destructions := DestroyTerraformConfigurations(shells.BashExecutor{}, nil)
+		assert.Equal(t, []TerraformDestruction{{Directory: directory}}, destructions)
+		assert.NoDirExists(t, directory)
+	})
+}
+
+func TestDestroyingTerraformConfiguration(t *testing.T) {
+	var commands []string
+	executor := shells.ExecutorFunc(func(
+		command string,
+		config shells.CommandConfiguration,
+	) (shells.CommandOutput, error) {
+		commands = append(commands, command)
+		return shells.CommandOutput{}, nil
+	})
+	block := StatefulCodeBlock{
+		CodeBlock: parsers.CodeBlock{Language: "terraform", Content: terraformConfiguration},
+	}
+	// Applies the configuration from a working directory, returning the
+	// directory it was applied in.
+	apply := func(workingDirectory string) string {
+		assert.NoError(t, fs.UsingDirectory(workingDirectory, func() error {
+			RunCodeBlock(executor, block, shells.CommandConfiguration{})
+			return nil
+		}))
+
+		terraformDirectories.Lock()
+		defer terraformDirectories.Unlock()
+		return terraformDirectories.byWorkingDirectory[workingDirectory]
+	}
+
+	t.Run("Destroys what was applied from every directory, most recent first", func(t *testing.T) {
+		firstWorkingDirectory := t.TempDir()
+		first := apply(firstWorkingDirectory)
+		second := apply(t.TempDir())
+		assert.Equal(t, first, apply(firstWorkingDirectory))
+		assert.NotEqual(t, first, second)
+
+		commands = nil
+		destructions := DestroyTerraformConfigurations(executor, nil)
+
+		assert.Equal(t, []TerraformDestruction{{Directory: second}, {Directory: first}}, destructions)
+		assert.Equal(t, []string{TerraformDestroyCommand(second), TerraformDestroyCommand(first)}, commands)
+		assert.NoDirExists(t, first)
+		assert.NoDirExists(t, second)
+		assert.Empty(t, DestroyTerraformConfigurations(executor, nil))
+	})
+
+	t.Run("Directories are kept along with the state when destroying fails", func(t *testing.T) {
+		directory := apply(t.TempDir())
+		defer os.RemoveAll(directory)
+
+		failing := shells.ExecutorFunc(func(string, shells.CommandConfiguration) (shells.CommandOutput, error) {
+			return shells.CommandOutput{}, errors.New("destroy failed")
+		})
+		destructions := DestroyTerraformConfigurations(failing, nil)
+
+		assert.Len(t, destructions, 1)
+		assert.EqualError(t, destructions[0].Error, "destroy failed")
+		assert.DirExists(t, directory)
+	})
+
+	t.Run("Directories can be forgotten without destroying anything", func(t *testing.T) {
+		directory := apply(t.TempDir())
+		defer os.RemoveAll(directory)
+
+		commands = nil
+		assert.Equal(t, []string{directory}, ForgetTerraformDirectories())
+		assert.Empty(t, DestroyTerraformConfigurations(executor, nil))
+		assert.Empty(t, commands)
+		assert.DirExists(t, directory)
+	})
+}
@@ -0,0 +1,237 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/events"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The attributes that make a code block wait for something to be ready.
+const (
+	waitAttribute         = "wait"
+	waitRegexAttribute    = "wait_regex"
+	waitURLAttribute      = "wait_url"
+	waitPortAttribute     = "wait_port"
+	waitIntervalAttribute = "wait_interval"
+	waitTimeoutAttribute  = "wait_timeout"
+)
+
+// How often a code block checks whether what it waits for is ready, and for
+// how long, unless its attributes say otherwise.
+const (
+	DefaultWaitInterval = 5 * time.Second
+	DefaultWaitTimeout  = 5 * time.Minute
+)
+
+// How a code block waits for something to be ready, declared with its
+// attributes:
+//
+//	```bash {wait_url=http://$IP_ADDRESS wait_interval=10s wait_timeout=10m}
+//
+// wait reruns the code block until it succeeds, and wait_regex until it
+// succeeds with output that matches the regex. wait_url and wait_port wait
+// for an HTTP URL to answer or a TCP port to accept connections before the
+// code block runs.
+type Wait struct {
+	// Rerun the code block until it succeeds.
+	Retry bool
+	// Rerun the code block until its output matches.
+	Regex *regexp.Regexp
+	// The HTTP URL or the host:port to wait for before running the code block.
+	URL  string
+	Port string
+	// How often to check and how long to wait before failing.
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
+// Gets how a code block waits for something to be ready from its attributes,
+// or nil if it doesn't.
+func ParseWait(block parsers.CodeBlock) (*Wait, error) {
+	attributes := block.Attributes
+	wait := Wait{
+		Retry:    attributes[waitAttribute] == "true",
+		URL:      attributes[waitURLAttribute],
+		Port:     attributes[waitPortAttribute],
+		Interval: DefaultWaitInterval,
+		Timeout:  DefaultWaitTimeout,
+	}
+
+	if pattern := attributes[waitRegexAttribute]; pattern != "" {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': %w", waitRegexAttribute, pattern, err)
+		}
+		wait.Regex = regex
+		wait.Retry = true
+	}
+
+	if !wait.Retry && wait.URL == "" && wait.Port == "" {
+		return nil, nil
+	}
+
+	for attribute, duration := range map[string]*time.Duration{
+		waitIntervalAttribute: &wait.Interval,
+		waitTimeoutAttribute:  &wait.Timeout,
+	} {
+		value, ok := attributes[attribute]
+		if !ok {
+			continue
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s '%s', expected a duration like 10s or 5m", attribute, value)
+		}
+		*duration = parsed
+	}
+
+	return &wait, nil
+}
+
+// Checks whether the output of a run of the code block is what it waits for.
+func (wait *Wait) isSatisfied(output shells.CommandOutput, err error) bool {
+	if err != nil {
+		return false
+	}
+	return wait.Regex == nil || wait.Regex.MatchString(output.StdOut)
+}
+
+// Describes what the code block waits for when it reruns.
+func (wait *Wait) retryTarget() string {
+	if wait.Regex != nil {
+		return fmt.Sprintf("the output to match %s", wait.Regex)
+	}
+	return "the code block to succeed"
+}
+
+// Waits for a condition to be true, checking it every interval until the
+// deadline and publishing the progress of the wait for the code block.
+func pollUntil(
+	ctx context.Context,
+	block StatefulCodeBlock,
+	interval time.Duration,
+	deadline time.Time,
+	target string,
+	isReady func() bool,
+) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for attempt := 1; !isReady(); attempt++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("timed out waiting for %s", target)
+		}
+		publishWaitProgress(block, fmt.Sprintf(
+			"Waiting for %s (attempt %d, %s left)",
+			target,
+			attempt,
+			remaining.Round(time.Second),
+		))
+
+		if interval > remaining {
+			interval = remaining
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return nil
+}
+
+// Waits for the URL and port of the code block to be ready before it runs.
+func waitForReadiness(
+	wait *Wait,
+	block StatefulCodeBlock,
+	config shells.CommandConfiguration,
+	deadline time.Time,
+) error {
+	variables := commandVariables(config)
+
+	if wait.URL != "" {
+		url := lib.ExpandUnquotedVariables(wait.URL, variables)
+		client := http.Client{Timeout: wait.Interval}
+		err := pollUntil(config.Context, block, wait.Interval, deadline, url+" to answer", func() bool {
+			response, err := client.Get(url)
+			if err != nil {
+				return false
+			}
+			response.Body.Close()
+			// Servers that answer with an error of their own are still up.
+			return response.StatusCode < http.StatusInternalServerError
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if wait.Port != "" {
+		address := lib.ExpandUnquotedVariables(wait.Port, variables)
+		target := fmt.Sprintf("%s to accept connections", address)
+		err := pollUntil(config.Context, block, wait.Interval, deadline, target, func() bool {
+			connection, err := net.DialTimeout("tcp", address, wait.Interval)
+			if err != nil {
+				return false
+			}
+			connection.Close()
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Runs the command of a code block that waits for something to be ready. Its
+// URL and port are waited for first, and then it's rerun until it's what it
+// waits for or the wait times out.
+func executeAndWait(
+	executor shells.Executor,
+	command string,
+	config shells.CommandConfiguration,
+	block StatefulCodeBlock,
+	wait *Wait,
+) (shells.CommandOutput, error) {
+	deadline := time.Now().Add(wait.Timeout)
+	if err := waitForReadiness(wait, block, config, deadline); err != nil {
+		return shells.CommandOutput{}, err
+	}
+
+	if !wait.Retry {
+		return executor.Execute(command, config)
+	}
+
+	var output shells.CommandOutput
+	var err error
+	waitErr := pollUntil(config.Context, block, wait.Interval, deadline, wait.retryTarget(), func() bool {
+		output, err = executor.Execute(command, config)
+		// Only the first run is written to the history.
+		config.WriteToHistory = false
+		return wait.isSatisfied(output, err)
+	})
+	if waitErr != nil {
+		return output, errors.Join(waitErr, err)
+	}
+	return output, nil
+}
+
+// Publishes how waiting for something to be ready is going for a code block.
+func publishWaitProgress(block StatefulCodeBlock, message string) {
+	event := publisher.codeBlockEvent(events.WaitProgress, block)
+	event.Data = message
+	Events.Publish(event)
+}
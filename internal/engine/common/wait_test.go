@@ -0,0 +1,180 @@
+package common
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/events"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsingWaits(t *testing.T) {
+	t.Run("Code blocks without wait attributes don't wait", func(t *testing.T) {
+		wait, err := ParseWait(parsers.CodeBlock{Attributes: map[string]string{"wait_interval": "1s"}})
+		assert.NoError(t, err)
+		assert.Nil(t, wait)
+	})
+
+	t.Run("Waits use the default interval and timeout", func(t *testing.T) {
+		wait, err := ParseWait(parsers.CodeBlock{Attributes: map[string]string{"wait": "true"}})
+		assert.NoError(t, err)
+		assert.Equal(t, &Wait{Retry: true, Interval: DefaultWaitInterval, Timeout: DefaultWaitTimeout}, wait)
+	})
+
+	t.Run("Waits for a URL with an interval and timeout", func(t *testing.T) {
+		attributes := parsers.ParseCodeBlockAttributes(
+			"bash {wait_url=http://$IP:8080/health wait_interval=10s wait_timeout=10m}",
+		)
+		wait, err := ParseWait(parsers.CodeBlock{Attributes: attributes})
+		assert.NoError(t, err)
+		assert.Equal(t, &Wait{
+			URL:      "http://$IP:8080/health",
+			Interval: 10 * time.Second,
+			Timeout:  10 * time.Minute,
+		}, wait)
+	})
+
+	t.Run("Waiting for a regex reruns the code block", func(t *testing.T) {
+		wait, err := ParseWait(parsers.CodeBlock{Attributes: map[string]string{"wait_regex": "Succeeded"}})
+		assert.NoError(t, err)
+		assert.True(t, wait.Retry)
+		assert.Equal(t, "Succeeded", wait.Regex.String())
+	})
+
+	t.Run("Invalid attributes are reported", func(t *testing.T) {
+		_, err := ParseWait(parsers.CodeBlock{Attributes: map[string]string{"wait_regex": "("}})
+		assert.ErrorContains(t, err, "invalid wait_regex '('")
+
+		_, err = ParseWait(parsers.CodeBlock{Attributes: map[string]string{"wait": "true", "wait_timeout": "soon"}})
+		assert.ErrorContains(t, err, "invalid wait_timeout 'soon'")
+
+		_, err = CreateScenarioFromSource(
+			"",
+			[]byte("# Wait\n\n```bash {wait_port=localhost:80 wait_interval=-1s}\necho hi\n```\n"),
+			[]string{"bash"},
+			nil,
+			"",
+			nil,
+			1,
+		)
+		assert.ErrorContains(t, err, "invalid wait_interval '-1s'")
+	})
+}
+
+// Runs a code block that waits in a new directory, counting the progress
+// events published while it waits.
+func runWaitingCodeBlock(
+	t *testing.T,
+	content string,
+	attributes map[string]string,
+	environment map[string]string,
+) (CodeBlockResult, int) {
+	var progress int32
+	unsubscribe := Events.Subscribe(func(event events.Event) {
+		if event.Type == events.WaitProgress {
+			atomic.AddInt32(&progress, 1)
+		}
+	})
+	defer unsubscribe()
+
+	var result CodeBlockResult
+	err := fs.UsingDirectory(t.TempDir(), func() error {
+		result = RunCodeBlock(shells.BashExecutor{}, StatefulCodeBlock{
+			CodeBlock: parsers.CodeBlock{Language: "bash", Content: content, Attributes: attributes},
+		}, shells.CommandConfiguration{EnvironmentVariables: environment})
+		return nil
+	})
+	assert.NoError(t, err)
+
+	return result, int(atomic.LoadInt32(&progress))
+}
+
+func TestWaiting(t *testing.T) {
+	defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+	// Succeeds and prints ready on the third run.
+	const eventuallyReady = "runs=$(( $(cat runs 2> /dev/null || echo 0) + 1 ))\n" +
+		"echo $runs > runs\n" +
+		"if [ $runs -ge 3 ]; then echo ready; else echo starting; fi\n"
+
+	t.Run("Reruns the code block until its output matches", func(t *testing.T) {
+		result, progress := runWaitingCodeBlock(t, eventuallyReady, map[string]string{
+			"wait_regex":    "^ready",
+			"wait_interval": "10ms",
+		}, nil)
+
+		assert.NoError(t, result.Error)
+		assert.Equal(t, "ready\n", result.StdOut)
+		assert.Equal(t, 2, progress)
+	})
+
+	t.Run("Fails once the wait times out", func(t *testing.T) {
+		result, _ := runWaitingCodeBlock(t, "echo failing\nexit 1", map[string]string{
+			"wait":          "true",
+			"wait_interval": "10ms",
+			"wait_timeout":  "50ms",
+		}, nil)
+
+		assert.ErrorContains(t, result.Error, "timed out waiting for the code block to succeed")
+		assert.ErrorContains(t, result.Error, "exit status 1")
+	})
+
+	t.Run("Waits for a URL to answer before running", func(t *testing.T) {
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if atomic.AddInt32(&requests, 1) < 3 {
+				writer.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			writer.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		result, progress := runWaitingCodeBlock(t, "echo up", map[string]string{
+			"wait_url":      "${SERVER_URL}/health",
+			"wait_interval": "10ms",
+		}, map[string]string{"SERVER_URL": server.URL})
+
+		assert.NoError(t, result.Error)
+		assert.Equal(t, "up\n", result.StdOut)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+		assert.Equal(t, 2, progress)
+	})
+
+	t.Run("Waits for a port to accept connections before running", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer listener.Close()
+
+		result, progress := runWaitingCodeBlock(t, "echo up", map[string]string{
+			"wait_port": listener.Addr().String(),
+		}, nil)
+
+		assert.NoError(t, result.Error)
+		assert.Equal(t, 0, progress)
+	})
+
+	t.Run("Fails when the port never accepts connections", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		address := listener.Addr().String()
+		listener.Close()
+
+		result, _ := runWaitingCodeBlock(t, "echo up", map[string]string{
+			"wait_port":     address,
+			"wait_interval": "10ms",
+			"wait_timeout":  "50ms",
+		}, nil)
+
+		assert.ErrorContains(t, result.Error, "timed out waiting for "+address+" to accept connections")
+		assert.Equal(t, "", result.StdOut)
+	})
+}
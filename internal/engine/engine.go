@@ -9,11 +9,15 @@ import (
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/engine/history"
 	"github.com/Azure/InnovationEngine/internal/engine/interactive"
 	"github.com/Azure/InnovationEngine/internal/engine/test"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/lib/fs"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/Azure/InnovationEngine/internal/ui"
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -28,6 +32,19 @@ type EngineConfiguration struct {
 	WorkingDirectory string
 	RenderValues     bool
 	ReportFile       string
+	// The format of the report, either "json", "junit" or "html".
+	ReportFormat string
+	// Resume the scenario after the last code block recorded by its checkpoint.
+	Resume bool
+	// Start the scenario from this step (starting at 1) instead of the first.
+	FromStep int
+	// Selectors for the steps and code blocks to run (--only) or skip (--skip).
+	Only []string
+	Skip []string
+	// Record the run of the scenario in the history store, see `ie history`.
+	RecordHistory bool
+	// Runs the commands of the scenario. Defaults to running them with bash.
+	Executor shells.Executor
 }
 
 type Engine struct {
@@ -41,24 +58,103 @@ func NewEngine(configuration EngineConfiguration) (*Engine, error) {
 	}, nil
 }
 
+// The executor that runs the commands of the scenario.
+func (e *Engine) executor() shells.Executor {
+	return shells.ExecutorOrDefault(e.Configuration.Executor)
+}
+
+// Builds the filter for the code blocks to run from --only, --skip and the
+// position the scenario starts from. Returns warnings for the selectors that
+// don't match any code block.
+func (e *Engine) blockFilter(
+	steps []common.Step,
+	start common.CodeBlockPosition,
+) (common.BlockFilter, []string, error) {
+	filter, err := common.NewBlockFilter(e.Configuration.Only, e.Configuration.Skip)
+	if err != nil {
+		return common.BlockFilter{}, nil, err
+	}
+
+	var warnings []string
+	for _, selector := range filter.UnmatchedSelectors(steps) {
+		warnings = append(warnings, fmt.Sprintf(
+			"The selector '%s' doesn't match any code block in the scenario.",
+			selector,
+		))
+	}
+
+	return filter.StartingAt(start), warnings, nil
+}
+
 // Executes a markdown scenario.
-func (e *Engine) ExecuteScenario(scenario *common.Scenario) error {
-	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
+func (e *Engine) ExecuteScenario(scenario *common.Scenario) (err error) {
+	common.PublishScenarioStarted(scenario.Name, common.ModeExecute, len(scenario.Steps))
+	defer func() { common.PublishScenarioFinished(err) }()
+
+	start, warnings, err := e.restoreCheckpoint(scenario)
+	if err != nil {
+		return err
+	}
+	filter, filterWarnings, err := e.blockFilter(
+		filterDeletionCommands(scenario.Steps, e.Configuration.DoNotDelete),
+		start.position,
+	)
+	if err != nil {
+		return err
+	}
+	warnings = append(warnings, filterWarnings...)
+	checkpoints := common.NewCheckpointWriter(scenario)
+
+	return fs.UsingDirectory(start.workingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
 
 		// Execute the steps
 		fmt.Println(ui.ScenarioTitleStyle.Render(scenario.Name))
-		err := e.ExecuteAndRenderSteps(scenario.Steps, lib.CopyMap(scenario.Environment))
-		return err
+		fmt.Print(renderWarnings(warnings))
+		if message := seedMessage(scenario); message != "" {
+			fmt.Println(message)
+		}
+		err := e.ExecuteAndRenderSteps(
+			scenario.Steps,
+			lib.CopyMap(scenario.Environment),
+			filter,
+			checkpoints,
+		)
+		stopped := common.StopBackgroundProcesses(e.executor())
+		lines := renderStoppedProcesses(stopped)
+		lines = append(lines, e.destroyTerraformConfigurations(scenario.Environment)...)
+		for _, line := range lines {
+			fmt.Println(line)
+		}
+		if err != nil {
+			return err
+		}
+		return e.cleanEnvironmentStateFile()
 	})
 }
 
 // Executes a scenario in testing moe. This mode goes over each code block
 // and executes it without user interaction.
-func (e *Engine) TestScenario(scenario *common.Scenario) error {
-	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
+func (e *Engine) TestScenario(scenario *common.Scenario) (err error) {
+	common.PublishScenarioStarted(scenario.Name, common.ModeTest, len(scenario.Steps))
+	defer func() { common.PublishScenarioFinished(err) }()
+
+	start, warnings, err := e.restoreCheckpoint(scenario)
+	if err != nil {
+		return err
+	}
+	checkpoints := common.NewCheckpointWriter(scenario)
+	// Resolved before changing the working directory, as the path may be relative.
+	scenarioPath := history.ResolveScenarioPath(scenario.Path)
+
+	return fs.UsingDirectory(start.workingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
 		stepsToExecute := filterDeletionCommands(scenario.Steps, e.Configuration.DoNotDelete)
+		filter, filterWarnings, err := e.blockFilter(stepsToExecute, start.position)
+		if err != nil {
+			return err
+		}
+		warnings = append(warnings, filterWarnings...)
 
 		initialEnvironmentVariables := lib.GetEnvironmentVariables()
 
@@ -68,11 +164,21 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			e.Configuration.Environment,
 			stepsToExecute,
 			lib.CopyMap(scenario.Environment),
+			filter,
+			checkpoints,
+			e.executor(),
 		)
 		if err != nil {
 			return err
 		}
 
+		if len(warnings) > 0 {
+			model.CommandLines = append(
+				[]string{renderWarnings(warnings)},
+				model.CommandLines...,
+			)
+		}
+
 		var flags []tea.ProgramOption
 		if environments.EnvironmentsGithubAction == e.Configuration.Environment {
 			flags = append(
@@ -85,10 +191,12 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			flags = append(flags, tea.WithAltScreen(), tea.WithMouseCellMotion())
 		}
 
-		common.Program = tea.NewProgram(model, flags...)
+		tui.Program = tea.NewProgram(model, flags...)
 
 		var finalModel tea.Model
-		finalModel, err = common.Program.Run()
+		finalModel, err = tui.Program.Run()
+		// Background processes are stopped whether the scenario succeeded or not.
+		backgroundProcesses := common.StopBackgroundProcesses(e.executor())
 
 		// TODO(vmarcella): After testing is complete, we should generate a report.
 
@@ -98,14 +206,18 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			return err
 		}
 
-		if e.Configuration.ReportFile != "" {
+		model.CommandLines = append(model.CommandLines, renderStoppedProcesses(backgroundProcesses)...)
+		model.CommandLines = append(model.CommandLines, e.destroyTerraformConfigurations(scenario.Environment)...)
+
+		if e.Configuration.ReportFile != "" || e.Configuration.RecordHistory {
 			allEnvironmentVariables, envErr := lib.LoadEnvironmentStateFile(
 				lib.DefaultEnvironmentStateFile,
 			)
 			if envErr != nil {
-				logging.GlobalLogger.Errorf("Failed to load environment state file: %s", err)
-				err = errors.Join(err, fmt.Errorf("failed to load environment state file: %s", err))
-				return err
+				// The state file doesn't exist when the first code block fails, in
+				// which case the report is still written without any variables.
+				logging.GlobalLogger.Warnf("Failed to load environment state file: %s", envErr)
+				allEnvironmentVariables = make(map[string]string)
 			}
 
 			variablesDeclaredByScenario := lib.DiffMapsByKey(
@@ -114,24 +226,40 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 			)
 
 			report := common.BuildReport(scenario.Name)
-			err = report.
+			report.
 				WithProperties(scenario.Properties).
 				WithEnvironmentVariables(variablesDeclaredByScenario).
+				WithSeed(scenario.Seed).
 				WithError(model.GetFailure()).
 				WithCodeBlocks(model.GetCodeBlocks()).
-				WriteToJSONFile(e.Configuration.ReportFile)
-			if err != nil {
-				err = errors.Join(err, fmt.Errorf("failed to write report to file: %s", err))
-				return err
+				WithBackgroundProcesses(backgroundProcesses)
+
+			if e.Configuration.RecordHistory {
+				// Failing to record the run shouldn't fail the scenario.
+				if historyErr := e.recordHistory(scenarioPath, scenario, report); historyErr != nil {
+					logging.GlobalLogger.Warnf("Failed to record the run in the history: %s", historyErr)
+				}
 			}
 
-			model.CommandLines = append(
-				model.CommandLines,
-				"Report written to "+e.Configuration.ReportFile,
-			)
+			if e.Configuration.ReportFile != "" {
+				err = report.WriteToFile(e.Configuration.ReportFile, e.Configuration.ReportFormat)
+				if err != nil {
+					err = errors.Join(err, fmt.Errorf("failed to write report to file: %s", err))
+					return err
+				}
+
+				model.CommandLines = append(
+					model.CommandLines,
+					"Report written to "+e.Configuration.ReportFile,
+				)
+			}
 		}
 
-		fmt.Println(strings.Join(model.CommandLines, "\n"))
+		if message := seedMessage(scenario); message != "" {
+			model.CommandLines = append(model.CommandLines, message)
+		}
+
+		fmt.Println(secrets.MaskString(strings.Join(model.CommandLines, "\n")))
 
 		err = errors.Join(err, model.GetFailure())
 		if err != nil {
@@ -143,13 +271,91 @@ func (e *Engine) TestScenario(scenario *common.Scenario) error {
 	})
 }
 
+// Records a run of the scenario in the history store.
+func (e *Engine) recordHistory(
+	scenarioPath string,
+	scenario *common.Scenario,
+	report common.Report,
+) error {
+	store, err := history.DefaultStore()
+	if err != nil {
+		return err
+	}
+	return store.Record(scenarioPath, common.HashMarkdown(scenario.Source), report)
+}
+
+// Describes the seed used to generate the values of the scenario, so that a
+// run can be reproduced. Returns an empty string if no values were generated.
+func seedMessage(scenario *common.Scenario) string {
+	if len(scenario.GeneratedVariables) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(
+		"Generated the values of %s using the seed %d. Use --seed %d to generate the same values again.",
+		strings.Join(scenario.GeneratedVariables, ", "),
+		scenario.Seed,
+		scenario.Seed,
+	)
+}
+
+// Describes the background processes stopped once the scenario ended, one
+// line each.
+func renderStoppedProcesses(processes []common.BackgroundProcess) []string {
+	var lines []string
+	for _, process := range processes {
+		lines = append(lines, fmt.Sprintf(
+			"Stopped the background process of code block %d.%d (PID %d).",
+			process.StepNumber+1,
+			process.CodeBlockNumber+1,
+			process.PID,
+		))
+	}
+	return lines
+}
+
+// Destroys what terraform configuration applied while the scenario ran, unless
+// --do-not-delete is set, returning lines that describe what happened.
+func (e *Engine) destroyTerraformConfigurations(environment map[string]string) []string {
+	var lines []string
+	if e.Configuration.DoNotDelete {
+		for _, directory := range common.ForgetTerraformDirectories() {
+			lines = append(lines, fmt.Sprintf("Kept the terraform configuration applied in %s.", directory))
+		}
+		return lines
+	}
+
+	for _, destruction := range common.DestroyTerraformConfigurations(e.executor(), environment) {
+		if destruction.Error != nil {
+			lines = append(lines, ui.ErrorStyle.Render(fmt.Sprintf(
+				"Error destroying the terraform configuration applied in %s: %s",
+				destruction.Directory,
+				destruction.Error.Error(),
+			)))
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("Destroyed the terraform configuration applied in %s.", destruction.Directory))
+	}
+	return lines
+}
+
 // Executes a Scenario in interactive mode. This mode goes over each codeblock
 // step by step and allows the user to interact with the codeblock.
-func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
+func (e *Engine) InteractWithScenario(scenario *common.Scenario) (err error) {
+	common.PublishScenarioStarted(scenario.Name, common.ModeInteractive, len(scenario.Steps))
+	defer func() { common.PublishScenarioFinished(err) }()
+
 	return fs.UsingDirectory(e.Configuration.WorkingDirectory, func() error {
 		az.SetCorrelationId(e.Configuration.CorrelationId, scenario.Environment)
 
 		stepsToExecute := filterDeletionCommands(scenario.Steps, e.Configuration.DoNotDelete)
+		filter, warnings, err := e.blockFilter(stepsToExecute, common.CodeBlockPosition{})
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			logging.GlobalLogger.Warn(warning)
+		}
 
 		model, err := interactive.NewInteractiveModeModel(
 			scenario.Name,
@@ -158,33 +364,44 @@ func (e *Engine) InteractWithScenario(scenario *common.Scenario) error {
 			stepsToExecute,
 			lib.CopyMap(scenario.Environment),
 			scenario.GetSourceAsString(),
+			filter,
+			e.Configuration.RenderValues,
+			e.executor(),
 		)
 		if err != nil {
 			return err
 		}
 
-		common.Program = tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
+		tui.Program = tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion())
 
 		var finalModel tea.Model
 		var ok bool
-		finalModel, err = common.Program.Run()
+		finalModel, err = tui.Program.Run()
 
 		model, ok = finalModel.(interactive.InteractiveModeModel)
+		stopped := common.StopBackgroundProcesses(e.executor())
+		model.CommandLines = append(model.CommandLines, renderStoppedProcesses(stopped)...)
+		model.CommandLines = append(model.CommandLines, e.destroyTerraformConfigurations(scenario.Environment)...)
 
 		if environments.EnvironmentsAzure == e.Configuration.Environment {
 			if !ok {
 				return fmt.Errorf("failed to cast tea.Model to InteractiveModeModel")
 			}
 
+			if message := seedMessage(scenario); message != "" {
+				model.CommandLines = append(model.CommandLines, message)
+			}
+
 			logging.GlobalLogger.Info("Writing session output to stdout")
-			fmt.Println(strings.Join(model.CommandLines, "\n"))
+			fmt.Println(secrets.MaskString(strings.Join(model.CommandLines, "\n")))
 		}
 
 		switch e.Configuration.Environment {
 		case environments.EnvironmentsAzure, environments.EnvironmentsOCD:
 
-			logging.GlobalLogger.Info(
-				"Cleaning environment variable file located at /tmp/env-vars",
+			logging.GlobalLogger.Infof(
+				"Cleaning environment variable file located at %s",
+				lib.DefaultEnvironmentStateFile,
 			)
 
 			err := lib.CleanEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
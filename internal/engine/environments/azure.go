@@ -8,6 +8,8 @@ import (
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/patterns"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/Azure/InnovationEngine/internal/ui"
 )
 
@@ -54,7 +56,9 @@ func (status *AzureDeploymentStatus) AsJsonString() (string, error) {
 		return "", err
 	}
 
-	return string(json), nil
+	// The status is displayed by the portal, which includes the configured
+	// markdown & the output of the commands.
+	return secrets.MaskString(string(json)), nil
 }
 
 func (status *AzureDeploymentStatus) AddStep(step string, codeBlocks []AzureCodeBlock) {
@@ -162,6 +166,7 @@ func GetAzureStatus(status AzureDeploymentStatus, environment string) string {
 // Attach deployed resource URIs to the one click deployment status if we're in
 // the correct environment & we have a resource group name.
 func AttachResourceURIsToAzureStatus(
+	executor shells.Executor,
 	status *AzureDeploymentStatus,
 	resourceGroupName string,
 	environment string,
@@ -177,7 +182,7 @@ func AttachResourceURIsToAzureStatus(
 		return
 	}
 
-	resourceURIs := az.FindAllDeployedResourceURIs(resourceGroupName)
+	resourceURIs := az.FindAllDeployedResourceURIs(executor, resourceGroupName)
 
 	if len(resourceURIs) > 0 {
 		logging.GlobalLogger.WithField("resourceURIs", resourceURIs).
@@ -0,0 +1,148 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/secrets"
+)
+
+// The types of events published while running a scenario.
+type Type string
+
+const (
+	ScenarioStarted   Type = "scenario_started"
+	StepStarted       Type = "step_started"
+	CodeBlockStarted  Type = "code_block_started"
+	Output            Type = "output"
+	CodeBlockFinished Type = "code_block_finished"
+	ScenarioFinished  Type = "scenario_finished"
+	// Published while a code block waits for something to be ready, with a
+	// description of how the wait is going as its data.
+	WaitProgress Type = "wait_progress"
+)
+
+// The streams that output events come from.
+const (
+	StreamStdOut = "stdout"
+	StreamStdErr = "stderr"
+)
+
+// A step of the scenario. The number starts at 0, like it does in reports.
+type Step struct {
+	Number int    `json:"number"`
+	Name   string `json:"name"`
+}
+
+// Something that happened while running a scenario. Which fields are set
+// depends on the type of the event.
+type Event struct {
+	Type     Type      `json:"type"`
+	Time     time.Time `json:"time"`
+	Scenario string    `json:"scenario"`
+	// The mode the scenario runs in and how many steps it has, set when the
+	// scenario starts.
+	Mode  string `json:"mode,omitempty"`
+	Steps int    `json:"steps,omitempty"`
+	// The step and the number of the code block within it, starting at 0.
+	Step      *Step `json:"step,omitempty"`
+	CodeBlock *int  `json:"codeBlock,omitempty"`
+	// The command of the code block, set when the code block starts.
+	Content string `json:"content,omitempty"`
+	// A chunk of output, written to Stream.
+	Stream string `json:"stream,omitempty"`
+	Data   string `json:"data,omitempty"`
+	// The result of a code block or scenario: passed, failed or, for code
+	// blocks, skipped.
+	Status          string   `json:"status,omitempty"`
+	StdOut          string   `json:"stdOut,omitempty"`
+	StdErr          string   `json:"stdErr,omitempty"`
+	SimilarityScore *float64 `json:"similarityScore,omitempty"`
+	DurationSeconds float64  `json:"durationSeconds,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// Returns a copy of the event with secrets masked.
+func (event Event) masked() Event {
+	event.Content = secrets.MaskString(event.Content)
+	event.Data = secrets.MaskString(event.Data)
+	event.StdOut = secrets.MaskString(event.StdOut)
+	event.StdErr = secrets.MaskString(event.StdErr)
+	event.Error = secrets.MaskString(event.Error)
+	return event
+}
+
+// Delivers the events that are published to every subscriber, in the order
+// they're published. Safe to use from several goroutines.
+type Bus struct {
+	mutex       sync.Mutex
+	subscribers []*subscriber
+}
+
+type subscriber struct {
+	handler func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Calls handler for every event published from now on, until the returned
+// function is called.
+func (bus *Bus) Subscribe(handler func(Event)) func() {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	subscription := &subscriber{handler: handler}
+	bus.subscribers = append(bus.subscribers, subscription)
+
+	return func() {
+		bus.mutex.Lock()
+		defer bus.mutex.Unlock()
+
+		for index, existing := range bus.subscribers {
+			if existing == subscription {
+				bus.subscribers = append(bus.subscribers[:index:index], bus.subscribers[index+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Removes every subscriber.
+func (bus *Bus) Reset() {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.subscribers = nil
+}
+
+// Publishes an event, setting its time if it isn't set. Secrets are masked in
+// the commands, output and errors the event carries before it's delivered.
+func (bus *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	event = event.masked()
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for _, subscription := range bus.subscribers {
+		subscription.handler(event)
+	}
+}
+
+// Creates a subscriber that writes each event to writer as a line of JSON, with
+// any secrets masked.
+func NewJSONLWriter(writer io.Writer) func(Event) {
+	return func(event Event) {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		io.WriteString(writer, secrets.MaskString(string(line))+"\n")
+	}
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("Delivers events to every subscriber in order", func(t *testing.T) {
+		bus := NewBus()
+
+		var first, second []Type
+		bus.Subscribe(func(event Event) { first = append(first, event.Type) })
+		bus.Subscribe(func(event Event) { second = append(second, event.Type) })
+
+		bus.Publish(Event{Type: ScenarioStarted})
+		bus.Publish(Event{Type: ScenarioFinished})
+
+		assert.Equal(t, []Type{ScenarioStarted, ScenarioFinished}, first)
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("Sets the time of events", func(t *testing.T) {
+		bus := NewBus()
+
+		var events []Event
+		bus.Subscribe(func(event Event) { events = append(events, event) })
+		bus.Publish(Event{Type: ScenarioStarted})
+
+		assert.False(t, events[0].Time.IsZero())
+	})
+
+	t.Run("Stops delivering events to subscribers that unsubscribed", func(t *testing.T) {
+		bus := NewBus()
+
+		first, second := 0, 0
+		unsubscribe := bus.Subscribe(func(event Event) { first++ })
+		bus.Subscribe(func(event Event) { second++ })
+
+		bus.Publish(Event{Type: ScenarioStarted})
+		unsubscribe()
+		unsubscribe()
+		bus.Publish(Event{Type: ScenarioFinished})
+
+		assert.Equal(t, 1, first)
+		assert.Equal(t, 2, second)
+	})
+
+	t.Run("Stops delivering events once reset", func(t *testing.T) {
+		bus := NewBus()
+
+		delivered := 0
+		bus.Subscribe(func(event Event) { delivered++ })
+		bus.Reset()
+		bus.Publish(Event{Type: ScenarioStarted})
+
+		assert.Equal(t, 0, delivered)
+	})
+
+	t.Run("Masks secrets before delivering events", func(t *testing.T) {
+		secrets.Register("bus-test-secret-value")
+		bus := NewBus()
+
+		var events []Event
+		bus.Subscribe(func(event Event) { events = append(events, event) })
+		bus.Publish(Event{
+			Type:   CodeBlockFinished,
+			StdOut: "the value is bus-test-secret-value",
+			Error:  "bus-test-secret-value was rejected",
+		})
+
+		assert.Equal(t, "the value is "+secrets.Mask, events[0].StdOut)
+		assert.Equal(t, secrets.Mask+" was rejected", events[0].Error)
+	})
+}
+
+func TestJSONLWriter(t *testing.T) {
+	t.Run("Writes an event per line", func(t *testing.T) {
+		var output bytes.Buffer
+		bus := NewBus()
+		bus.Subscribe(NewJSONLWriter(&output))
+
+		codeBlock := 0
+		bus.Publish(Event{Type: ScenarioStarted, Scenario: "Deploy", Mode: "test", Steps: 1})
+		bus.Publish(Event{
+			Type:      Output,
+			Scenario:  "Deploy",
+			Step:      &Step{Number: 0, Name: "Create"},
+			CodeBlock: &codeBlock,
+			Stream:    StreamStdOut,
+			Data:      "created\n",
+		})
+
+		lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+		assert.Len(t, lines, 2)
+
+		var event Event
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+		assert.Equal(t, Output, event.Type)
+		assert.Equal(t, "Create", event.Step.Name)
+		assert.Equal(t, 0, *event.CodeBlock)
+		assert.Equal(t, "created\n", event.Data)
+
+		// Fields that don't apply to the event are left out.
+		assert.NotContains(t, lines[0], "codeBlock")
+		assert.NotContains(t, lines[1], "mode")
+	})
+
+	t.Run("Masks secrets", func(t *testing.T) {
+		secrets.Register("events-test-secret-value")
+
+		var output bytes.Buffer
+		writer := NewJSONLWriter(&output)
+		writer(Event{Type: Output, Data: "the value is events-test-secret-value\n"})
+
+		assert.NotContains(t, output.String(), "events-test-secret-value")
+		assert.Contains(t, output.String(), secrets.Mask)
+	})
+}
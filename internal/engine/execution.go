@@ -8,10 +8,12 @@ import (
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/engine/events"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/patterns"
+	"github.com/Azure/InnovationEngine/internal/secrets"
 	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/Azure/InnovationEngine/internal/terminal"
 	"github.com/Azure/InnovationEngine/internal/ui"
@@ -24,15 +26,16 @@ const (
 	spinnerRefresh = 100 * time.Millisecond
 )
 
-// If a scenario has an `az group delete` command and the `--do-not-delete`
-// flag is set, we remove it from the steps.
+// If a scenario has an `az group delete` or `terraform destroy` command and the
+// `--do-not-delete` flag is set, we remove it from the steps.
 func filterDeletionCommands(steps []common.Step, preserveResources bool) []common.Step {
 	filteredSteps := []common.Step{}
 	if preserveResources {
 		for _, step := range steps {
 			newBlocks := []parsers.CodeBlock{}
 			for _, block := range step.CodeBlocks {
-				if patterns.AzGroupDelete.MatchString(block.Content) {
+				if patterns.AzGroupDelete.MatchString(block.Content) ||
+					patterns.TerraformDestroy.MatchString(block.Content) {
 					continue
 				} else {
 					newBlocks = append(newBlocks, block)
@@ -51,29 +54,21 @@ func filterDeletionCommands(steps []common.Step, preserveResources bool) []commo
 	return filteredSteps
 }
 
-func renderCommand(blockContent string) (shells.CommandOutput, error) {
-	escapedCommand := blockContent
-	if !patterns.MultilineQuotedStringCommand.MatchString(blockContent) {
-		escapedCommand = strings.ReplaceAll(blockContent, "\\\n", "\\\\\n")
-	}
-	renderedCommand, err := shells.ExecuteBashCommand(
-		"echo -e \""+escapedCommand+"\"",
-		shells.BashCommandConfiguration{
-			EnvironmentVariables: map[string]string{},
-			InteractiveCommand:   false,
-			WriteToHistory:       false,
-			InheritEnvironment:   true,
-		},
-	)
-	return renderedCommand, err
-}
-
 // Executes the steps from a scenario and renders the output to the terminal.
-func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]string) error {
+// Code blocks skipped by the filter are shown but not executed. A checkpoint is
+// saved after each successful code block and cleared once every code block has
+// succeeded.
+func (e *Engine) ExecuteAndRenderSteps(
+	steps []common.Step,
+	env map[string]string,
+	filter common.BlockFilter,
+	checkpoints *common.CheckpointWriter,
+) error {
 	var resourceGroupName string = ""
 	azureStatus := environments.NewAzureDeploymentStatus()
+	executor := e.executor()
 
-	err := az.SetSubscription(e.Configuration.Subscription)
+	err := az.SetSubscription(executor, e.Configuration.Subscription)
 	if err != nil {
 		logging.GlobalLogger.Errorf("Invalid Config: Failed to set subscription: %s", err)
 		azureStatus.SetError(err)
@@ -103,28 +98,45 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 		fmt.Println(ui.StepTitleStyle.Render(stepTitle))
 		azureStatus.CurrentStep = stepNumber + 1
 
-		for _, block := range step.CodeBlocks {
-			var finalCommandOutput string
+		for blockNumber, block := range step.CodeBlocks {
+			position := common.CodeBlockPosition{StepNumber: stepNumber, CodeBlockNumber: blockNumber}
+			codeBlockState := common.StatefulCodeBlock{
+				CodeBlock:       block,
+				CodeBlockNumber: blockNumber,
+				StepName:        step.Name,
+				StepNumber:      stepNumber,
+			}
+			if filter.IsSkipped(step, stepNumber, blockNumber) {
+				logging.GlobalLogger.Infof("Skipping command: %s", block.Content)
+				common.PublishCodeBlockSkipped(codeBlockState)
+				fmt.Print("    " + secrets.MaskString(ui.IndentMultiLineCommand(block.Content, 4)))
+				fmt.Printf("  %s\n", ui.SkippedStyle.Render("Skipped"))
+				continue
+			}
+
+			content := block.Content
 			if e.Configuration.RenderValues {
-				// Render the codeblock.
-				renderedCommand, err := renderCommand(block.Content)
-				if err != nil {
-					logging.GlobalLogger.Errorf("Failed to render command: %s", err.Error())
-					azureStatus.SetError(err)
-					environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
-					return err
-				}
-				finalCommandOutput = ui.IndentMultiLineCommand(renderedCommand.StdOut, 4)
+				content = common.RenderValues(block, env)
+			}
+
+			var finalCommandOutput string
+			if block.File() != "" {
+				// The content of the code block isn't a command, so it's shown
+				// under the file it's written to.
+				finalCommandOutput = ui.IndentMultiLineCommand(
+					ui.FilePrompt(block.Language, block.File())+content,
+					4,
+				)
 			} else {
-				finalCommandOutput = ui.IndentMultiLineCommand(block.Content, 4)
+				finalCommandOutput = ui.IndentMultiLineCommand(content, 4)
 			}
 
+			finalCommandOutput = secrets.MaskString(finalCommandOutput)
 			fmt.Print("    " + finalCommandOutput)
 
 			// execute the command as a goroutine to allow for the spinner to be
 			// rendered while the command is executing.
-			done := make(chan error)
-			var commandOutput shells.CommandOutput
+			done := make(chan common.CodeBlockResult)
 
 			// If the command is an SSH command, we need to forward the input and
 			// output
@@ -136,7 +148,7 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 			logging.GlobalLogger.WithField("isInteractive", interactiveCommand).
 				Infof("Executing command: %s", block.Content)
 
-			var commandErr error
+			var result common.CodeBlockResult
 			var frame int = 0
 
 			// If forwarding input/output, don't render the spinner.
@@ -151,68 +163,86 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				fmt.Print(ui.SpinnerStyle.Render("  "+string(spinnerFrames[0])) + " ")
 				terminal.HideCursor()
 
-				go func(block parsers.CodeBlock) {
-					output, err := shells.ExecuteBashCommand(
-						block.Content,
-						shells.BashCommandConfiguration{
+				// Show how waiting for something to be ready is going on the line
+				// below the command.
+				progress := make(chan string, 1)
+				unsubscribe := common.Events.Subscribe(func(event events.Event) {
+					if event.Type == events.WaitProgress {
+						select {
+						case progress <- event.Data:
+						default:
+						}
+					}
+				})
+				showedProgress := false
+
+				go func(block common.StatefulCodeBlock) {
+					result := common.RunCodeBlock(
+						executor,
+						block,
+						shells.CommandConfiguration{
 							EnvironmentVariables: lib.CopyMap(env),
 							InheritEnvironment:   true,
 							InteractiveCommand:   false,
 							WriteToHistory:       true,
 						},
 					)
-					logging.GlobalLogger.Infof("Command output to stdout:\n %s", output.StdOut)
-					logging.GlobalLogger.Infof("Command output to stderr:\n %s", output.StdErr)
-					commandOutput = output
-					done <- err
-				}(block)
+					logging.GlobalLogger.Infof("Command output to stdout:\n %s", result.StdOut)
+					logging.GlobalLogger.Infof("Command output to stderr:\n %s", result.StdErr)
+					done <- result
+				}(codeBlockState)
 			renderingLoop:
 				// While the command is executing, render the spinner.
 				for {
 					select {
-					case commandErr = <-done:
+					case message := <-progress:
+						if lines > 0 {
+							terminal.WriteLineBelow(lines, "    "+ui.SpinnerStyle.Render(secrets.MaskString(message)))
+							showedProgress = true
+						}
+					case result = <-done:
+						unsubscribe()
+						if showedProgress {
+							terminal.WriteLineBelow(lines, "")
+						}
+
 						// Show the cursor, check the result of the command, and display the
 						// final status.
 						terminal.ShowCursor()
 
-						if commandErr == nil {
-
-							actualOutput := commandOutput.StdOut
-							expectedOutput := block.ExpectedOutput.Content
-							expectedSimilarity := block.ExpectedOutput.ExpectedSimilarity
-							expectedRegex := block.ExpectedOutput.ExpectedRegex
-							expectedOutputLanguage := block.ExpectedOutput.Language
-
-							_, outputComparisonError := common.CompareCommandOutputs(actualOutput, expectedOutput, expectedSimilarity, expectedRegex, expectedOutputLanguage)
-
-							if outputComparisonError != nil {
-								logging.GlobalLogger.Errorf("Error comparing command outputs: %s", outputComparisonError.Error())
-								fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
-								terminal.MoveCursorPositionDown(lines)
-								fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(outputComparisonError.Error()))
-								fmt.Printf("	%s\n", lib.GetDifferenceBetweenStrings(block.ExpectedOutput.Content, commandOutput.StdOut))
-
-								azureStatus.SetError(outputComparisonError)
-								environments.AttachResourceURIsToAzureStatus(
-									&azureStatus,
-									resourceGroupName,
-									e.Configuration.Environment,
-								)
-								environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
+						if result.OutputMismatch {
+							fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
+							terminal.MoveCursorPositionDown(lines)
+							fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(secrets.MaskString(result.Error.Error())))
+							fmt.Printf("	%s\n", lib.GetDifferenceBetweenStrings(block.ExpectedOutput.Content, secrets.MaskString(result.StdOut)))
 
-								return outputComparisonError
-							}
+							azureStatus.SetError(result.Error)
+							environments.AttachResourceURIsToAzureStatus(
+								executor,
+								&azureStatus,
+								resourceGroupName,
+								e.Configuration.Environment,
+							)
+							environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
+
+							return result.Error
+						}
 
+						if result.Error == nil {
 							fmt.Printf("\r  %s \n", ui.CheckStyle.Render("✔"))
 							terminal.MoveCursorPositionDown(lines)
 
-							fmt.Printf("%s\n", ui.RemoveHorizontalAlign(ui.VerboseStyle.Render(commandOutput.StdOut)))
+							fmt.Printf("%s\n", ui.RemoveHorizontalAlign(ui.VerboseStyle.Render(secrets.MaskString(result.StdOut))))
+
+							if err := checkpoints.Save(position); err != nil {
+								logging.GlobalLogger.Warnf("Failed to save a checkpoint: %s", err)
+							}
 
 							// Extract the resource group name from the command output if
 							// it's not already set.
 							if resourceGroupName == "" && patterns.AzCommand.MatchString(block.Content) {
 								logging.GlobalLogger.Info("Attempting to extract resource group name from command output")
-								tmpResourceGroup := az.FindResourceGroupName(commandOutput.StdOut)
+								tmpResourceGroup := az.FindResourceGroupName(result.StdOut)
 								if tmpResourceGroup != "" {
 									logging.GlobalLogger.WithField("resourceGroup", tmpResourceGroup).Info("Found resource group")
 									resourceGroupName = tmpResourceGroup
@@ -223,24 +253,22 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 							if stepNumber != len(stepsToExecute)-1 {
 								environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 							}
-
 						} else {
 							terminal.ShowCursor()
 							fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
 							terminal.MoveCursorPositionDown(lines)
-							fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(commandErr.Error()))
+							fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(secrets.MaskString(result.Error.Error())))
 
-							logging.GlobalLogger.Errorf("Error executing command: %s", commandErr.Error())
-
-							azureStatus.SetError(commandErr)
+							azureStatus.SetError(result.Error)
 							environments.AttachResourceURIsToAzureStatus(
+								executor,
 								&azureStatus,
 								resourceGroupName,
 								e.Configuration.Environment,
 							)
 							environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 
-							return commandErr
+							return result.Error
 						}
 
 						break renderingLoop
@@ -258,13 +286,14 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				// one click deployments and does not affect the normal execution flow.
 				if stepNumber == len(stepsToExecute)-1 && patterns.SshCommand.MatchString(block.Content) {
 					azureStatus.Status = "Succeeded"
-					environments.AttachResourceURIsToAzureStatus(&azureStatus, resourceGroupName, e.Configuration.Environment)
+					environments.AttachResourceURIsToAzureStatus(executor, &azureStatus, resourceGroupName, e.Configuration.Environment)
 					environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 				}
 
-				output, commandExecutionError := shells.ExecuteBashCommand(
-					block.Content,
-					shells.BashCommandConfiguration{
+				result := common.RunCodeBlock(
+					executor,
+					codeBlockState,
+					shells.CommandConfiguration{
 						EnvironmentVariables: lib.CopyMap(env),
 						InheritEnvironment:   true,
 						InteractiveCommand:   true,
@@ -274,11 +303,15 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 
 				terminal.ShowCursor()
 
-				if commandExecutionError == nil {
+				if result.Error == nil {
 					fmt.Printf("\r  %s \n", ui.CheckStyle.Render("✔"))
 					terminal.MoveCursorPositionDown(lines)
 
-					fmt.Printf("  %s\n", ui.VerboseStyle.Render(output.StdOut))
+					fmt.Printf("  %s\n", ui.VerboseStyle.Render(secrets.MaskString(result.StdOut)))
+
+					if err := checkpoints.Save(position); err != nil {
+						logging.GlobalLogger.Warnf("Failed to save a checkpoint: %s", err)
+					}
 
 					if stepNumber != len(stepsToExecute)-1 {
 						environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
@@ -286,29 +319,41 @@ func (e *Engine) ExecuteAndRenderSteps(steps []common.Step, env map[string]strin
 				} else {
 					fmt.Printf("\r  %s \n", ui.ErrorStyle.Render("✗"))
 					terminal.MoveCursorPositionDown(lines)
-					fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(commandExecutionError.Error()))
+					fmt.Printf("  %s\n", ui.ErrorMessageStyle.Render(secrets.MaskString(result.Error.Error())))
 
-					azureStatus.SetError(commandExecutionError)
+					azureStatus.SetError(result.Error)
 					environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
-					return commandExecutionError
+					return result.Error
 				}
 			}
 		}
 	}
 
+	if err := checkpoints.Clear(); err != nil {
+		logging.GlobalLogger.Warnf("Failed to clear the checkpoint: %s", err)
+	}
+
 	// Report the final status of the deployment (Only applies to one click deployments).
 	azureStatus.Status = "Succeeded"
 	environments.AttachResourceURIsToAzureStatus(
+		executor,
 		&azureStatus,
 		resourceGroupName,
 		e.Configuration.Environment,
 	)
 	environments.ReportAzureStatus(azureStatus, e.Configuration.Environment)
 
+	return nil
+}
+
+// Cleans up the environment state file once the scenario succeeded, after
+// what it created was destroyed with the variables it holds.
+func (e *Engine) cleanEnvironmentStateFile() error {
 	switch e.Configuration.Environment {
 	case environments.EnvironmentsAzure, environments.EnvironmentsOCD:
-		logging.GlobalLogger.Info(
-			"Cleaning environment variable file located at /tmp/env-vars",
+		logging.GlobalLogger.Infof(
+			"Cleaning environment variable file located at %s",
+			lib.DefaultEnvironmentStateFile,
 		)
 		err := lib.CleanEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
 		if err != nil {
@@ -3,6 +3,8 @@ package engine
 import (
 	"testing"
 
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,12 +15,21 @@ func TestExecuteBlock(t *testing.T) {
 		"echo \"hello world\"",
 		"echo hello world",
 		"ls \\\n-a",
+		"echo `date` $(whoami) '$HOME'",
+		"cat <<EOF\nhello \"world\"\nEOF",
 	}
 	for _, blockCommand := range blocks {
 		t.Run("render command", func(t *testing.T) {
-			_, err := renderCommand(blockCommand)
-			assert.Equal(t, nil, err)
+			rendered := common.RenderValues(parsers.CodeBlock{Content: blockCommand}, map[string]string{})
+			assert.Equal(t, blockCommand, rendered)
 		})
 	}
 
+	t.Run("render command with values", func(t *testing.T) {
+		rendered := common.RenderValues(
+			parsers.CodeBlock{Content: "az group create \\\n  --name \"$RG\" --location ${REGION:-eastus}"},
+			map[string]string{"RG": "rg-1"},
+		)
+		assert.Equal(t, "az group create \\\n  --name \"rg-1\" --location eastus", rendered)
+	})
 }
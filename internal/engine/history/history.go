@@ -0,0 +1,161 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/lib/fs"
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// Environment variable that overrides the location of the history store.
+const DirectoryVariable = "IE_HISTORY_DIRECTORY"
+
+// How many runs are kept for each scenario. The oldest runs are removed first.
+const RunsToKeep = 100
+
+// A run of a scenario recorded in the history.
+type Entry struct {
+	Scenario     string        `json:"scenario"`
+	MarkdownHash string        `json:"markdownHash"`
+	RecordedAt   time.Time     `json:"recordedAt"`
+	Report       common.Report `json:"report"`
+}
+
+// A directory of the runs of each scenario, indexed by the path of the
+// scenario. Each scenario has a directory of its own with a file per run.
+type Store struct {
+	directory string
+}
+
+func NewStore(directory string) Store {
+	return Store{directory: directory}
+}
+
+// Gets the store in the directory set by IE_HISTORY_DIRECTORY, or in
+// ~/.ie/history when it isn't set.
+func DefaultStore() (Store, error) {
+	if directory := os.Getenv(DirectoryVariable); directory != "" {
+		return NewStore(directory), nil
+	}
+
+	home, err := lib.GetHomeDirectory()
+	if err != nil {
+		return Store{}, err
+	}
+	return NewStore(filepath.Join(home, ".ie", "history")), nil
+}
+
+// Resolves the path of a scenario to the one it's recorded under, so that the
+// same scenario is found from any working directory.
+func ResolveScenarioPath(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	if absolutePath, err := filepath.Abs(path); err == nil {
+		return absolutePath
+	}
+	return path
+}
+
+func (store Store) scenarioDirectory(scenarioPath string) string {
+	hash := sha256.Sum256([]byte(scenarioPath))
+	return filepath.Join(store.directory, hex.EncodeToString(hash[:])[:16])
+}
+
+// Records a run of the scenario at scenarioPath, which has to be resolved with
+// ResolveScenarioPath. Secrets are masked before the run is written.
+func (store Store) Record(scenarioPath string, markdownHash string, report common.Report) error {
+	entry := Entry{
+		Scenario:     scenarioPath,
+		MarkdownHash: markdownHash,
+		RecordedAt:   time.Now().UTC(),
+		Report:       report.Masked(),
+	}
+
+	contents, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	directory := store.scenarioDirectory(scenarioPath)
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return fmt.Errorf("failed to create the history directory '%s': %w", directory, err)
+	}
+
+	path := filepath.Join(directory, entry.RecordedAt.Format("20060102T150405.000000000Z")+".json")
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		return fmt.Errorf("failed to record the run in '%s': %w", path, err)
+	}
+	logging.GlobalLogger.Infof("Recorded the run of %s in %s", scenarioPath, path)
+
+	return store.prune(directory)
+}
+
+// Removes the oldest runs of a scenario so that only RunsToKeep are left.
+func (store Store) prune(directory string) error {
+	files, err := runFiles(directory)
+	if err != nil {
+		return err
+	}
+
+	for len(files) > RunsToKeep {
+		if err := os.Remove(files[0]); err != nil {
+			return fmt.Errorf("failed to remove the old run '%s': %w", files[0], err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// Gets the files of the runs in a scenario directory, oldest first.
+func runFiles(directory string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Loads the runs recorded for the scenario at scenarioPath, oldest first.
+func (store Store) Load(scenarioPath string) ([]Entry, error) {
+	directory := store.scenarioDirectory(scenarioPath)
+	if !fs.FileExists(directory) {
+		return nil, nil
+	}
+
+	files, err := runFiles(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the run '%s': %w", file, err)
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(contents, &entry); err != nil {
+			logging.GlobalLogger.Warnf("Skipping the run '%s' that can't be parsed: %s", file, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].RecordedAt.Before(entries[j].RecordedAt)
+	})
+	return entries, nil
+}
@@ -0,0 +1,201 @@
+package history
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildReport(blocks ...common.StatefulCodeBlock) common.Report {
+	report := common.BuildReport("Scenario")
+	report.WithCodeBlocks(blocks)
+	for _, block := range blocks {
+		if block.Error != nil {
+			report.WithError(block.Error)
+		}
+	}
+	return report
+}
+
+func TestHistoryStore(t *testing.T) {
+	store := NewStore(t.TempDir())
+	scenario := ResolveScenarioPath("scenario.md")
+
+	t.Run("Scenario paths are resolved to absolute paths", func(t *testing.T) {
+		assert.True(t, filepath.IsAbs(scenario))
+		assert.Equal(t, "https://example.com/a.md", ResolveScenarioPath("https://example.com/a.md"))
+	})
+
+	t.Run("Scenarios without runs have no history", func(t *testing.T) {
+		entries, err := store.Load(scenario)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Runs are loaded oldest first", func(t *testing.T) {
+		assert.NoError(t, store.Record(scenario, "hash-1", buildReport(common.StatefulCodeBlock{Success: true})))
+		assert.NoError(t, store.Record(scenario, "hash-2", buildReport(common.StatefulCodeBlock{
+			Error: errors.New("failed"),
+		})))
+		assert.NoError(t, store.Record(ResolveScenarioPath("other.md"), "hash-3", buildReport()))
+
+		entries, err := store.Load(scenario)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.Equal(t, "hash-1", entries[0].MarkdownHash)
+		assert.Equal(t, "hash-2", entries[1].MarkdownHash)
+		assert.Equal(t, scenario, entries[1].Scenario)
+		assert.False(t, entries[1].Report.Success)
+		assert.EqualError(t, entries[1].Report.CodeBlocks[0].Error, "failed")
+	})
+
+	t.Run("Only the most recent runs are kept", func(t *testing.T) {
+		pruned := ResolveScenarioPath("pruned.md")
+		for i := 0; i < RunsToKeep+5; i++ {
+			assert.NoError(t, store.Record(pruned, "hash", buildReport()))
+		}
+
+		entries, err := store.Load(pruned)
+		assert.NoError(t, err)
+		assert.Len(t, entries, RunsToKeep)
+	})
+	t.Run("Runs are private and have their secrets masked", func(t *testing.T) {
+		secret := `Pa<ss>&word`
+		secrets.Register(secret)
+		private := ResolveScenarioPath("private.md")
+		assert.NoError(t, store.Record(private, "hash", buildReport(common.StatefulCodeBlock{
+			StdOut: "logged in with " + secret,
+			Error:  errors.New("rejected " + secret),
+		})))
+
+		files, err := runFiles(store.scenarioDirectory(private))
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+		info, err := os.Stat(files[0])
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		contents, err := os.ReadFile(files[0])
+		assert.NoError(t, err)
+		assert.NotContains(t, string(contents), "Pa\\u003css")
+		assert.NotContains(t, string(contents), secret)
+
+		entries, err := store.Load(private)
+		assert.NoError(t, err)
+		assert.Equal(t, "logged in with "+secrets.Mask, entries[0].Report.CodeBlocks[0].StdOut)
+		assert.EqualError(t, entries[0].Report.CodeBlocks[0].Error, "rejected "+secrets.Mask)
+		assert.Equal(t, "rejected "+secrets.Mask, entries[0].Report.Error)
+	})
+}
+
+func TestHistorySummaries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := func(hours int, hash string, report common.Report) Entry {
+		return Entry{
+			Scenario:     "/scenario.md",
+			MarkdownHash: hash,
+			RecordedAt:   start.Add(time.Duration(hours) * time.Hour),
+			Report:       report,
+		}
+	}
+
+	create := func(duration float64) common.StatefulCodeBlock {
+		return common.StatefulCodeBlock{StepName: "Create", Success: true, DurationSeconds: duration}
+	}
+	verify := func(success bool) common.StatefulCodeBlock {
+		block := common.StatefulCodeBlock{StepName: "Verify", StepNumber: 1, DurationSeconds: 1}
+		if success {
+			block.Success = true
+		} else {
+			block.Error = errors.New("Expected output does not match actual output.")
+		}
+		return block
+	}
+	edited := func(success bool) common.StatefulCodeBlock {
+		block := verify(success)
+		block.StepName = "Edited"
+		return block
+	}
+
+	summary := Summarize("/scenario.md", []Entry{
+		entry(0, "v1", buildReport(create(1), verify(true), edited(false))),
+		entry(1, "v1", buildReport(create(2), verify(false), edited(false))),
+		entry(2, "v2", buildReport(create(4), verify(true), edited(true))),
+		entry(3, "v2", buildReport(create(8), verify(true), edited(true))),
+	})
+
+	t.Run("Runs are counted in order", func(t *testing.T) {
+		assert.Equal(t, 4, summary.Runs)
+		assert.Equal(t, 2, summary.Passed)
+		assert.Equal(t, 2, summary.Failed)
+
+		assert.False(t, summary.History[1].Success)
+		assert.Equal(t, "Expected output does not match actual output.", summary.History[1].Error)
+		assert.False(t, summary.History[1].MarkdownChanged)
+		assert.True(t, summary.History[2].MarkdownChanged)
+		assert.Equal(t, 10.0, summary.History[3].DurationSeconds)
+	})
+
+	t.Run("Blocks that fail intermittently for the same markdown are flaky", func(t *testing.T) {
+		assert.Len(t, summary.CodeBlocks, 3)
+
+		assert.Equal(t, "Create", summary.CodeBlocks[0].StepName)
+		assert.False(t, summary.CodeBlocks[0].Flaky)
+
+		assert.Equal(t, "Verify", summary.CodeBlocks[1].StepName)
+		assert.True(t, summary.CodeBlocks[1].Flaky)
+		assert.Equal(t, 1, summary.CodeBlocks[1].Failed)
+		assert.Equal(t, 4, summary.CodeBlocks[1].Runs)
+
+		// Edited only started passing after the markdown changed.
+		assert.Equal(t, "Edited", summary.CodeBlocks[2].StepName)
+		assert.False(t, summary.CodeBlocks[2].Flaky)
+	})
+
+	t.Run("Durations are tracked over time", func(t *testing.T) {
+		assert.Equal(t, []float64{1, 2, 4, 8}, summary.CodeBlocks[0].DurationsSeconds)
+		assert.Equal(t, 3.75, summary.CodeBlocks[0].AverageDurationSeconds)
+		assert.Equal(t, "▁▂▄█", sparkline(summary.CodeBlocks[0].DurationsSeconds))
+	})
+
+	t.Run("The history can be rendered for the terminal", func(t *testing.T) {
+		rendered := summary.Render()
+
+		assert.Contains(t, rendered, "4 runs, 2 passed, 2 failed (50% passed)")
+		assert.Contains(t, rendered, "(markdown changed)")
+		assert.Contains(t, rendered, "Step 2.1: Verify")
+		assert.Contains(t, rendered, "failed 1 of 4 runs")
+		assert.Contains(t, rendered, "average 3.8s, latest 8.0s")
+	})
+
+	t.Run("Steps sharing a name are tracked separately", func(t *testing.T) {
+		again := func(success bool) common.StatefulCodeBlock {
+			block := verify(success)
+			block.StepNumber = 2
+			return block
+		}
+		summary := Summarize("/scenario.md", []Entry{
+			entry(0, "v1", buildReport(verify(true), again(false))),
+			entry(1, "v1", buildReport(verify(true), again(false))),
+		})
+
+		assert.Len(t, summary.CodeBlocks, 2)
+		for _, codeBlock := range summary.CodeBlocks {
+			assert.Equal(t, "Verify", codeBlock.StepName)
+			assert.Equal(t, 2, codeBlock.Runs)
+			assert.False(t, codeBlock.Flaky)
+		}
+		assert.Equal(t, 0, summary.CodeBlocks[0].Failed)
+		assert.Equal(t, 2, summary.CodeBlocks[1].Failed)
+	})
+
+	t.Run("Scenarios without runs say so", func(t *testing.T) {
+		assert.Contains(t, Summarize("/scenario.md", nil).Render(), "No runs recorded.")
+	})
+}
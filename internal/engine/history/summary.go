@@ -0,0 +1,257 @@
+package history
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// A run of a scenario, as shown in its history.
+type RunSummary struct {
+	RecordedAt      time.Time `json:"recordedAt"`
+	Success         bool      `json:"success"`
+	DurationSeconds float64   `json:"durationSeconds"`
+	MarkdownHash    string    `json:"markdownHash"`
+	// Whether the markdown changed since the previous run.
+	MarkdownChanged bool   `json:"markdownChanged"`
+	Error           string `json:"error,omitempty"`
+}
+
+// How a code block fared across the runs of a scenario.
+type CodeBlockSummary struct {
+	StepName        string `json:"stepName"`
+	StepNumber      int    `json:"stepNumber"`
+	CodeBlockNumber int    `json:"codeBlockNumber"`
+	Runs            int    `json:"runs"`
+	Passed          int    `json:"passed"`
+	Failed          int    `json:"failed"`
+	// A code block is flaky when it both passed and failed for the same version
+	// of the markdown, so that failures caused by editing it aren't counted.
+	Flaky bool `json:"flaky"`
+	// The durations of the runs the code block ran in, oldest first.
+	DurationsSeconds       []float64 `json:"durationsSeconds"`
+	AverageDurationSeconds float64   `json:"averageDurationSeconds"`
+}
+
+// The history of a scenario.
+type Summary struct {
+	Scenario   string             `json:"scenario"`
+	Runs       int                `json:"runs"`
+	Passed     int                `json:"passed"`
+	Failed     int                `json:"failed"`
+	History    []RunSummary       `json:"history"`
+	CodeBlocks []CodeBlockSummary `json:"codeBlocks"`
+}
+
+// Summarizes the runs of a scenario, which are expected oldest first.
+func Summarize(scenario string, entries []Entry) Summary {
+	summary := Summary{
+		Scenario:   scenario,
+		History:    []RunSummary{},
+		CodeBlocks: []CodeBlockSummary{},
+	}
+
+	// Code blocks are matched across runs the same way `ie report diff` matches
+	// them, see common.CodeBlockKeys.
+	indices := make(map[string]int)
+	outcomes := make(map[string]map[string]map[string]bool)
+
+	for index, entry := range entries {
+		run := RunSummary{
+			RecordedAt:   entry.RecordedAt,
+			Success:      entry.Report.Success,
+			MarkdownHash: entry.MarkdownHash,
+			MarkdownChanged: index > 0 &&
+				entries[index-1].MarkdownHash != entry.MarkdownHash,
+		}
+		run.Error, _, _ = strings.Cut(entry.Report.Error, "\n")
+
+		summary.Runs++
+		if run.Success {
+			summary.Passed++
+		} else {
+			summary.Failed++
+		}
+
+		keys := common.CodeBlockKeys(entry.Report.CodeBlocks)
+		for blockIndex, block := range entry.Report.CodeBlocks {
+			run.DurationSeconds += block.DurationSeconds
+
+			status := block.Status()
+			if status != common.CodeBlockPassed && status != common.CodeBlockFailed {
+				continue
+			}
+
+			key := keys[blockIndex]
+			position, ok := indices[key]
+			if !ok {
+				position = len(summary.CodeBlocks)
+				indices[key] = position
+				summary.CodeBlocks = append(summary.CodeBlocks, CodeBlockSummary{
+					StepName:        block.StepName,
+					CodeBlockNumber: block.CodeBlockNumber,
+				})
+				outcomes[key] = make(map[string]map[string]bool)
+			}
+
+			codeBlock := &summary.CodeBlocks[position]
+			codeBlock.StepNumber = block.StepNumber
+			codeBlock.Runs++
+			if status == common.CodeBlockPassed {
+				codeBlock.Passed++
+			} else {
+				codeBlock.Failed++
+			}
+			codeBlock.DurationsSeconds = append(codeBlock.DurationsSeconds, block.DurationSeconds)
+
+			if outcomes[key][entry.MarkdownHash] == nil {
+				outcomes[key][entry.MarkdownHash] = make(map[string]bool)
+			}
+			outcomes[key][entry.MarkdownHash][status] = true
+		}
+
+		summary.History = append(summary.History, run)
+	}
+
+	for key, position := range indices {
+		codeBlock := &summary.CodeBlocks[position]
+		for _, statuses := range outcomes[key] {
+			if statuses[common.CodeBlockPassed] && statuses[common.CodeBlockFailed] {
+				codeBlock.Flaky = true
+			}
+		}
+
+		total := 0.0
+		for _, duration := range codeBlock.DurationsSeconds {
+			total += duration
+		}
+		codeBlock.AverageDurationSeconds = total / float64(len(codeBlock.DurationsSeconds))
+	}
+
+	return summary
+}
+
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// Renders values as a line of bars, scaled between the smallest and largest.
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		lowest = math.Min(lowest, value)
+		highest = math.Max(highest, value)
+	}
+
+	var line strings.Builder
+	for _, value := range values {
+		level := 0
+		if highest > lowest {
+			level = int((value - lowest) / (highest - lowest) * float64(len(sparkLevels)-1))
+		}
+		line.WriteRune(sparkLevels[level])
+	}
+	return line.String()
+}
+
+func (codeBlock CodeBlockSummary) title() string {
+	return fmt.Sprintf(
+		"Step %d.%d: %s",
+		codeBlock.StepNumber+1,
+		codeBlock.CodeBlockNumber+1,
+		codeBlock.StepName,
+	)
+}
+
+// Renders the history for the terminal.
+func (summary Summary) Render() string {
+	var text strings.Builder
+
+	fmt.Fprintf(&text, "%s\n", ui.ScenarioTitleStyle.Render(summary.Scenario))
+	if summary.Runs == 0 {
+		text.WriteString("\nNo runs recorded. Runs are recorded by ie test.\n")
+		return text.String()
+	}
+
+	fmt.Fprintf(
+		&text,
+		"%d runs, %d passed, %d failed (%.0f%% passed)\n",
+		summary.Runs,
+		summary.Passed,
+		summary.Failed,
+		float64(summary.Passed)/float64(summary.Runs)*100,
+	)
+
+	text.WriteString("\nTrend, oldest first: ")
+	for _, run := range summary.History {
+		if run.Success {
+			text.WriteString(ui.CheckStyle.Render("✔"))
+		} else {
+			text.WriteString(ui.ErrorStyle.Render("✗"))
+		}
+	}
+	text.WriteString("\n\nRuns:\n")
+
+	for _, run := range summary.History {
+		status := ui.CheckStyle.Render("passed")
+		if !run.Success {
+			status = ui.ErrorStyle.Render("failed")
+		}
+		changed := ""
+		if run.MarkdownChanged {
+			changed = " (markdown changed)"
+		}
+
+		fmt.Fprintf(
+			&text,
+			"  %s  %s  %7.1fs  %.8s%s",
+			run.RecordedAt.Local().Format("2006-01-02 15:04:05"),
+			status,
+			run.DurationSeconds,
+			run.MarkdownHash,
+			changed,
+		)
+		if run.Error != "" {
+			fmt.Fprintf(&text, "  %s", run.Error)
+		}
+		text.WriteString("\n")
+	}
+
+	text.WriteString("\nFlaky code blocks:\n")
+	flaky := 0
+	for _, codeBlock := range summary.CodeBlocks {
+		if codeBlock.Flaky {
+			flaky++
+			fmt.Fprintf(
+				&text,
+				"  %s  %s\n",
+				codeBlock.title(),
+				ui.WarningStyle.Render(fmt.Sprintf("failed %d of %d runs", codeBlock.Failed, codeBlock.Runs)),
+			)
+		}
+	}
+	if flaky == 0 {
+		text.WriteString("  None\n")
+	}
+
+	text.WriteString("\nCode block durations, oldest first:\n")
+	for _, codeBlock := range summary.CodeBlocks {
+		latest := codeBlock.DurationsSeconds[len(codeBlock.DurationsSeconds)-1]
+		fmt.Fprintf(
+			&text,
+			"  %s  average %.1fs, latest %.1fs  %s\n",
+			codeBlock.title(),
+			codeBlock.AverageDurationSeconds,
+			latest,
+			sparkline(codeBlock.DurationsSeconds),
+		)
+	}
+
+	return text.String()
+}
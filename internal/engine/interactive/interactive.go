@@ -9,9 +9,13 @@ import (
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
 	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/patterns"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/Azure/InnovationEngine/internal/ui"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
@@ -47,7 +51,9 @@ type InteractiveModeModel struct {
 	currentCodeBlock  int
 	env               map[string]string
 	environment       string
+	executor          shells.Executor
 	executingCommand  bool
+	waitProgress      string
 	stepsToBeExecuted int
 	recordingInput    bool
 	recordedInput     string
@@ -61,13 +67,14 @@ type InteractiveModeModel struct {
 	components        interactiveModeComponents
 	ready             bool
 	markdownSource    string
+	renderValues      bool
 	CommandLines      []string
 }
 
 // Initialize the intractive mode model
 func (model InteractiveModeModel) Init() tea.Cmd {
 	environments.ReportAzureStatus(model.azureStatus, model.environment)
-	return tea.Batch(common.ClearScreen(), tea.Tick(time.Millisecond*10, func(t time.Time) tea.Msg {
+	return tea.Batch(tui.ClearScreen(), tea.Tick(time.Millisecond*10, func(t time.Time) tea.Msg {
 		return tea.KeyMsg{Type: tea.KeyCtrlL} // This is to force a repaint
 	}))
 }
@@ -157,7 +164,7 @@ func handleUserInput(
 		previousCodeBlock := model.currentCodeBlock - 1
 		if previousCodeBlock >= 0 {
 			previousCodeBlockState := model.codeBlockState[previousCodeBlock]
-			if !previousCodeBlockState.Success {
+			if !previousCodeBlockState.Success && !previousCodeBlockState.Skipped {
 				logging.GlobalLogger.Info(
 					"Previous command has not been executed successfully, ignoring execute command",
 				)
@@ -179,6 +186,11 @@ func handleUserInput(
 
 		model.executingCommand = true
 
+		if codeBlockState.Skipped {
+			commands = append(commands, tui.SkipCodeBlock(codeBlockState))
+			break
+		}
+
 		// If we're on the last step and the command is an SSH command, we need
 		// to report the status before executing the command. This is needed for
 		// one click deployments and does not affect the normal execution flow.
@@ -186,6 +198,7 @@ func handleUserInput(
 			patterns.SshCommand.MatchString(codeBlock.Content) {
 			model.azureStatus.Status = "Succeeded"
 			environments.AttachResourceURIsToAzureStatus(
+				model.executor,
 				&model.azureStatus,
 				model.resourceGroupName,
 				model.environment,
@@ -206,14 +219,15 @@ func handleUserInput(
 			)
 
 			commands = append(commands, tea.Sequence(
-				common.UpdateAzureStatus(model.azureStatus, model.environment),
+				tui.UpdateAzureStatus(model.azureStatus, model.environment),
 				func() tea.Msg {
-					return common.ExecuteCodeBlockSync(codeBlock, lib.CopyMap(model.env))
+					return tui.ExecuteCodeBlockSync(model.executor, codeBlockState, lib.CopyMap(model.env))
 				}))
 
 		} else {
-			commands = append(commands, common.ExecuteCodeBlockAsync(
-				codeBlock,
+			commands = append(commands, tui.ExecuteCodeBlockAsync(
+				model.executor,
+				codeBlockState,
 				lib.CopyMap(model.env),
 			))
 		}
@@ -300,9 +314,13 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		model, commands = handleUserInput(model, message)
 
-	case common.SuccessfulCommandMessage:
+	case tui.WaitProgressMessage:
+		model.waitProgress = message.Message
+
+	case tui.SuccessfulCommandMessage:
 		// Handle successful command executions
 		model.executingCommand = false
+		model.waitProgress = ""
 		step := model.currentCodeBlock
 
 		// Update the state of the codeblock which finished executing.
@@ -310,6 +328,9 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
 		codeBlockState.Success = true
+		codeBlockState.DurationSeconds = message.Duration.Seconds()
+		codeBlockState.Captured = message.Captured
+		codeBlockState.Variables = message.Variables
 		model.codeBlockState[step] = codeBlockState
 
 		logging.GlobalLogger.Infof("Finished executing:\n %s", codeBlockState.CodeBlock.Content)
@@ -327,75 +348,19 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		model.CommandLines = append(model.CommandLines, codeBlockState.StdOut)
 
-		// Increment the codeblock and update the viewport content.
-		model.currentCodeBlock++
-
-		if model.currentCodeBlock < len(model.codeBlockState) {
-			nextCommand := model.codeBlockState[model.currentCodeBlock].CodeBlock.Content
-			nextLanguage := model.codeBlockState[model.currentCodeBlock].CodeBlock.Language
-
-			model.CommandLines = append(model.CommandLines, ui.CommandPrompt(nextLanguage)+nextCommand)
-		}
-
-		// Only increment the step for azure if the step name has changed.
-		nextCodeBlockState := model.codeBlockState[model.currentCodeBlock]
-
-		if codeBlockState.StepName != nextCodeBlockState.StepName {
-			logging.GlobalLogger.Debugf("Step name has changed, incrementing step for Azure")
-			model.azureStatus.CurrentStep++
-		} else {
-			logging.GlobalLogger.Debugf("Step name has not changed, not incrementing step for Azure")
-		}
-
-		model.stepsToBeExecuted--
+		model, commands = model.advance(codeBlockState, commands)
 
-		// If the scenario has been completed, we need to update the azure
-		// status and quit the program.
-		if model.currentCodeBlock == len(model.codeBlockState) {
-			model.scenarioCompleted = true
-			model.azureStatus.Status = "Succeeded"
-			environments.AttachResourceURIsToAzureStatus(
-				&model.azureStatus,
-				model.resourceGroupName,
-				model.environment,
-			)
+	case tui.SkippedCommandMessage:
+		model.executingCommand = false
+		model.waitProgress = ""
+		codeBlockState := model.codeBlockState[model.currentCodeBlock]
+		logging.GlobalLogger.Infof("Skipped:\n %s", codeBlockState.CodeBlock.Content)
 
-			environmentVariables, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
-			if err != nil {
-				logging.GlobalLogger.Errorf("Failed to load environment state file: %s", err)
-				model.azureStatus.SetError(err)
-			}
+		model.CommandLines = append(model.CommandLines, ui.SkippedStyle.Render("Skipped"))
 
-			model.azureStatus.ConfigureMarkdownForDownload(
-				model.markdownSource,
-				environmentVariables,
-				model.environment,
-			)
-			model.azureStatus.SetOutput(strings.Join(model.CommandLines, "\n"))
-			commands = append(
-				commands,
-				tea.Sequence(
-					common.UpdateAzureStatus(model.azureStatus, model.environment),
-					tea.Quit,
-				),
-			)
-		} else {
-			commands = append(
-				commands,
-				tea.Sequence(
-					common.UpdateAzureStatus(model.azureStatus, model.environment),
-					// Send a key event to trigger
-					func() tea.Msg {
-						if model.stepsToBeExecuted <= 0 {
-							return nil
-						}
-						return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}}
-					},
-				),
-			)
-		}
+		model, commands = model.advance(codeBlockState, commands)
 
-	case common.FailedCommandMessage:
+	case tui.FailedCommandMessage:
 		// Handle failed command executions
 
 		// Update the state of the codeblock which finished executing.
@@ -404,14 +369,18 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.StdOut = message.StdOut
 		codeBlockState.StdErr = message.StdErr
 		codeBlockState.Success = false
+		codeBlockState.DurationSeconds = message.Duration.Seconds()
+		codeBlockState.Variables = message.Variables
 
 		model.codeBlockState[step] = codeBlockState
 		model.CommandLines = append(model.CommandLines, codeBlockState.StdErr)
 
 		// Report the error
 		model.executingCommand = false
+		model.waitProgress = ""
 		model.azureStatus.SetError(message.Error)
 		environments.AttachResourceURIsToAzureStatus(
+			model.executor,
 			&model.azureStatus,
 			model.resourceGroupName,
 			model.environment,
@@ -421,12 +390,12 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		commands = append(
 			commands,
 			tea.Sequence(
-				common.UpdateAzureStatus(model.azureStatus, model.environment),
+				tui.UpdateAzureStatus(model.azureStatus, model.environment),
 				tea.Quit,
 			),
 		)
 
-	case common.AzureStatusUpdatedMessage:
+	case tui.AzureStatusUpdatedMessage:
 		// After the status has been updated, we force a window resize to
 		// render over the status update. For some reason, clearing the screen
 		// manually seems to cause the text produced by View() to not render
@@ -447,10 +416,11 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	// Update viewport content
 	block := model.codeBlockState[model.currentCodeBlock]
 
+	content := displayedContent(block.CodeBlock, model.env, model.renderValues)
 	renderedStepSection := fmt.Sprintf(
 		"%s\n\n%s",
 		block.CodeBlock.Description,
-		block.CodeBlock.Content,
+		content,
 	)
 
 	// TODO(vmarcella): We shoulkd figure out a way to not have to recreate
@@ -467,7 +437,7 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 				"%s\n```%s\n%s```",
 				block.CodeBlock.Description,
 				block.CodeBlock.Language,
-				block.CodeBlock.Content,
+				content,
 			),
 		)
 		if err != nil {
@@ -486,16 +456,20 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	model.components.stepViewport.SetContent(
-		renderedStepSection,
+		secrets.MaskString(renderedStepSection),
 	)
 
 	if block.Success {
-		model.components.outputViewport.SetContent(block.StdOut)
+		model.components.outputViewport.SetContent(secrets.MaskString(block.StdOut))
+	} else if block.Skipped {
+		model.components.outputViewport.SetContent(ui.SkippedStyle.Render("Skipped"))
 	} else {
-		model.components.outputViewport.SetContent(block.StdErr)
+		model.components.outputViewport.SetContent(secrets.MaskString(block.StdErr))
 	}
 
-	model.components.azureCLIViewport.SetContent(strings.Join(model.CommandLines, "\n"))
+	model.components.azureCLIViewport.SetContent(
+		secrets.MaskString(strings.Join(model.CommandLines, "\n")),
+	)
 
 	// Update all the viewports and append resulting commands.
 	var command tea.Cmd
@@ -514,6 +488,86 @@ func (model InteractiveModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	return model, tea.Batch(commands...)
 }
 
+// Moves on to the code block after the one that just finished, quitting once
+// the last code block has finished.
+func (model InteractiveModeModel) advance(
+	codeBlockState common.StatefulCodeBlock,
+	commands []tea.Cmd,
+) (InteractiveModeModel, []tea.Cmd) {
+	// Increment the codeblock and update the viewport content.
+	model.currentCodeBlock++
+
+	if model.currentCodeBlock < len(model.codeBlockState) {
+		nextCodeBlock := model.codeBlockState[model.currentCodeBlock].CodeBlock
+
+		model.CommandLines = append(
+			model.CommandLines,
+			tui.CodeBlockPrompt(nextCodeBlock)+displayedContent(nextCodeBlock, model.env, model.renderValues),
+		)
+	}
+
+	// Only increment the step for azure if the step name has changed.
+	nextCodeBlockState := model.codeBlockState[model.currentCodeBlock]
+
+	if codeBlockState.StepName != nextCodeBlockState.StepName {
+		logging.GlobalLogger.Debugf("Step name has changed, incrementing step for Azure")
+		model.azureStatus.CurrentStep++
+	} else {
+		logging.GlobalLogger.Debugf("Step name has not changed, not incrementing step for Azure")
+	}
+
+	model.stepsToBeExecuted--
+
+	// If the scenario has been completed, we need to update the azure
+	// status and quit the program.
+	if model.currentCodeBlock == len(model.codeBlockState) {
+		model.scenarioCompleted = true
+		model.azureStatus.Status = "Succeeded"
+		environments.AttachResourceURIsToAzureStatus(
+			model.executor,
+			&model.azureStatus,
+			model.resourceGroupName,
+			model.environment,
+		)
+
+		environmentVariables, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		if err != nil {
+			logging.GlobalLogger.Errorf("Failed to load environment state file: %s", err)
+			model.azureStatus.SetError(err)
+		}
+
+		model.azureStatus.ConfigureMarkdownForDownload(
+			model.markdownSource,
+			environmentVariables,
+			model.environment,
+		)
+		model.azureStatus.SetOutput(strings.Join(model.CommandLines, "\n"))
+		commands = append(
+			commands,
+			tea.Sequence(
+				tui.UpdateAzureStatus(model.azureStatus, model.environment),
+				tea.Quit,
+			),
+		)
+	} else {
+		commands = append(
+			commands,
+			tea.Sequence(
+				tui.UpdateAzureStatus(model.azureStatus, model.environment),
+				// Send a key event to trigger
+				func() tea.Msg {
+					if model.stepsToBeExecuted <= 0 {
+						return nil
+					}
+					return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}}
+				},
+			),
+		)
+	}
+
+	return model, commands
+}
+
 // Shows the commands that the user can use to interact with the interactive
 // mode model.
 func (model InteractiveModeModel) helpView() string {
@@ -575,7 +629,9 @@ func (model InteractiveModeModel) View() string {
 
 	var executing string
 
-	if model.executingCommand {
+	if model.executingCommand && model.waitProgress != "" {
+		executing = secrets.MaskString(model.waitProgress)
+	} else if model.executingCommand {
 		executing = "Executing command..."
 	} else {
 		executing = ""
@@ -590,7 +646,18 @@ func (model InteractiveModeModel) View() string {
 		("\n" + executing)
 }
 
-// Create a new interactive mode model.
+// Gets the content of a code block to show, with the values of the variables
+// it references when renderValues is set.
+func displayedContent(block parsers.CodeBlock, env map[string]string, renderValues bool) string {
+	if !renderValues {
+		return block.Content
+	}
+	return common.RenderValues(block, env)
+}
+
+// Create a new interactive mode model. Code blocks skipped by the filter are
+// shown but not executed, and renderValues shows code blocks with the values
+// of the variables they reference.
 func NewInteractiveModeModel(
 	title string,
 	subscription string,
@@ -598,6 +665,9 @@ func NewInteractiveModeModel(
 	steps []common.Step,
 	env map[string]string,
 	markdownSource string,
+	filter common.BlockFilter,
+	renderValues bool,
+	executor shells.Executor,
 ) (InteractiveModeModel, error) {
 	// TODO: In the future we should just set the current step for the azure status
 	// to one as the default.
@@ -606,7 +676,7 @@ func NewInteractiveModeModel(
 	totalCodeBlocks := 0
 	codeBlockState := make(map[int]common.StatefulCodeBlock)
 
-	err := az.SetSubscription(subscription)
+	err := az.SetSubscription(executor, subscription)
 	if err != nil {
 		logging.GlobalLogger.Errorf("Invalid Config: Failed to set subscription: %s", err)
 		azureStatus.SetError(err)
@@ -631,6 +701,7 @@ func NewInteractiveModeModel(
 				StdErr:          "",
 				Error:           nil,
 				Success:         false,
+				Skipped:         filter.IsSkipped(step, stepNumber, blockNumber),
 			}
 
 			totalCodeBlocks += 1
@@ -638,9 +709,9 @@ func NewInteractiveModeModel(
 		azureStatus.AddStep(fmt.Sprintf("%d. %s", stepNumber+1, step.Name), azureCodeBlocks)
 	}
 
-	language := codeBlockState[0].CodeBlock.Language
 	commandLines := []string{
-		ui.CommandPrompt(language) + codeBlockState[0].CodeBlock.Content,
+		tui.CodeBlockPrompt(codeBlockState[0].CodeBlock) +
+			displayedContent(codeBlockState[0].CodeBlock, env, renderValues),
 	}
 
 	// Configure extra keybinds used for executing the many/all commands.
@@ -692,9 +763,11 @@ func NewInteractiveModeModel(
 		currentCodeBlock:  0,
 		help:              help.New(),
 		environment:       environment,
+		executor:          executor,
 		scenarioCompleted: false,
 		ready:             false,
 		markdownSource:    markdownSource,
+		renderValues:      renderValues,
 		CommandLines:      commandLines,
 	}, nil
 }
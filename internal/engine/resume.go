@@ -0,0 +1,120 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/ui"
+)
+
+// Where to start a scenario from and the directory to run it in.
+type startingPoint struct {
+	position         common.CodeBlockPosition
+	workingDirectory string
+}
+
+// Determines where to start the scenario from based on --resume and
+// --from-step. When a checkpoint is used, the environment captured by it is
+// restored so that the code blocks that follow can rely on the state created
+// by the ones before them. Returns the warnings to show the user.
+func (e *Engine) restoreCheckpoint(scenario *common.Scenario) (startingPoint, []string, error) {
+	start := startingPoint{workingDirectory: e.Configuration.WorkingDirectory}
+	var warnings []string
+
+	if !e.Configuration.Resume && e.Configuration.FromStep == 0 {
+		return start, nil, nil
+	}
+
+	if e.Configuration.Resume && e.Configuration.FromStep != 0 {
+		return start, nil, fmt.Errorf("--resume and --from-step can't be used together")
+	}
+
+	if e.Configuration.FromStep < 0 || e.Configuration.FromStep > len(scenario.Steps) {
+		return start, nil, fmt.Errorf(
+			"--from-step must be between 1 and %d, the number of steps in the scenario",
+			len(scenario.Steps),
+		)
+	}
+
+	checkpoint, err := common.LoadCheckpoint(scenario)
+	if err != nil {
+		return start, nil, err
+	}
+
+	if e.Configuration.Resume {
+		if checkpoint == nil {
+			return start, nil, fmt.Errorf(
+				"there is no checkpoint to resume '%s' from. Checkpoints are written after each successful code block",
+				scenario.Path,
+			)
+		}
+		start.position = checkpoint.LastCodeBlock.Next(scenario.Steps)
+		if start.position.StepNumber >= len(scenario.Steps) {
+			return start, nil, fmt.Errorf(
+				"the checkpoint for '%s' shows that every code block already succeeded",
+				scenario.Path,
+			)
+		}
+	} else {
+		start.position = common.CodeBlockPosition{StepNumber: e.Configuration.FromStep - 1}
+
+		if checkpoint == nil {
+			warnings = append(warnings, fmt.Sprintf(
+				"There is no checkpoint for this scenario, so step %d will start without the state created by the steps before it.",
+				e.Configuration.FromStep,
+			))
+		} else if checkpoint.LastCodeBlock.Next(scenario.Steps).IsBefore(start.position) {
+			warnings = append(warnings, fmt.Sprintf(
+				"The checkpoint only reaches step %d, so the state created by the steps up to step %d will be missing.",
+				checkpoint.LastCodeBlock.StepNumber+1,
+				e.Configuration.FromStep-1,
+			))
+		}
+	}
+
+	if checkpoint == nil {
+		return start, warnings, nil
+	}
+
+	if checkpoint.MarkdownHash != common.HashMarkdown(scenario.Source) {
+		warnings = append(warnings, fmt.Sprintf(
+			"The markdown of the scenario has changed since the checkpoint was written at %s. The steps may no longer line up with it.",
+			checkpoint.CreatedAt.Format("2006-01-02 15:04:05"),
+		))
+	}
+
+	err = lib.WriteEnvironmentStateFile(
+		lib.DefaultEnvironmentStateFile,
+		checkpoint.EnvironmentVariables,
+	)
+	if err != nil {
+		return start, nil, fmt.Errorf("failed to restore the environment from the checkpoint: %w", err)
+	}
+
+	if checkpoint.WorkingDirectory != "" {
+		start.workingDirectory = checkpoint.WorkingDirectory
+	}
+
+	logging.GlobalLogger.Infof(
+		"Restored the checkpoint written after step %d, code block %d. Starting from step %d, code block %d in %s",
+		checkpoint.LastCodeBlock.StepNumber+1,
+		checkpoint.LastCodeBlock.CodeBlockNumber+1,
+		start.position.StepNumber+1,
+		start.position.CodeBlockNumber+1,
+		start.workingDirectory,
+	)
+
+	return start, warnings, nil
+}
+
+// Renders the warnings produced when restoring a checkpoint.
+func renderWarnings(warnings []string) string {
+	rendered := ""
+	for _, warning := range warnings {
+		logging.GlobalLogger.Warn(warning)
+		rendered += ui.WarningStyle.Render("Warning: "+warning) + "\n"
+	}
+	return rendered
+}
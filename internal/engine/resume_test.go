@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestoreCheckpoint(t *testing.T) {
+	originalCheckpointDirectory := common.DefaultCheckpointDirectory
+	originalEnvironmentStateFile := lib.DefaultEnvironmentStateFile
+	defer func() {
+		common.DefaultCheckpointDirectory = originalCheckpointDirectory
+		lib.DefaultEnvironmentStateFile = originalEnvironmentStateFile
+	}()
+
+	directory := t.TempDir()
+	common.DefaultCheckpointDirectory = filepath.Join(directory, "checkpoints")
+	lib.DefaultEnvironmentStateFile = filepath.Join(directory, "env-vars")
+
+	scenario := &common.Scenario{
+		Path:   filepath.Join(directory, "scenario.md"),
+		Source: []byte("# Scenario"),
+		Steps: []common.Step{
+			{Name: "First", CodeBlocks: []parsers.CodeBlock{{}, {}}},
+			{Name: "Second", CodeBlocks: []parsers.CodeBlock{{}}},
+			{Name: "Third", CodeBlocks: []parsers.CodeBlock{{}}},
+		},
+	}
+
+	engineWith := func(resume bool, fromStep int) *Engine {
+		return &Engine{Configuration: EngineConfiguration{
+			WorkingDirectory: ".",
+			Resume:           resume,
+			FromStep:         fromStep,
+		}}
+	}
+
+	t.Run("Start from the beginning by default", func(t *testing.T) {
+		start, warnings, err := engineWith(false, 0).restoreCheckpoint(scenario)
+
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+		assert.Equal(t, common.CodeBlockPosition{}, start.position)
+		assert.Equal(t, ".", start.workingDirectory)
+	})
+
+	t.Run("Resuming requires a checkpoint", func(t *testing.T) {
+		_, _, err := engineWith(true, 0).restoreCheckpoint(scenario)
+		assert.Error(t, err)
+	})
+
+	t.Run("Starting from a step without a checkpoint warns", func(t *testing.T) {
+		start, warnings, err := engineWith(false, 2).restoreCheckpoint(scenario)
+
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 1)
+		assert.Equal(t, common.CodeBlockPosition{StepNumber: 1}, start.position)
+	})
+
+	t.Run("Steps out of range are an error", func(t *testing.T) {
+		_, _, err := engineWith(false, 4).restoreCheckpoint(scenario)
+		assert.Error(t, err)
+
+		_, _, err = engineWith(true, 2).restoreCheckpoint(scenario)
+		assert.Error(t, err)
+	})
+
+	lib.WriteEnvironmentStateFile(lib.DefaultEnvironmentStateFile, map[string]string{"MY_GROUP": "my-group"})
+	writer := common.NewCheckpointWriter(scenario)
+	assert.NoError(t, writer.Save(common.CodeBlockPosition{StepNumber: 0, CodeBlockNumber: 1}))
+	lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+	t.Run("Resume after the last successful code block", func(t *testing.T) {
+		start, warnings, err := engineWith(true, 0).restoreCheckpoint(scenario)
+
+		assert.NoError(t, err)
+		assert.Empty(t, warnings)
+		assert.Equal(t, common.CodeBlockPosition{StepNumber: 1}, start.position)
+
+		environment, err := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "my-group", environment["MY_GROUP"])
+	})
+
+	t.Run("Warn when the checkpoint doesn't reach the step", func(t *testing.T) {
+		_, warnings, err := engineWith(false, 3).restoreCheckpoint(scenario)
+
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 1)
+	})
+
+	t.Run("Warn when the markdown changed", func(t *testing.T) {
+		changed := *scenario
+		changed.Source = []byte("# Changed scenario")
+
+		_, warnings, err := engineWith(true, 0).restoreCheckpoint(&changed)
+
+		assert.NoError(t, err)
+		assert.Len(t, warnings, 1)
+		assert.Contains(t, warnings[0], "markdown of the scenario has changed")
+	})
+}
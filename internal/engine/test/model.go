@@ -2,13 +2,16 @@ package test
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/Azure/InnovationEngine/internal/az"
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
 	"github.com/Azure/InnovationEngine/internal/lib"
 	"github.com/Azure/InnovationEngine/internal/logging"
 	"github.com/Azure/InnovationEngine/internal/patterns"
+	"github.com/Azure/InnovationEngine/internal/secrets"
 	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/Azure/InnovationEngine/internal/ui"
 	"github.com/charmbracelet/bubbles/help"
@@ -28,13 +31,18 @@ type TestModeModel struct {
 	currentCodeBlock     int
 	environmentVariables map[string]string
 	environment          string
+	executor             shells.Executor
 	help                 help.Model
 	resourceGroupName    string
 	scenarioTitle        string
 	scenarioCompleted    bool
 	components           testModeComponents
 	ready                bool
-	CommandLines         []string
+	checkpoints          *common.CheckpointWriter
+	// How waiting for something to be ready is going for the code block that
+	// is running, if it waits.
+	waitProgress string
+	CommandLines []string
 }
 
 // Obtains the last codeblock that the scenario was on before it failed.
@@ -65,9 +73,17 @@ func (model TestModeModel) GetEnvironment() string {
 
 // Get the code blocks that were executed in the scenario.
 func (model TestModeModel) GetCodeBlocks() []common.StatefulCodeBlock {
+	// The state is keyed by the position of the code block in the scenario, so
+	// sorting the keys keeps the code blocks in the order they are run.
+	var indices []int
+	for index := range model.codeBlockState {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
 	var codeBlocks []common.StatefulCodeBlock
-	for _, codeBlock := range model.codeBlockState {
-		codeBlocks = append(codeBlocks, codeBlock)
+	for _, index := range indices {
+		codeBlocks = append(codeBlocks, model.codeBlockState[index])
 	}
 	return codeBlocks
 }
@@ -82,10 +98,17 @@ func (model TestModeModel) GetDeclaredEnvironmentVariables() map[string]string {
 
 // Init the test mode model by executing the first code block.
 func (model TestModeModel) Init() tea.Cmd {
-	return common.ExecuteCodeBlockAsync(
-		model.codeBlockState[model.currentCodeBlock].CodeBlock,
-		model.environmentVariables,
-	)
+	return model.runCurrentCodeBlock()
+}
+
+// Executes the current code block, or skips it if it was filtered out.
+func (model TestModeModel) runCurrentCodeBlock() tea.Cmd {
+	codeBlockState := model.codeBlockState[model.currentCodeBlock]
+	if codeBlockState.Skipped {
+		return tui.SkipCodeBlock(codeBlockState)
+	}
+
+	return tui.ExecuteCodeBlockAsync(model.executor, codeBlockState, model.environmentVariables)
 }
 
 // Update the test mode model.
@@ -108,8 +131,12 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		model, commands = handleUserInput(model, message)
 
-	case common.SuccessfulCommandMessage:
+	case tui.WaitProgressMessage:
+		model.waitProgress = message.Message
+
+	case tui.SuccessfulCommandMessage:
 		// Handle successful command executions
+		model.waitProgress = ""
 		step := model.currentCodeBlock
 
 		// Update the state of the codeblock which finished executing.
@@ -118,10 +145,21 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.StdErr = message.StdErr
 		codeBlockState.Success = true
 		codeBlockState.SimilarityScore = message.SimilarityScore
+		codeBlockState.DurationSeconds = message.Duration.Seconds()
+		codeBlockState.Captured = message.Captured
+		codeBlockState.Variables = message.Variables
 		model.codeBlockState[step] = codeBlockState
 
 		logging.GlobalLogger.Infof("Finished executing:\n %s", codeBlockState.CodeBlock.Content)
 
+		err := model.checkpoints.Save(common.CodeBlockPosition{
+			StepNumber:      codeBlockState.StepNumber,
+			CodeBlockNumber: codeBlockState.CodeBlockNumber,
+		})
+		if err != nil {
+			logging.GlobalLogger.Warnf("Failed to save a checkpoint: %s", err)
+		}
+
 		// Extract the resource group name from the command output if
 		// it's not already set.
 		if model.resourceGroupName == "" && patterns.AzCommand.MatchString(codeBlockState.CodeBlock.Content) {
@@ -138,52 +176,20 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		)
 		viewportContentUpdated = true
 
-		// Increment the codeblock and update the viewport content.
-		model.currentCodeBlock++
-
-		if model.currentCodeBlock < len(model.codeBlockState) {
-			nextTitle := model.codeBlockState[model.currentCodeBlock].StepName
-			nextCommand := model.codeBlockState[model.currentCodeBlock].CodeBlock.Content
-			nextLanguage := model.codeBlockState[model.currentCodeBlock].CodeBlock.Language
-
-			// Only add the title if the next step title is different from the current step.
-			if codeBlockState.StepName != nextTitle {
-				model.CommandLines = append(
-					model.CommandLines,
-					ui.StepTitleStyle.Render(
-						fmt.Sprintf("Step %d: %s", model.currentCodeBlock+1, nextTitle),
-					)+"\n",
-				)
-			}
+		model, commands = model.advance(commands)
 
-			model.CommandLines = append(
-				model.CommandLines,
-				ui.CommandPrompt(nextLanguage)+nextCommand,
-			)
-		}
+	case tui.SkippedCommandMessage:
+		codeBlockState := model.codeBlockState[model.currentCodeBlock]
+		logging.GlobalLogger.Infof("Skipped:\n %s", codeBlockState.CodeBlock.Content)
 
-		// Only increment the step for azure if the step name has changed.
-		nextCodeBlockState := model.codeBlockState[model.currentCodeBlock]
+		model.CommandLines = append(model.CommandLines, ui.SkippedStyle.Render("Skipped"))
+		viewportContentUpdated = true
 
-		// If the scenario has been completed, we need to update the azure
-		// status and quit the program. else,
-		if model.currentCodeBlock == len(model.codeBlockState) {
-			logging.GlobalLogger.Infof("The last codeblock was executed. Requesting to exit test mode...")
-			commands = append(
-				commands,
-				common.Exit(false),
-			)
+		model, commands = model.advance(commands)
 
-		} else {
-			// If the scenario has not been completed, we need to execute the next command
-			commands = append(
-				commands,
-				common.ExecuteCodeBlockAsync(nextCodeBlockState.CodeBlock, model.environmentVariables),
-			)
-		}
-
-	case common.FailedCommandMessage:
+	case tui.FailedCommandMessage:
 		// Handle failed command executions
+		model.waitProgress = ""
 
 		// Update the state of the codeblock which finished executing.
 		step := model.currentCodeBlock
@@ -193,6 +199,8 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		codeBlockState.Error = message.Error
 		codeBlockState.Success = false
 		codeBlockState.SimilarityScore = message.SimilarityScore
+		codeBlockState.DurationSeconds = message.Duration.Seconds()
+		codeBlockState.Variables = message.Variables
 
 		model.codeBlockState[step] = codeBlockState
 		model.CommandLines = append(
@@ -201,9 +209,9 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 		)
 		viewportContentUpdated = true
 
-		commands = append(commands, common.Exit(true))
+		commands = append(commands, tui.Exit(true))
 
-	case common.ExitMessage:
+	case tui.ExitMessage:
 		// TODO: Generate test report
 
 		// Delete any found resource groups.
@@ -217,9 +225,9 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 			)
 			logging.GlobalLogger.Infof("Attempting to delete the deployed resource group with the name: %s", model.resourceGroupName)
 			command := fmt.Sprintf("az group delete --name %s --yes --no-wait", model.resourceGroupName)
-			_, err := shells.ExecuteBashCommand(
+			_, err := model.executor.Execute(
 				command,
-				shells.BashCommandConfiguration{
+				shells.CommandConfiguration{
 					EnvironmentVariables: lib.CopyMap(model.environmentVariables),
 					InheritEnvironment:   true,
 					InteractiveCommand:   false,
@@ -243,7 +251,9 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 
 	}
 
-	model.components.commandViewport.SetContent(strings.Join(model.CommandLines, "\n"))
+	model.components.commandViewport.SetContent(
+		secrets.MaskString(strings.Join(model.CommandLines, "\n")),
+	)
 
 	if viewportContentUpdated {
 		model.components.commandViewport.GotoBottom()
@@ -258,23 +268,70 @@ func (model TestModeModel) Update(message tea.Msg) (tea.Model, tea.Cmd) {
 	return model, tea.Batch(commands...)
 }
 
+// Moves on to the code block after the current one, or exits once the last
+// code block has finished.
+func (model TestModeModel) advance(commands []tea.Cmd) (TestModeModel, []tea.Cmd) {
+	codeBlockState := model.codeBlockState[model.currentCodeBlock]
+
+	// Increment the codeblock and update the viewport content.
+	model.currentCodeBlock++
+
+	// If the scenario has been completed, we need to update the azure
+	// status and quit the program.
+	if model.currentCodeBlock == len(model.codeBlockState) {
+		logging.GlobalLogger.Infof("The last codeblock was executed. Requesting to exit test mode...")
+		if err := model.checkpoints.Clear(); err != nil {
+			logging.GlobalLogger.Warnf("Failed to clear the checkpoint: %s", err)
+		}
+		return model, append(commands, tui.Exit(false))
+	}
+
+	next := model.codeBlockState[model.currentCodeBlock]
+
+	// Only add the title if the next step title is different from the current step.
+	if codeBlockState.StepName != next.StepName {
+		model.CommandLines = append(
+			model.CommandLines,
+			ui.StepTitleStyle.Render(
+				fmt.Sprintf("Step %d: %s", next.StepNumber+1, next.StepName),
+			)+"\n",
+		)
+	}
+
+	model.CommandLines = append(
+		model.CommandLines,
+		tui.CodeBlockPrompt(next.CodeBlock)+next.CodeBlock.Content,
+	)
+
+	// If the scenario has not been completed, we need to execute the next command
+	return model, append(commands, model.runCurrentCodeBlock())
+}
+
 // View the test mode model.
 func (model TestModeModel) View() string {
+	if model.waitProgress != "" {
+		return model.components.commandViewport.View() + "\n" +
+			ui.SpinnerStyle.Render(secrets.MaskString(model.waitProgress))
+	}
 	return model.components.commandViewport.View()
 }
 
-// Create a new test mode model.
+// Create a new test mode model. Code blocks skipped by the filter are not
+// executed and a checkpoint is saved after each successful code block.
 func NewTestModeModel(
 	title string,
 	subscription string,
 	environment string,
 	steps []common.Step,
 	env map[string]string,
+	filter common.BlockFilter,
+	checkpoints *common.CheckpointWriter,
+	executor shells.Executor,
 ) (TestModeModel, error) {
 	totalCodeBlocks := 0
 	codeBlockState := make(map[int]common.StatefulCodeBlock)
 
-	err := az.SetSubscription(subscription)
+	err := az.SetSubscription(executor, subscription)
 	if err != nil {
 		logging.GlobalLogger.Errorf("Invalid Config: Failed to set subscription: %s", err)
 		return TestModeModel{}, err
@@ -289,7 +346,6 @@ func NewTestModeModel(
 	// Interactive mode and test mode in the future.
 	for stepNumber, step := range steps {
 		for blockNumber, block := range step.CodeBlocks {
-
 			codeBlockState[totalCodeBlocks] = common.StatefulCodeBlock{
 				StepName:        step.Name,
 				CodeBlock:       block,
@@ -299,17 +355,20 @@ func NewTestModeModel(
 				StdErr:          "",
 				Error:           nil,
 				Success:         false,
+				Skipped:         filter.IsSkipped(step, stepNumber, blockNumber),
 			}
 
 			totalCodeBlocks += 1
 		}
 	}
 
-	language := codeBlockState[0].CodeBlock.Language
+	firstCodeBlock := codeBlockState[0]
 	commandLines := []string{
 		ui.ScenarioTitleStyle.Render(title) + "\n",
-		ui.StepTitleStyle.Render("Step 1: "+codeBlockState[0].StepName) + "\n",
-		ui.CommandPrompt(language) + codeBlockState[0].CodeBlock.Content,
+		ui.StepTitleStyle.Render(
+			fmt.Sprintf("Step %d: %s", firstCodeBlock.StepNumber+1, firstCodeBlock.StepName),
+		) + "\n",
+		tui.CodeBlockPrompt(firstCodeBlock.CodeBlock) + firstCodeBlock.CodeBlock.Content,
 	}
 
 	return TestModeModel{
@@ -326,8 +385,10 @@ func NewTestModeModel(
 		currentCodeBlock:     0,
 		help:                 help.New(),
 		environment:          environment,
+		executor:             executor,
 		scenarioCompleted:    false,
 		ready:                false,
+		checkpoints:          checkpoints,
 		CommandLines:         commandLines,
 	}, nil
 }
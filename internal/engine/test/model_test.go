@@ -1,26 +1,45 @@
 package test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/tui"
 	"github.com/Azure/InnovationEngine/internal/parsers"
 	"github.com/Azure/InnovationEngine/internal/shells"
 	"github.com/stretchr/testify/assert"
 )
 
+// Returns an executor that runs commands with bash, except for azure-cli
+// commands, which are recorded instead of run.
+func recordAzureCommands() (shells.Executor, *[]string) {
+	commands := []string{}
+	executor := shells.ExecutorFunc(func(
+		command string,
+		config shells.CommandConfiguration,
+	) (shells.CommandOutput, error) {
+		if strings.HasPrefix(command, "az ") {
+			commands = append(commands, command)
+			return shells.CommandOutput{}, nil
+		}
+		return shells.BashExecutor{}.Execute(command, config)
+	})
+	return executor, &commands
+}
+
 // This suite of tests is responsible for ensuring that the model around test mode
 // is well defined and behaves as expected.
 func TestTestModeModel(t *testing.T) {
 	t.Run("Initializing a test model with an invalid subscription fails.", func(t *testing.T) {
 		// Test the initialization of the test mode model.
-		_, err := NewTestModeModel("test", "invalid", "test", nil, nil)
+		_, err := NewTestModeModel("test", "invalid", "test", nil, nil, common.BlockFilter{}, nil, shells.BashExecutor{})
 		assert.Error(t, err)
 	})
 
 	t.Run("Creating a valid test model works.", func(t *testing.T) {
 		// Test the initialization of the test mode model.
-		model, err := NewTestModeModel("test", "", "test", nil, nil)
+		model, err := NewTestModeModel("test", "", "test", nil, nil, common.BlockFilter{}, nil, shells.BashExecutor{})
 		assert.NoError(t, err)
 
 		assert.Equal(t, "test", model.scenarioTitle)
@@ -45,7 +64,7 @@ func TestTestModeModel(t *testing.T) {
 			},
 		}
 
-		model, err := NewTestModeModel("test", "", "test", steps, nil)
+		model, err := NewTestModeModel("test", "", "test", steps, nil, common.BlockFilter{}, nil, shells.BashExecutor{})
 		assert.NoError(t, err)
 
 		assert.Equal(t, 0, model.currentCodeBlock)
@@ -76,7 +95,7 @@ func TestTestModeModel(t *testing.T) {
 				},
 			}
 
-			model, err := NewTestModeModel("test", "", "test", steps, nil)
+			model, err := NewTestModeModel("test", "", "test", steps, nil, common.BlockFilter{}, nil, shells.BashExecutor{})
 			assert.NoError(t, err)
 
 			m, _ := model.Update(model.Init()())
@@ -109,7 +128,8 @@ func TestTestModeModel(t *testing.T) {
 				},
 			}
 
-			model, err := NewTestModeModel("test", "", "test", steps, nil)
+			executor, azureCommands := recordAzureCommands()
+			model, err := NewTestModeModel("test", "", "test", steps, nil, common.BlockFilter{}, nil, executor)
 
 			assert.NoError(t, err)
 
@@ -131,24 +151,10 @@ func TestTestModeModel(t *testing.T) {
 
 			// Assert that the model doesn't try to delete the resource group when
 			// the resource group name is empty.
-			m, _ = model.Update(common.Exit(false)())
-			counter := 0
-
-			// We create a mock function to replace the shells.ExecuteBashCommand function
-			// to make sure that the function is not called.
-			original := shells.ExecuteBashCommand
-			defer func() { shells.ExecuteBashCommand = original }()
-
-			shells.ExecuteBashCommand = func(
-				command string,
-				config shells.BashCommandConfiguration,
-			) (shells.CommandOutput, error) {
-				counter += 1
-				return shells.CommandOutput{}, nil
-			}
+			m, _ = model.Update(tui.Exit(false)())
 
 			if model, ok := m.(TestModeModel); ok {
-				assert.Equal(t, 0, counter)
+				assert.Empty(t, *azureCommands)
 				assert.Equal(t, true, model.scenarioCompleted)
 			} else {
 				assert.Fail(t, "Model is not a TestModeModel")
@@ -171,7 +177,8 @@ func TestTestModeModel(t *testing.T) {
 				},
 			}
 
-			model, err := NewTestModeModel("test", "", "test", steps, nil)
+			executor, azureCommands := recordAzureCommands()
+			model, err := NewTestModeModel("test", "", "test", steps, nil, common.BlockFilter{}, nil, executor)
 
 			assert.NoError(t, err)
 
@@ -196,32 +203,51 @@ func TestTestModeModel(t *testing.T) {
 
 			// Assert that the model tries to delete the resource group when
 			// the resource group name is not empty.
-			counter := 0
-			recordedCommand := ""
-
-			// We create a mock function to replace the shells.ExecuteBashCommand function
-			// to make sure that the function is called.
-			original := shells.ExecuteBashCommand
-			defer func() { shells.ExecuteBashCommand = original }()
-
-			shells.ExecuteBashCommand = func(
-				command string,
-				config shells.BashCommandConfiguration,
-			) (shells.CommandOutput, error) {
-				recordedCommand = command
-				counter += 1
-				return shells.CommandOutput{}, nil
-			}
-
-			m, _ = model.Update(common.Exit(false)())
+			m, _ = model.Update(tui.Exit(false)())
 
 			if model, ok = m.(TestModeModel); ok {
-				assert.Equal(t, 1, counter)
-				assert.Equal(t, "az group delete --name test --yes --no-wait", recordedCommand)
+				assert.Equal(t, []string{"az group delete --name test --yes --no-wait"}, *azureCommands)
 				assert.Equal(t, true, model.scenarioCompleted)
 			} else {
 				assert.Fail(t, "Model is not a TestModeModel")
 			}
 		},
 	)
+
+	t.Run(
+		"Test mode skips the code blocks filtered out by the selectors.",
+		func(t *testing.T) {
+			steps := []common.Step{
+				{
+					Name: "step1",
+					CodeBlocks: []parsers.CodeBlock{
+						{Header: "header1", Content: "echo 'skipped'", Tags: []string{"cleanup"}},
+						{Header: "header1", Content: "echo 'hello world'"},
+					},
+				},
+			}
+
+			filter, err := common.NewBlockFilter(nil, []string{"tag:cleanup"})
+			assert.NoError(t, err)
+
+			model, err := NewTestModeModel("test", "", "test", steps, nil, filter, nil, shells.BashExecutor{})
+			assert.NoError(t, err)
+			assert.Equal(t, true, model.codeBlockState[0].Skipped)
+			assert.Equal(t, false, model.codeBlockState[1].Skipped)
+
+			m, _ := model.Update(model.Init()())
+			model, ok := m.(TestModeModel)
+			assert.True(t, ok)
+			assert.Equal(t, 1, model.currentCodeBlock)
+			assert.Equal(t, "", model.codeBlockState[0].StdOut)
+			assert.Equal(t, false, model.codeBlockState[0].Success)
+
+			m, _ = model.Update(model.runCurrentCodeBlock()())
+			model, ok = m.(TestModeModel)
+			assert.True(t, ok)
+			assert.Equal(t, 2, model.currentCodeBlock)
+			assert.Equal(t, "hello world\n", model.codeBlockState[1].StdOut)
+			assert.Equal(t, true, model.codeBlockState[1].Success)
+		},
+	)
 }
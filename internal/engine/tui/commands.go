@@ -0,0 +1,187 @@
+// The commands and messages shared by the bubbletea models of the test and
+// interactive modes.
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/engine/environments"
+	"github.com/Azure/InnovationEngine/internal/engine/events"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/parsers"
+	"github.com/Azure/InnovationEngine/internal/shells"
+	"github.com/Azure/InnovationEngine/internal/ui"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Emitted when a command has been executed successfully.
+type SuccessfulCommandMessage struct {
+	StdOut          string
+	StdErr          string
+	SimilarityScore float64
+	Duration        time.Duration
+	Captured        map[string]string
+	Variables       map[string]string
+}
+
+// Emitted when a command has failed to execute.
+type FailedCommandMessage struct {
+	StdOut          string
+	StdErr          string
+	Error           error
+	SimilarityScore float64
+	Duration        time.Duration
+	Variables       map[string]string
+}
+
+// Emitted instead of executing a code block that was skipped by the --only
+// and --skip selectors.
+type SkippedCommandMessage struct{}
+
+// Emitted while a code block waits for something to be ready, with how the
+// wait is going.
+type WaitProgressMessage struct {
+	Message string
+}
+
+// Returns a command that skips the current code block.
+func SkipCodeBlock(block common.StatefulCodeBlock) tea.Cmd {
+	return func() tea.Msg {
+		common.PublishCodeBlockSkipped(block)
+		return SkippedCommandMessage{}
+	}
+}
+
+type ExitMessage struct {
+	EncounteredFailure bool
+}
+
+func Exit(encounteredFailure bool) tea.Cmd {
+	return func() tea.Msg {
+		return ExitMessage{EncounteredFailure: encounteredFailure}
+	}
+}
+
+// Executes a bash command and returns a tea message with the output. This function
+// will be executed asycnhronously.
+func ExecuteCodeBlockAsync(
+	executor shells.Executor,
+	block common.StatefulCodeBlock,
+	env map[string]string,
+) tea.Cmd {
+	return func() tea.Msg {
+		logging.GlobalLogger.Infof(
+			"Executing command asynchronously:\n %s", block.CodeBlock.Content)
+
+		// Forward how waiting for something to be ready is going to the model.
+		unsubscribe := common.Events.Subscribe(func(event events.Event) {
+			if event.Type == events.WaitProgress && Program != nil {
+				Program.Send(WaitProgressMessage{Message: event.Data})
+			}
+		})
+		result := common.RunCodeBlock(executor, block, shells.CommandConfiguration{
+			EnvironmentVariables: env,
+			InheritEnvironment:   true,
+			InteractiveCommand:   false,
+			WriteToHistory:       true,
+		})
+		unsubscribe()
+
+		if result.Error != nil {
+			return FailedCommandMessage{
+				StdOut:          result.StdOut,
+				StdErr:          result.StdErr,
+				Error:           result.Error,
+				SimilarityScore: result.SimilarityScore,
+				Duration:        result.Duration,
+				Variables:       result.Variables,
+			}
+		}
+
+		logging.GlobalLogger.Infof("Command output to stdout:\n %s", result.StdOut)
+		return SuccessfulCommandMessage{
+			StdOut:          result.StdOut,
+			StdErr:          result.StdErr,
+			SimilarityScore: result.SimilarityScore,
+			Duration:        result.Duration,
+			Captured:        result.Captured,
+			Variables:       result.Variables,
+		}
+	}
+}
+
+// Executes a bash command syncrhonously. This function will block until the command
+// finishes executing.
+func ExecuteCodeBlockSync(
+	executor shells.Executor,
+	block common.StatefulCodeBlock,
+	env map[string]string,
+) tea.Msg {
+	logging.GlobalLogger.Info("Executing command synchronously: ", block.CodeBlock.Content)
+	Program.ReleaseTerminal()
+
+	result := common.RunCodeBlock(executor, block, shells.CommandConfiguration{
+		EnvironmentVariables: env,
+		InheritEnvironment:   true,
+		InteractiveCommand:   true,
+		WriteToHistory:       true,
+	})
+
+	Program.RestoreTerminal()
+
+	if result.Error != nil {
+		return FailedCommandMessage{
+			StdOut:    result.StdOut,
+			StdErr:    result.StdErr,
+			Error:     result.Error,
+			Duration:  result.Duration,
+			Variables: result.Variables,
+		}
+	}
+
+	logging.GlobalLogger.Infof("Command output to stdout:\n %s", result.StdOut)
+	return SuccessfulCommandMessage{
+		StdOut:    result.StdOut,
+		StdErr:    result.StdErr,
+		Duration:  result.Duration,
+		Variables: result.Variables,
+	}
+}
+
+// clearScreen returns a command that clears the terminal screen and positions the cursor at the top-left corner
+func ClearScreen() tea.Cmd {
+	return func() tea.Msg {
+		fmt.Print(
+			"\033[H\033[2J",
+		) // ANSI escape codes for clearing the screen and repositioning the cursor
+		return nil
+	}
+}
+
+// Updates the azure status with the current state of the interactive mode
+// model.
+func UpdateAzureStatus(azureStatus environments.AzureDeploymentStatus, environment string) tea.Cmd {
+	return func() tea.Msg {
+		logging.GlobalLogger.Tracef(
+			"Attempting to update the azure status: %+v",
+			azureStatus,
+		)
+		environments.ReportAzureStatus(azureStatus, environment)
+		return AzureStatusUpdatedMessage{}
+	}
+}
+
+// Empty struct used to indicate that the azure status has been updated so
+// that we can respond to it within the Update() function.
+type AzureStatusUpdatedMessage struct{}
+
+// The prompt shown before the content of a code block, which names the file
+// the code block is written to if it has one.
+func CodeBlockPrompt(block parsers.CodeBlock) string {
+	if path := block.File(); path != "" {
+		return ui.FilePrompt(block.Language, path)
+	}
+	return ui.CommandPrompt(block.Language)
+}
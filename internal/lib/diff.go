@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"strings"
+
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
@@ -10,3 +12,47 @@ func GetDifferenceBetweenStrings(a, b string) string {
 	diffs := dmp.DiffMain(a, b, false)
 	return dmp.DiffPrettyText(diffs)
 }
+
+// Gets the difference between two strings as HTML, with the text that was
+// removed from a in <del> and the text that was added in b in <ins>. The text
+// is escaped, so the result can be embedded in a page as is.
+func GetHTMLDifferenceBetweenStrings(a, b string) string {
+	dmp := diffmatchpatch.New()
+
+	diffs := dmp.DiffCleanupSemantic(dmp.DiffMain(a, b, false))
+	return dmp.DiffPrettyHtml(diffs)
+}
+
+// Gets a line by line diff from expected to actual, prefixing removed lines
+// with "-", added lines with "+" and unchanged lines with a space. Unlike
+// GetDifferenceBetweenStrings, the result doesn't contain any colors so that it
+// can be written to files.
+func GetLineDiffBetweenStrings(expected, actual string) string {
+	dmp := diffmatchpatch.New()
+
+	expectedChars, actualChars, lines := dmp.DiffLinesToChars(expected, actual)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(expectedChars, actualChars, false), lines)
+
+	var result strings.Builder
+	for _, diff := range diffs {
+		prefix := " "
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		}
+
+		for _, line := range strings.SplitAfter(diff.Text, "\n") {
+			if line == "" {
+				continue
+			}
+			result.WriteString(prefix + line)
+			if !strings.HasSuffix(line, "\n") {
+				result.WriteString("\n")
+			}
+		}
+	}
+
+	return result.String()
+}
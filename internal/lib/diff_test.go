@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLineDiffBetweenStrings(t *testing.T) {
+	t.Run("Changed lines are removed and added", func(t *testing.T) {
+		diff := GetLineDiffBetweenStrings("first\nsecond\nthird\n", "first\nchanged\nthird\n")
+
+		assert.Equal(t, " first\n-second\n+changed\n third\n", diff)
+	})
+
+	t.Run("Identical strings only have unchanged lines", func(t *testing.T) {
+		assert.Equal(t, " same\n", GetLineDiffBetweenStrings("same\n", "same\n"))
+	})
+}
+
+func TestGetHTMLDifferenceBetweenStrings(t *testing.T) {
+	t.Run("Changes are marked and the text is escaped", func(t *testing.T) {
+		diff := GetHTMLDifferenceBetweenStrings("<a>", "<b>")
+
+		assert.Contains(t, diff, "&lt;")
+		assert.Contains(t, diff, "<del")
+		assert.Contains(t, diff, "<ins")
+		assert.NotContains(t, diff, "<a>")
+	})
+}
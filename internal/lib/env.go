@@ -23,9 +23,20 @@ func GetEnvironmentVariables() map[string]string {
 	return envMap
 }
 
+// Environment variable that overrides the location of the environment state
+// file, so that scenarios running at the same time don't share their state.
+const EnvironmentStateFileVariable = "IE_ENVIRONMENT_STATE_FILE"
+
 // Location where the environment state from commands are to be captured
 // and sent to for being able to share state across commands.
-var DefaultEnvironmentStateFile = "/tmp/env-vars"
+var DefaultEnvironmentStateFile = environmentStateFile()
+
+func environmentStateFile() string {
+	if path := os.Getenv(EnvironmentStateFileVariable); path != "" {
+		return path
+	}
+	return "/tmp/env-vars"
+}
 
 // Loads a file that contains environment variables
 func LoadEnvironmentStateFile(path string) (map[string]string, error) {
@@ -64,15 +75,37 @@ func CleanEnvironmentStateFile(path string) error {
 		return err
 	}
 
-	env = filterInvalidKeys(env)
+	return WriteEnvironmentStateFile(path, env)
+}
 
+// Writes environment variables to a file in the format expected by
+// LoadEnvironmentStateFile. Variables with invalid names are dropped.
+func WriteEnvironmentStateFile(path string, env map[string]string) error {
 	file, err := os.Create(path)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
+
+	return writeEnvironmentVariables(file, env)
+}
 
+// Adds environment variables to the end of a file in the format expected by
+// LoadEnvironmentStateFile, creating it if it doesn't exist. They override
+// the variables of the same name already in the file.
+func AppendToEnvironmentStateFile(path string, env map[string]string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeEnvironmentVariables(file, env)
+}
+
+func writeEnvironmentVariables(file *os.File, env map[string]string) error {
 	writer := bufio.NewWriter(file)
-	for k, v := range env {
+	for k, v := range filterInvalidKeys(env) {
 		_, err := fmt.Fprintf(writer, "%s=\"%s\"\n", k, v)
 		if err != nil {
 			return err
@@ -83,6 +116,11 @@ func CleanEnvironmentStateFile(path string) error {
 
 var environmentVariableName = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
 
+// Checks whether a name can be used for an environment variable.
+func IsValidEnvironmentVariableName(name string) bool {
+	return environmentVariableName.MatchString(name)
+}
+
 func filterInvalidKeys(envMap map[string]string) map[string]string {
 	validEnvMap := make(map[string]string)
 	for key, value := range envMap {
@@ -1,6 +1,11 @@
 package lib
 
-import "testing"
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
 
 func TestEnvironmentVariableValidationAndFiltering(t *testing.T) {
 	// Test key validation
@@ -66,3 +71,14 @@ func TestEnvironmentVariableValidationAndFiltering(t *testing.T) {
 		}
 	})
 }
+
+func TestAppendingToEnvironmentStateFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "env-vars")
+	assert.NoError(t, WriteEnvironmentStateFile(path, map[string]string{"REGION": "eastus", "VM_IP": "old"}))
+
+	assert.NoError(t, AppendToEnvironmentStateFile(path, map[string]string{"VM_IP": "20.1.2.3", "key-1": "invalid"}))
+
+	env, err := LoadEnvironmentStateFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"REGION": "eastus", "VM_IP": "20.1.2.3"}, env)
+}
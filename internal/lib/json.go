@@ -2,6 +2,10 @@ package lib
 
 import (
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/xrash/smetrics"
 )
@@ -50,3 +54,67 @@ func CompareJsonStrings(
 		Score:          score,
 	}, nil
 }
+
+// A step of a JSONPath: a child name after a dot or in brackets, or an array
+// index in brackets.
+var jsonPathStep = regexp.MustCompile(`^(?:\.([A-Za-z_][A-Za-z0-9_-]*)|\[(-?[0-9]+)\]|\['([^']*)'\]|\["([^"]*)"\])`)
+
+// Gets the value at a JSONPath such as $.ipAddresses[0].address within a JSON
+// document. Supports child names and array indexes, which count from the end
+// when negative. Strings are returned as they are and any other value as
+// compact JSON.
+func QueryJSONPath(document string, path string) (string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return "", fmt.Errorf("the JSONPath '%s' doesn't start with $", path)
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("the output isn't JSON: %w", err)
+	}
+
+	for remaining := path[1:]; remaining != ""; {
+		step := jsonPathStep.FindStringSubmatch(remaining)
+		if step == nil {
+			return "", fmt.Errorf("invalid JSONPath '%s' at '%s'", path, remaining)
+		}
+		remaining = remaining[len(step[0]):]
+
+		if step[2] != "" {
+			array, ok := value.([]interface{})
+			if !ok {
+				return "", fmt.Errorf("can't index %s in '%s', it isn't an array", step[0], path)
+			}
+			index, _ := strconv.Atoi(step[2])
+			if index < 0 {
+				index += len(array)
+			}
+			if index < 0 || index >= len(array) {
+				return "", fmt.Errorf("the index %s in '%s' is out of range", step[0], path)
+			}
+			value = array[index]
+			continue
+		}
+
+		name := step[1] + step[3] + step[4]
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("can't get '%s' in '%s', it isn't an object", name, path)
+		}
+		if value, ok = object[name]; !ok {
+			return "", fmt.Errorf("there is no '%s' in '%s'", name, path)
+		}
+	}
+
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case nil:
+		return "", fmt.Errorf("the value at '%s' is null", path)
+	default:
+		compact, err := json.Marshal(value)
+		return string(compact), err
+	}
+}
@@ -1 +1,63 @@
 package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryingJSONPaths(t *testing.T) {
+	document := `{
+  "name": "vm",
+  "publicIpAddress": "20.1.2.3",
+  "powerState": null,
+  "hardware": {"cores": 4, "ultra": false},
+  "tags": {"owner-name": "ie"},
+  "ipAddresses": [{"address": "10.0.0.4"}, {"address": "10.0.0.5"}]
+}`
+
+	t.Run("Strings are returned as they are", func(t *testing.T) {
+		for path, expected := range map[string]string{
+			"$.publicIpAddress":         "20.1.2.3",
+			"$.ipAddresses[1].address":  "10.0.0.5",
+			"$.ipAddresses[-2].address": "10.0.0.4",
+			"$['tags']['owner-name']":   "ie",
+			`$.tags["owner-name"]`:      "ie",
+		} {
+			value, err := QueryJSONPath(document, path)
+			assert.NoError(t, err, path)
+			assert.Equal(t, expected, value, path)
+		}
+	})
+
+	t.Run("Other values are returned as JSON", func(t *testing.T) {
+		for path, expected := range map[string]string{
+			"$.hardware.cores": "4",
+			"$.hardware.ultra": "false",
+			"$.hardware":       `{"cores":4,"ultra":false}`,
+			"$.ipAddresses[0]": `{"address":"10.0.0.4"}`,
+		} {
+			value, err := QueryJSONPath(document, path)
+			assert.NoError(t, err, path)
+			assert.Equal(t, expected, value, path)
+		}
+	})
+
+	t.Run("Paths that don't lead to a value fail", func(t *testing.T) {
+		for path, message := range map[string]string{
+			"publicIpAddress":  "doesn't start with $",
+			"$.missing":        "there is no 'missing'",
+			"$.powerState":     "is null",
+			"$.ipAddresses[2]": "out of range",
+			"$.name[0]":        "it isn't an array",
+			"$.name.first":     "it isn't an object",
+			"$.ipAddresses[*]": "invalid JSONPath",
+		} {
+			_, err := QueryJSONPath(document, path)
+			assert.ErrorContains(t, err, message, path)
+		}
+
+		_, err := QueryJSONPath("Succeeded", "$.name")
+		assert.ErrorContains(t, err, "the output isn't JSON")
+	})
+}
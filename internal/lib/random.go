@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	lowercaseCharacters = "abcdefghijklmnopqrstuvwxyz"
+	uppercaseCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digitCharacters     = "0123456789"
+	// Symbols that don't need to be quoted in a shell or escaped in a URL. Most
+	// others do, like # which starts a comment or % and + in URLs.
+	symbolCharacters = "-_"
+)
+
+const (
+	defaultRandomSuffixLength = 6
+	defaultPasswordLength     = 16
+)
+
+// Matches generators such as {{ uuid }} or {{ random_suffix 8 }}.
+var valueGeneratorRegex = regexp.MustCompile(`\{\{\s*([a-z_]+)(?:\s+(\d+))?\s*\}\}`)
+
+// Creates a new seed for the random values generated within a scenario.
+func NewSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// Checks if a value contains any value generators.
+func HasValueGenerators(value string) bool {
+	return valueGeneratorRegex.MatchString(value)
+}
+
+// Checks if a value contains a password generator.
+func HasPasswordGenerator(value string) bool {
+	for _, match := range valueGeneratorRegex.FindAllStringSubmatch(value, -1) {
+		if match[1] == "password" {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the value generators within a value with values drawn from random.
+// The supported generators are:
+//
+//   - {{ random_suffix N }}: N lowercase letters & digits (defaults to 6).
+//   - {{ uuid }}: A version 4 UUID.
+//   - {{ password N }}: N characters with at least one uppercase letter,
+//     lowercase letter, digit & symbol (defaults to 16).
+//
+// The same source of randomness always produces the same values.
+func ExpandValueGenerators(value string, random *rand.Rand) (string, error) {
+	var expansionError error
+
+	expanded := valueGeneratorRegex.ReplaceAllStringFunc(value, func(generator string) string {
+		match := valueGeneratorRegex.FindStringSubmatch(generator)
+		name, argument := match[1], match[2]
+
+		length := 0
+		if argument != "" {
+			length, _ = strconv.Atoi(argument)
+		}
+
+		switch name {
+		case "random_suffix":
+			if argument == "" {
+				length = defaultRandomSuffixLength
+			}
+			return randomString(random, lowercaseCharacters+digitCharacters, length)
+		case "uuid":
+			return randomUUID(random)
+		case "password":
+			if argument == "" {
+				length = defaultPasswordLength
+			}
+			if length < 4 {
+				expansionError = fmt.Errorf("passwords must be at least 4 characters long, got %d", length)
+				return generator
+			}
+			return randomPassword(random, length)
+		default:
+			expansionError = fmt.Errorf("unknown value generator '%s'", name)
+			return generator
+		}
+	})
+
+	if expansionError != nil {
+		return "", expansionError
+	}
+
+	return expanded, nil
+}
+
+func randomString(random *rand.Rand, characters string, length int) string {
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = characters[random.Intn(len(characters))]
+	}
+	return string(result)
+}
+
+func randomUUID(random *rand.Rand) string {
+	bytes := make([]byte, 16)
+	random.Read(bytes)
+
+	// Set the version (4) and variant (RFC 4122) bits.
+	bytes[6] = (bytes[6] & 0x0f) | 0x40
+	bytes[8] = (bytes[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", bytes[0:4], bytes[4:6], bytes[6:8], bytes[8:10], bytes[10:])
+}
+
+func randomPassword(random *rand.Rand, length int) string {
+	// Start with one character of each kind so that the password satisfies
+	// common complexity requirements, then fill the rest & shuffle it.
+	password := []byte(
+		randomString(random, uppercaseCharacters, 1) +
+			randomString(random, lowercaseCharacters, 1) +
+			randomString(random, digitCharacters, 1) +
+			randomString(random, symbolCharacters, 1) +
+			randomString(
+				random,
+				uppercaseCharacters+lowercaseCharacters+digitCharacters+symbolCharacters,
+				length-4,
+			),
+	)
+
+	random.Shuffle(len(password), func(i, j int) {
+		password[i], password[j] = password[j], password[i]
+	})
+
+	// A leading dash would make the password look like an option to the
+	// commands it's passed to.
+	if i := strings.IndexAny(string(password), uppercaseCharacters+lowercaseCharacters+digitCharacters); i > 0 {
+		password[0], password[i] = password[i], password[0]
+	}
+
+	return string(password)
+}
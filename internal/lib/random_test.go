@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"math/rand"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandValueGenerators(t *testing.T) {
+	t.Run("The same seed generates the same values", func(t *testing.T) {
+		value := "rg-{{ random_suffix }}-{{ uuid }}-{{ password 20 }}"
+
+		first, err := ExpandValueGenerators(value, rand.New(rand.NewSource(42)))
+		assert.NoError(t, err)
+		second, err := ExpandValueGenerators(value, rand.New(rand.NewSource(42)))
+		assert.NoError(t, err)
+		third, err := ExpandValueGenerators(value, rand.New(rand.NewSource(43)))
+		assert.NoError(t, err)
+
+		assert.Equal(t, first, second)
+		assert.NotEqual(t, first, third)
+	})
+
+	t.Run("Generate random suffixes", func(t *testing.T) {
+		random := rand.New(rand.NewSource(1))
+
+		suffix, err := ExpandValueGenerators("{{random_suffix 10}}", random)
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[a-z0-9]{10}$`), suffix)
+
+		suffix, err = ExpandValueGenerators("rg-{{ random_suffix }}", random)
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^rg-[a-z0-9]{6}$`), suffix)
+	})
+
+	t.Run("Generate uuids", func(t *testing.T) {
+		uuid, err := ExpandValueGenerators("{{ uuid }}", rand.New(rand.NewSource(1)))
+
+		assert.NoError(t, err)
+		assert.Regexp(
+			t,
+			regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+			uuid,
+		)
+	})
+
+	t.Run("Generate passwords that satisfy complexity requirements", func(t *testing.T) {
+		password, err := ExpandValueGenerators("{{ password }}", rand.New(rand.NewSource(1)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, 16, len(password))
+		assert.True(t, strings.ContainsAny(password, uppercaseCharacters))
+		assert.True(t, strings.ContainsAny(password, lowercaseCharacters))
+		assert.True(t, strings.ContainsAny(password, digitCharacters))
+		assert.True(t, strings.ContainsAny(password, symbolCharacters))
+		assert.True(t, HasPasswordGenerator("{{ password }}"))
+		assert.False(t, HasPasswordGenerator("{{ uuid }}"))
+	})
+
+	t.Run("Passwords can be used unquoted in a shell or a URL", func(t *testing.T) {
+		for seed := int64(0); seed < 100; seed++ {
+			password, err := ExpandValueGenerators("{{ password 8 }}", rand.New(rand.NewSource(seed)))
+
+			assert.NoError(t, err)
+			assert.Regexp(t, regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{7}$`), password)
+		}
+	})
+
+	t.Run("Values without generators are left as is", func(t *testing.T) {
+		value, err := ExpandValueGenerators("plain $VALUE", rand.New(rand.NewSource(1)))
+
+		assert.NoError(t, err)
+		assert.Equal(t, "plain $VALUE", value)
+		assert.False(t, HasValueGenerators(value))
+	})
+
+	t.Run("Unknown generators are an error", func(t *testing.T) {
+		_, err := ExpandValueGenerators("{{ unknown }}", rand.New(rand.NewSource(1)))
+		assert.Error(t, err)
+
+		_, err = ExpandValueGenerators("{{ password 2 }}", rand.New(rand.NewSource(1)))
+		assert.Error(t, err)
+	})
+}
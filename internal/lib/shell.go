@@ -0,0 +1,298 @@
+package lib
+
+import (
+	"strings"
+)
+
+// Expands the references to variables within a shell command the way the
+// shell would, without running anything: $NAME, ${NAME}, ${NAME:-default} and
+// ${NAME-default} are expanded outside of single quotes, escapes and quoted
+// heredocs, while command substitutions and every other expansion are left
+// as they are. References to variables that aren't set and have no default
+// are left as they are too.
+func ExpandShellVariables(command string, variables map[string]string) string {
+	expander := shellExpander{source: command, variables: variables}
+	return expander.expand()
+}
+
+type shellExpander struct {
+	source    string
+	position  int
+	variables map[string]string
+	output    strings.Builder
+	// The heredocs started on the current line, whose bodies follow it.
+	heredocs []heredoc
+}
+
+type heredoc struct {
+	delimiter string
+	// Whether the delimiter was quoted, which keeps the body from being
+	// expanded.
+	quoted bool
+	// Whether leading tabs are stripped from the lines of the body, for <<-.
+	stripTabs bool
+}
+
+func (expander *shellExpander) expand() string {
+	inDoubleQuotes := false
+	for expander.position < len(expander.source) {
+		char := expander.source[expander.position]
+		switch {
+		case char == '\\':
+			expander.copy(2)
+		case char == '\'' && !inDoubleQuotes:
+			expander.copyUntil('\'', 1)
+		case char == '"':
+			inDoubleQuotes = !inDoubleQuotes
+			expander.copy(1)
+		case char == '`':
+			expander.copyUntil('`', 1)
+		case char == '$':
+			expander.expandReference(inDoubleQuotes)
+		case char == '<' && !inDoubleQuotes && strings.HasPrefix(expander.rest(), "<<"):
+			expander.readHeredoc()
+		case char == '#' && !inDoubleQuotes && expander.atWordStart():
+			// Comments are copied up to the end of the line, whatever quotes
+			// they contain.
+			end := strings.IndexByte(expander.rest(), '\n')
+			if end == -1 {
+				end = len(expander.rest())
+			}
+			expander.copy(end)
+		case char == '\n' && !inDoubleQuotes:
+			expander.copy(1)
+			expander.expandHeredocBodies()
+		default:
+			expander.copy(1)
+		}
+	}
+	return expander.output.String()
+}
+
+// Checks whether the current position is at the start of a word.
+func (expander *shellExpander) atWordStart() bool {
+	return expander.position == 0 ||
+		strings.IndexByte(" \t\n;&|()", expander.source[expander.position-1]) != -1
+}
+
+func (expander *shellExpander) rest() string {
+	return expander.source[expander.position:]
+}
+
+// Copies the next count bytes of the source as they are.
+func (expander *shellExpander) copy(count int) {
+	end := expander.position + count
+	if end > len(expander.source) {
+		end = len(expander.source)
+	}
+	expander.output.WriteString(expander.source[expander.position:end])
+	expander.position = end
+}
+
+// Copies the source as it is up to and including the next occurrence of
+// delimiter, looking for it after the first skip bytes.
+func (expander *shellExpander) copyUntil(delimiter byte, skip int) {
+	end := strings.IndexByte(expander.source[expander.position+skip:], delimiter)
+	if end == -1 {
+		expander.copy(len(expander.source))
+		return
+	}
+	expander.copy(skip + end + 1)
+}
+
+// Finds the length of the group that starts with open at the current position
+// and ends with the close that balances it, or -1 if it isn't closed.
+func (expander *shellExpander) balancedLength(open byte, close byte) int {
+	depth := 0
+	rest := expander.rest()
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			i++
+		case '\'':
+			end := strings.IndexByte(rest[i+1:], '\'')
+			if end == -1 {
+				return -1
+			}
+			i += end + 1
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// Expands the reference to a variable at the current position, copying it as
+// it is if it isn't one that's expanded.
+func (expander *shellExpander) expandReference(inDoubleQuotes bool) {
+	rest := expander.rest()
+	switch {
+	case strings.HasPrefix(rest, "$'") && !inDoubleQuotes:
+		expander.copyUntil('\'', 2)
+	case strings.HasPrefix(rest, "$("):
+		expander.position++
+		expander.output.WriteByte('$')
+		length := expander.balancedLength('(', ')')
+		if length == -1 {
+			length = len(expander.rest())
+		}
+		expander.copy(length)
+	case strings.HasPrefix(rest, "${"):
+		expander.position++
+		length := expander.balancedLength('{', '}')
+		if length == -1 {
+			expander.output.WriteByte('$')
+			expander.copy(len(expander.rest()))
+			return
+		}
+		reference := "$" + expander.rest()[:length]
+		expander.position += length
+		expander.output.WriteString(expander.expandBraces(reference))
+	default:
+		name := variableName(rest[1:])
+		if value, ok := expander.variables[name]; ok && name != "" {
+			expander.output.WriteString(value)
+			expander.position += 1 + len(name)
+			return
+		}
+		expander.copy(1 + len(name))
+	}
+}
+
+// Expands a ${...} reference, leaving it as it is unless it's ${NAME},
+// ${NAME:-default} or ${NAME-default}.
+func (expander *shellExpander) expandBraces(reference string) string {
+	inner := reference[2 : len(reference)-1]
+	name := variableName(inner)
+	if name == "" {
+		return reference
+	}
+	value, ok := expander.variables[name]
+
+	operator := inner[len(name):]
+	switch {
+	case operator == "":
+		if ok {
+			return value
+		}
+	case strings.HasPrefix(operator, ":-"):
+		if ok && value != "" {
+			return value
+		}
+		return ExpandShellVariables(operator[2:], expander.variables)
+	case strings.HasPrefix(operator, "-"):
+		if ok {
+			return value
+		}
+		return ExpandShellVariables(operator[1:], expander.variables)
+	}
+	return reference
+}
+
+// Gets the name of the variable at the start of text, or "" if there isn't
+// one.
+func variableName(text string) string {
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+		isLetter := char == '_' || (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z')
+		if !isLetter && (i == 0 || char < '0' || char > '9') {
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// Reads the operator and delimiter of a heredoc at the current position,
+// whose body starts on the next line.
+func (expander *shellExpander) readHeredoc() {
+	rest := expander.rest()
+	if strings.HasPrefix(rest, "<<<") {
+		expander.copy(3)
+		return
+	}
+
+	operator := "<<"
+	document := heredoc{}
+	if strings.HasPrefix(rest, "<<-") {
+		operator = "<<-"
+		document.stripTabs = true
+	}
+	word := strings.TrimLeft(rest[len(operator):], " \t")
+	end := strings.IndexAny(word, " \t\n;&|<>()")
+	if end == -1 {
+		end = len(word)
+	}
+	word = word[:end]
+
+	if strings.ContainsAny(word, "'\"\\") {
+		document.quoted = true
+		word = strings.NewReplacer("'", "", "\"", "", "\\", "").Replace(word)
+	}
+	if word == "" {
+		expander.copy(len(operator))
+		return
+	}
+
+	document.delimiter = word
+	expander.heredocs = append(expander.heredocs, document)
+	expander.copy(len(rest) - len(strings.TrimLeft(rest[len(operator):], " \t")) + end)
+}
+
+// Expands the bodies of the heredocs started on the line that just ended,
+// copying those with quoted delimiters as they are.
+func (expander *shellExpander) expandHeredocBodies() {
+	for _, document := range expander.heredocs {
+		for expander.position < len(expander.source) {
+			rest := expander.rest()
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				end = len(rest)
+			} else {
+				end++
+			}
+			line := rest[:end]
+			expander.position += end
+
+			content := strings.TrimSuffix(line, "\n")
+			if document.stripTabs {
+				content = strings.TrimLeft(content, "\t")
+			}
+			if content == document.delimiter {
+				expander.output.WriteString(line)
+				break
+			}
+
+			if document.quoted {
+				expander.output.WriteString(line)
+			} else {
+				expander.output.WriteString(ExpandUnquotedVariables(line, expander.variables))
+			}
+		}
+	}
+	expander.heredocs = nil
+}
+
+// Expands the references to variables within text in which quotes have no
+// meaning, like the bodies of heredocs or the content of files, the same way
+// ExpandShellVariables does.
+func ExpandUnquotedVariables(text string, variables map[string]string) string {
+	expander := shellExpander{source: text, variables: variables}
+	for expander.position < len(expander.source) {
+		switch expander.source[expander.position] {
+		case '\\':
+			expander.copy(2)
+		case '`':
+			expander.copyUntil('`', 1)
+		case '$':
+			expander.expandReference(true)
+		default:
+			expander.copy(1)
+		}
+	}
+	return expander.output.String()
+}
@@ -0,0 +1,115 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandingShellVariables(t *testing.T) {
+	variables := map[string]string{
+		"RESOURCE_GROUP": "rg-1a2b",
+		"REGION":         "eastus",
+		"EMPTY":          "",
+	}
+
+	cases := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{
+			"Plain and braced references",
+			"az group create --name $RESOURCE_GROUP --location ${REGION}",
+			"az group create --name rg-1a2b --location eastus",
+		},
+		{
+			"Double quotes are expanded",
+			`echo "Created $RESOURCE_GROUP in \"${REGION}\""`,
+			`echo "Created rg-1a2b in \"eastus\""`,
+		},
+		{
+			"Single quotes and escapes aren't expanded",
+			`echo '$RESOURCE_GROUP' \$REGION "it's $REGION"`,
+			`echo '$RESOURCE_GROUP' \$REGION "it's eastus"`,
+		},
+		{
+			"Defaults are used for unset and empty variables",
+			"echo ${UNSET:-westus} ${EMPTY:-none} ${EMPTY-none} ${REGION:-westus} ${UNSET:-$REGION}",
+			"echo westus none  eastus eastus",
+		},
+		{
+			"Unset variables and other expansions are left as they are",
+			"echo $UNSET ${UNSET} ${#REGION} ${REGION/east/west} $1 $? $$",
+			"echo $UNSET ${UNSET} ${#REGION} ${REGION/east/west} $1 $? $$",
+		},
+		{
+			"Command substitutions aren't run or expanded",
+			"echo $(az group show -n $RESOURCE_GROUP --query \"id\") `hostname $REGION` $((1 + 2))",
+			"echo $(az group show -n $RESOURCE_GROUP --query \"id\") `hostname $REGION` $((1 + 2))",
+		},
+		{
+			"Line continuations are kept",
+			"az vm create \\\n  --resource-group $RESOURCE_GROUP \\\n  --location \"$REGION\"",
+			"az vm create \\\n  --resource-group rg-1a2b \\\n  --location \"eastus\"",
+		},
+		{
+			"Quotes in comments don't stop expansion",
+			"# Don't forget the region\necho $REGION",
+			"# Don't forget the region\necho eastus",
+		},
+		{
+			"Heredocs are expanded unless their delimiter is quoted",
+			"cat <<EOF > a.txt\nname: $RESOURCE_GROUP 'quoted'\nEOF\ncat <<-'EOF'\n\tname: $RESOURCE_GROUP\n\tEOF\necho $REGION",
+			"cat <<EOF > a.txt\nname: rg-1a2b 'quoted'\nEOF\ncat <<-'EOF'\n\tname: $RESOURCE_GROUP\n\tEOF\necho eastus",
+		},
+		{
+			"Here strings aren't heredocs",
+			"grep east <<< \"$REGION\"",
+			"grep east <<< \"eastus\"",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ExpandShellVariables(tc.command, variables))
+		})
+	}
+}
+
+func TestExpandingUnquotedVariables(t *testing.T) {
+	variables := map[string]string{"NAME": "world", "EMPTY": ""}
+
+	cases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			"Plain and braced references are expanded",
+			"hello $NAME, ${NAME}_suffix $NAME_suffix",
+			"hello world, world_suffix $NAME_suffix",
+		},
+		{
+			"Quotes have no meaning",
+			`empty: '$EMPTY' "$NAME"`,
+			`empty: '' "world"`,
+		},
+		{
+			"Defaults are used for variables that aren't set",
+			"${UNSET:-$NAME} ${EMPTY:-none} $UNSET ${UNSET}",
+			"world none $UNSET ${UNSET}",
+		},
+		{
+			"Escaped references and command substitutions are left as they are",
+			"\\$NAME $(echo $NAME) `echo $NAME` $5",
+			"\\$NAME $(echo $NAME) `echo $NAME` $5",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ExpandUnquotedVariables(tc.text, variables))
+		})
+	}
+}
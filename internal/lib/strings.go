@@ -9,3 +9,13 @@ func IsNumber(str string) bool {
 	}
 	return true
 }
+
+// Checks if a slice of strings contains a given string.
+func SliceContains(slice []string, str string) bool {
+	for _, s := range slice {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,10 @@
 package logging
 
 import (
+	"io"
 	"os"
 
+	"github.com/Azure/InnovationEngine/internal/secrets"
 	"github.com/sirupsen/logrus"
 )
 
@@ -57,24 +59,45 @@ func LevelFromString(level string) Level {
 	}
 }
 
-var GlobalLogger = logrus.New()
+// Masks secrets within the entries formatted by another formatter.
+type secretMaskingFormatter struct {
+	formatter logrus.Formatter
+}
 
-func Init(level Level) {
-	GlobalLogger.SetFormatter(&logrus.TextFormatter{
-		DisableColors: false,
-		FullTimestamp: true,
-		DisableQuote:  true,
-	})
+func (f *secretMaskingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	formatted, err := f.formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(secrets.MaskString(string(formatted))), nil
+}
 
-	GlobalLogger.SetReportCaller(false)
-	GlobalLogger.SetLevel(level.Integer())
+var GlobalLogger = logrus.New()
 
+// Configures the logger to write to ie.log, falling back to stdout when the
+// file can't be opened.
+func Init(level Level) {
 	file, err := os.OpenFile("ie.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 
 	if err == nil {
-		GlobalLogger.SetOutput(file)
+		InitWithOutput(level, file)
 	} else {
-		GlobalLogger.SetOutput(os.Stdout)
+		InitWithOutput(level, os.Stdout)
 		GlobalLogger.Warn("Failed to log to file, using default stderr")
 	}
 }
+
+// Configures the logger to write to output, masking secrets.
+func InitWithOutput(level Level, output io.Writer) {
+	GlobalLogger.SetFormatter(&secretMaskingFormatter{
+		formatter: &logrus.TextFormatter{
+			DisableColors: false,
+			FullTimestamp: true,
+			DisableQuote:  true,
+		},
+	})
+
+	GlobalLogger.SetReportCaller(false)
+	GlobalLogger.SetLevel(level.Integer())
+	GlobalLogger.SetOutput(output)
+}
@@ -0,0 +1,484 @@
+package parsers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The kinds of bash statements that can define a variable.
+type BashAssignmentKind string
+
+const (
+	// export KEY=value
+	BashAssignmentExport BashAssignmentKind = "export"
+	// KEY=value
+	BashAssignmentPlain BashAssignmentKind = "plain"
+	// declare, typeset, local & readonly KEY=value
+	BashAssignmentDeclare BashAssignmentKind = "declare"
+	// read KEY
+	BashAssignmentRead BashAssignmentKind = "read"
+)
+
+// A variable definition found within a bash script. All offsets are byte
+// offsets into the script that the assignment was found in.
+type BashAssignment struct {
+	Name string
+	Kind BashAssignmentKind
+	// The value as it's written in the script, including quotes. Read
+	// statements don't have a value.
+	Value      string
+	ValueStart int
+	ValueEnd   int
+	// The span of the whole command that defines the variable.
+	StatementStart int
+	StatementEnd   int
+}
+
+// Get the command that defines the variable from the script the assignment was
+// found in.
+func (assignment BashAssignment) Statement(script string) string {
+	return script[assignment.StatementStart:assignment.StatementEnd]
+}
+
+// Get the line number (starting at 1) of the statement within the script the
+// assignment was found in.
+func (assignment BashAssignment) Line(script string) int {
+	return strings.Count(script[:assignment.StatementStart], "\n") + 1
+}
+
+// Checks if the value of the assignment references the variable being
+// assigned, I.E. `KEY=${KEY:-default}` or `KEY="$KEY-suffix"`.
+func (assignment BashAssignment) IsSelfReferencing() bool {
+	reference := regexp.MustCompile(`\$\{?` + regexp.QuoteMeta(assignment.Name) + `\b`)
+	return reference.MatchString(assignment.Value)
+}
+
+var (
+	bashAssignmentWordRegex = regexp.MustCompile(`^([a-zA-Z_][a-zA-Z0-9_]*)=`)
+	bashVariableNameRegex   = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+	bashSafeValueRegex      = regexp.MustCompile(`^[a-zA-Z0-9_@%+=:,./-]+$`)
+)
+
+// Reserved words that can precede a command without being the command itself.
+var bashCommandPrefixes = map[string]bool{
+	"!": true, "{": true, "}": true, "if": true, "then": true, "else": true,
+	"elif": true, "fi": true, "do": true, "done": true, "while": true,
+	"until": true, "esac": true, "time": true,
+}
+
+// Options of the read builtin that take an argument.
+const bashReadOptionsWithArguments = "adinNptu"
+
+// Quotes a value so that bash interprets it literally. Values that don't need
+// quoting are returned as is.
+func QuoteBashValue(value string) string {
+	if bashSafeValueRegex.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Rewrites the assignment found within the script so that it assigns the
+// provided value instead. Read statements are replaced with a plain
+// assignment, as they have no value to replace.
+func RewriteBashAssignment(script string, assignment BashAssignment, value string) string {
+	if assignment.Kind == BashAssignmentRead {
+		return script[:assignment.StatementStart] +
+			fmt.Sprintf("%s=%s", assignment.Name, QuoteBashValue(value)) +
+			script[assignment.StatementEnd:]
+	}
+
+	return script[:assignment.ValueStart] + QuoteBashValue(value) + script[assignment.ValueEnd:]
+}
+
+// Finds every statement that defines a variable within a bash script, in the
+// order they appear. Understands `export`, plain assignments, `declare`
+// (along with `typeset`, `local` & `readonly`) and `read`, including
+// assignments chained with operators, nested in compound commands or spread
+// across continued lines. Assignments that only apply to a single command
+// (I.E. `KEY=value command`) and assignments within subshells such as
+// `$(...)` are ignored, as they don't define the variable for the rest of the
+// script.
+func FindBashAssignments(script string) []BashAssignment {
+	var assignments []BashAssignment
+	for _, command := range splitBashCommands(script) {
+		assignments = append(assignments, findAssignmentsInCommand(command)...)
+	}
+	return assignments
+}
+
+// A word of a bash command and its position in the script.
+type bashWord struct {
+	text  string
+	start int
+	end   int
+}
+
+// A heredoc whose body starts on the line following its declaration.
+type bashHeredoc struct {
+	delimiter string
+	stripTabs bool
+}
+
+// Splits a bash script into simple commands, each made up of its words.
+// Comments, redirections and heredoc bodies are dropped.
+func splitBashCommands(script string) [][]bashWord {
+	var commands [][]bashWord
+	var current []bashWord
+	var heredocs []bashHeredoc
+
+	flush := func() {
+		if len(current) > 0 {
+			commands = append(commands, current)
+			current = nil
+		}
+	}
+
+	i := 0
+	for i < len(script) {
+		character := script[i]
+
+		switch {
+		case character == '\\' && i+1 < len(script) && script[i+1] == '\n':
+			i += 2
+
+		case character == ' ' || character == '\t' || character == '\r':
+			i++
+
+		case character == '\n':
+			flush()
+			i = skipHeredocBodies(script, i+1, heredocs)
+			heredocs = nil
+
+		case character == '#':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+
+		case strings.HasPrefix(script[i:], "<<") && !strings.HasPrefix(script[i:], "<<<"):
+			i += 2
+			heredoc := bashHeredoc{}
+			if i < len(script) && script[i] == '-' {
+				heredoc.stripTabs = true
+				i++
+			}
+			i = skipBlanks(script, i)
+			end := scanBashWord(script, i)
+			heredoc.delimiter = strings.NewReplacer(`'`, "", `"`, "", `\`, "").
+				Replace(script[i:end])
+			heredocs = append(heredocs, heredoc)
+			i = end
+
+		case character == '<' || character == '>':
+			// Redirections don't end the command, but their target isn't
+			// part of it either.
+			for i < len(script) && strings.ContainsRune("<>&|", rune(script[i])) {
+				i++
+			}
+			i = skipBlanks(script, i)
+			i = scanBashWord(script, i)
+
+		case strings.ContainsRune(";&|()", rune(character)):
+			flush()
+			i++
+
+		default:
+			end := scanBashWord(script, i)
+			word := bashWord{text: script[i:end], start: i, end: end}
+
+			// File descriptors of redirections (I.E. 2>/dev/null) aren't words.
+			isDescriptor := end < len(script) && strings.ContainsRune("<>", rune(script[end])) &&
+				strings.Trim(word.text, "0123456789") == ""
+
+			if !isDescriptor {
+				current = append(current, word)
+			}
+			i = end
+		}
+	}
+
+	flush()
+	return commands
+}
+
+// Finds the variable definitions made by a single simple command.
+func findAssignmentsInCommand(words []bashWord) []BashAssignment {
+	index := 0
+	for index < len(words) && bashCommandPrefixes[words[index].text] {
+		index++
+	}
+
+	if index == len(words) {
+		return nil
+	}
+
+	switch words[index].text {
+	case "for", "case", "select", "function":
+		return nil
+	}
+
+	statementStart := words[index].start
+	statementEnd := words[len(words)-1].end
+
+	var leadingAssignments []BashAssignment
+	for ; index < len(words); index++ {
+		assignment, ok := parseAssignmentWord(words[index], BashAssignmentPlain)
+		if !ok {
+			break
+		}
+		assignment.StatementStart = words[index].start
+		assignment.StatementEnd = words[index].end
+		leadingAssignments = append(leadingAssignments, assignment)
+	}
+
+	// Assignments that precede a command only apply to that command.
+	if index == len(words) {
+		return leadingAssignments
+	}
+
+	var kind BashAssignmentKind
+	switch words[index].text {
+	case "export":
+		kind = BashAssignmentExport
+	case "declare", "typeset", "local", "readonly":
+		kind = BashAssignmentDeclare
+	case "read":
+		return findReadAssignments(words[index+1:], statementStart, statementEnd)
+	default:
+		return nil
+	}
+
+	var assignments []BashAssignment
+	for _, word := range words[index+1:] {
+		assignment, ok := parseAssignmentWord(word, kind)
+		if !ok {
+			continue
+		}
+		assignment.StatementStart = statementStart
+		assignment.StatementEnd = statementEnd
+		assignments = append(assignments, assignment)
+	}
+
+	return assignments
+}
+
+// Parses a word in the form of KEY=value.
+func parseAssignmentWord(word bashWord, kind BashAssignmentKind) (BashAssignment, bool) {
+	match := bashAssignmentWordRegex.FindStringSubmatch(word.text)
+	if match == nil {
+		return BashAssignment{}, false
+	}
+
+	return BashAssignment{
+		Name:       match[1],
+		Kind:       kind,
+		Value:      word.text[len(match[0]):],
+		ValueStart: word.start + len(match[0]),
+		ValueEnd:   word.end,
+	}, true
+}
+
+// Finds the variable defined by the arguments of a read command. Only read
+// commands that define a single variable are considered, as they can be
+// replaced by an assignment without affecting other variables.
+func findReadAssignments(arguments []bashWord, statementStart int, statementEnd int) []BashAssignment {
+	var names []bashWord
+
+	for index := 0; index < len(arguments); index++ {
+		argument := arguments[index].text
+
+		if len(names) == 0 && strings.HasPrefix(argument, "-") && len(argument) > 1 {
+			for position, option := range argument[1:] {
+				if !strings.ContainsRune(bashReadOptionsWithArguments, option) {
+					continue
+				}
+
+				// Arrays aren't plain variables, so they can't be overridden.
+				if option == 'a' {
+					return nil
+				}
+
+				// The argument is either the rest of this word or the next word.
+				if position == len(argument)-2 {
+					index++
+				}
+				break
+			}
+			continue
+		}
+
+		names = append(names, arguments[index])
+	}
+
+	if len(names) != 1 || !bashVariableNameRegex.MatchString(names[0].text) {
+		return nil
+	}
+
+	return []BashAssignment{
+		{
+			Name:           names[0].text,
+			Kind:           BashAssignmentRead,
+			ValueStart:     statementEnd,
+			ValueEnd:       statementEnd,
+			StatementStart: statementStart,
+			StatementEnd:   statementEnd,
+		},
+	}
+}
+
+func skipBlanks(script string, i int) int {
+	for i < len(script) && (script[i] == ' ' || script[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+// Skips over the bodies of the heredocs declared on the previous line,
+// starting at the beginning of the line following the declaration.
+func skipHeredocBodies(script string, i int, heredocs []bashHeredoc) int {
+	for _, heredoc := range heredocs {
+		for i < len(script) {
+			lineEnd := strings.IndexByte(script[i:], '\n')
+			var line string
+			if lineEnd == -1 {
+				line = script[i:]
+				i = len(script)
+			} else {
+				line = script[i : i+lineEnd]
+				i += lineEnd + 1
+			}
+
+			if heredoc.stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+
+			if line == heredoc.delimiter {
+				break
+			}
+		}
+	}
+	return i
+}
+
+// Returns the index just past the end of the word that starts at i. Quotes,
+// expansions and substitutions are part of the word they appear in.
+func scanBashWord(script string, i int) int {
+	start := i
+	for i < len(script) {
+		character := script[i]
+
+		switch {
+		case character == '\\':
+			i += 2
+		case character == '\'':
+			i = skipSingleQuotes(script, i)
+		case character == '"':
+			i = skipDoubleQuotes(script, i)
+		case character == '`':
+			i = skipBackticks(script, i)
+		case strings.HasPrefix(script[i:], "$'"):
+			i = skipAnsiCQuotes(script, i)
+		case strings.HasPrefix(script[i:], "$("):
+			i = skipBalanced(script, i+2, '(', ')')
+		case strings.HasPrefix(script[i:], "${"):
+			i = skipBalanced(script, i+2, '{', '}')
+		case character == '(' && i > start && script[i-1] == '=':
+			// Array values, I.E. KEY=(one two)
+			i = skipBalanced(script, i+1, '(', ')')
+		case strings.ContainsRune(" \t\r\n;&|()<>", rune(character)):
+			return i
+		default:
+			i++
+		}
+	}
+
+	if i > len(script) {
+		return len(script)
+	}
+	return i
+}
+
+// Returns the index just past the closing character that matches an opening
+// character right before i.
+func skipBalanced(script string, i int, open byte, close byte) int {
+	depth := 1
+	for i < len(script) {
+		switch script[i] {
+		case '\\':
+			i += 2
+			continue
+		case '\'':
+			i = skipSingleQuotes(script, i)
+			continue
+		case '"':
+			i = skipDoubleQuotes(script, i)
+			continue
+		case '`':
+			i = skipBackticks(script, i)
+			continue
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+		i++
+	}
+	return len(script)
+}
+
+func skipSingleQuotes(script string, i int) int {
+	end := strings.IndexByte(script[i+1:], '\'')
+	if end == -1 {
+		return len(script)
+	}
+	return i + 1 + end + 1
+}
+
+func skipAnsiCQuotes(script string, i int) int {
+	for i += 2; i < len(script); i++ {
+		switch script[i] {
+		case '\\':
+			i++
+		case '\'':
+			return i + 1
+		}
+	}
+	return len(script)
+}
+
+func skipBackticks(script string, i int) int {
+	for i++; i < len(script); i++ {
+		switch script[i] {
+		case '\\':
+			i++
+		case '`':
+			return i + 1
+		}
+	}
+	return len(script)
+}
+
+func skipDoubleQuotes(script string, i int) int {
+	i++
+	for i < len(script) {
+		switch {
+		case script[i] == '\\':
+			i += 2
+		case script[i] == '"':
+			return i + 1
+		case script[i] == '`':
+			i = skipBackticks(script, i)
+		case strings.HasPrefix(script[i:], "$("):
+			i = skipBalanced(script, i+2, '(', ')')
+		case strings.HasPrefix(script[i:], "${"):
+			i = skipBalanced(script, i+2, '{', '}')
+		default:
+			i++
+		}
+	}
+	return len(script)
+}
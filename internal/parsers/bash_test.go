@@ -0,0 +1,84 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindingBashAssignments(t *testing.T) {
+	names := func(assignments []BashAssignment) []string {
+		var result []string
+		for _, assignment := range assignments {
+			result = append(result, assignment.Name+":"+string(assignment.Kind))
+		}
+		return result
+	}
+
+	t.Run("Find each form of assignment", func(t *testing.T) {
+		script := "export A=1\nB=2\ndeclare -x C=3\nlocal D=4\nreadonly E=5\nread -r -p \"F? \" F\n"
+
+		assert.Equal(
+			t,
+			[]string{"A:export", "B:plain", "C:declare", "D:declare", "E:declare", "F:read"},
+			names(FindBashAssignments(script)),
+		)
+	})
+
+	t.Run("Find assignments chained with operators and nested in blocks", func(t *testing.T) {
+		script := "cd /tmp && export A=1 || B=2; C=3\nif true; then\n  D=4\nfi\nexport E=\\\n  5\n"
+
+		assert.Equal(
+			t,
+			[]string{"A:export", "B:plain", "C:plain", "D:plain", "E:export"},
+			names(FindBashAssignments(script)),
+		)
+	})
+
+	t.Run("Ignore assignments that don't define a variable for the script", func(t *testing.T) {
+		script := "A=1 command\nB=$(C=2; echo $C)\necho \"D=3\" # E=4\ncat <<EOF\nF=5\nEOF\nG+=6\nread -a H\nread I J\n"
+
+		assert.Equal(t, []string{"B:plain"}, names(FindBashAssignments(script)))
+	})
+
+	t.Run("Capture the value as it's written", func(t *testing.T) {
+		script := `export A="$(echo "a b") c" && echo $A`
+		assignments := FindBashAssignments(script)
+
+		assert.Equal(t, 1, len(assignments))
+		assert.Equal(t, `"$(echo "a b") c"`, assignments[0].Value)
+		assert.Equal(t, `export A="$(echo "a b") c"`, assignments[0].Statement(script))
+	})
+
+	t.Run("Detect values that reference the variable itself", func(t *testing.T) {
+		assignments := FindBashAssignments("A=${A:-default}\nAB=$A\nA=\"$AB\"\n")
+
+		assert.True(t, assignments[0].IsSelfReferencing())
+		assert.False(t, assignments[1].IsSelfReferencing())
+		assert.False(t, assignments[2].IsSelfReferencing())
+	})
+}
+
+func TestRewritingBashAssignments(t *testing.T) {
+	t.Run("Rewrite the value of an assignment", func(t *testing.T) {
+		script := `export A="old value"; echo $A`
+		assignment := FindBashAssignments(script)[0]
+
+		assert.Equal(t, `export A='new value'; echo $A`, RewriteBashAssignment(script, assignment, "new value"))
+	})
+
+	t.Run("Replace a read statement with an assignment", func(t *testing.T) {
+		script := "read -p \"Name: \" NAME\necho $NAME"
+		assignment := FindBashAssignments(script)[0]
+
+		assert.Equal(t, "NAME=value\necho $NAME", RewriteBashAssignment(script, assignment, "value"))
+	})
+
+	t.Run("Quote values only when needed", func(t *testing.T) {
+		assert.Equal(t, "plain-value_1.0", QuoteBashValue("plain-value_1.0"))
+		assert.Equal(t, "'has space'", QuoteBashValue("has space"))
+		assert.Equal(t, `'$HOME'`, QuoteBashValue("$HOME"))
+		assert.Equal(t, `'it'\''s'`, QuoteBashValue("it's"))
+		assert.Equal(t, "''", QuoteBashValue(""))
+	})
+}
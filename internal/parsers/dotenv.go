@@ -0,0 +1,118 @@
+package parsers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var dotEnvKeyRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parses a dotenv file into a map of keys mapped to values.
+func ParseDotEnvFile(filePath string) (map[string]string, error) {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the dotenv file %s because %v", filePath, err)
+	}
+
+	variables, err := ParseDotEnv(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the dotenv file %s because %v", filePath, err)
+	}
+
+	return variables, nil
+}
+
+// Parses the contents of a dotenv file into a map of keys mapped to values.
+// Supports blank lines, `#` comments, an optional `export` prefix, single
+// quoted values (taken literally), double quoted values (with escape
+// sequences and values spanning multiple lines) and unquoted values with
+// trailing comments.
+func ParseDotEnv(contents []byte) (map[string]string, error) {
+	variables := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+
+		if !found || !dotEnvKeyRegex.MatchString(key) {
+			return nil, fmt.Errorf("invalid line %d: %q", lineNumber, scanner.Text())
+		}
+
+		value = strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, "'"):
+			end := strings.Index(value[1:], "'")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated single quote on line %d", lineNumber)
+			}
+			value = value[1 : end+1]
+
+		case strings.HasPrefix(value, `"`):
+			// Double quoted values may continue onto the following lines.
+			quoted := value[1:]
+			for !hasClosingDoubleQuote(quoted) {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("unterminated double quote on line %d", lineNumber)
+				}
+				lineNumber++
+				quoted += "\n" + scanner.Text()
+			}
+			value = unescapeDoubleQuotedValue(quoted[:closingDoubleQuoteIndex(quoted)])
+
+		default:
+			if index := strings.Index(value, " #"); index != -1 {
+				value = strings.TrimSpace(value[:index])
+			}
+		}
+
+		variables[key] = value
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return variables, nil
+}
+
+// Returns the index of the first unescaped double quote, or -1 if there is
+// none.
+func closingDoubleQuoteIndex(value string) int {
+	escaped := false
+	for index, character := range value {
+		switch {
+		case escaped:
+			escaped = false
+		case character == '\\':
+			escaped = true
+		case character == '"':
+			return index
+		}
+	}
+	return -1
+}
+
+func hasClosingDoubleQuote(value string) bool {
+	return closingDoubleQuoteIndex(value) != -1
+}
+
+// Converts the escape sequences supported within double quoted values.
+func unescapeDoubleQuotedValue(value string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+	return replacer.Replace(value)
+}
@@ -0,0 +1,47 @@
+package parsers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsingDotEnv(t *testing.T) {
+	t.Run("Dotenv with comments, exports and quotes", func(t *testing.T) {
+		contents := []byte(`# A comment
+LOCATION=eastus
+export GROUP=my-group # trailing comment
+
+SINGLE='literal $VALUE # not a comment'
+DOUBLE="line one\nline two"
+MULTI="first
+second"
+EMPTY=
+`)
+
+		variables, err := ParseDotEnv(contents)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"LOCATION": "eastus",
+			"GROUP":    "my-group",
+			"SINGLE":   "literal $VALUE # not a comment",
+			"DOUBLE":   "line one\nline two",
+			"MULTI":    "first\nsecond",
+			"EMPTY":    "",
+		}, variables)
+	})
+
+	t.Run("Dotenv with an invalid line", func(t *testing.T) {
+		_, err := ParseDotEnv([]byte("LOCATION=eastus\nnot a variable\n"))
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "line 2")
+	})
+
+	t.Run("Dotenv with an unterminated quote", func(t *testing.T) {
+		_, err := ParseDotEnv([]byte("LOCATION=\"eastus\n"))
+
+		assert.Error(t, err)
+	})
+}
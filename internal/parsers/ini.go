@@ -2,10 +2,15 @@ package parsers
 
 import (
 	"fmt"
+	"sort"
 
 	"gopkg.in/ini.v1"
 )
 
+// The section of an INI file that holds the values shared by every profile.
+// Keys declared before the first section header belong to this section.
+const DefaultINISection = "DEFAULT"
+
 // Parses an INI file into a flat map of keys mapped to values. This reduces
 // the complexity of the INI file to a simple key/value store and ignores the
 // sections.
@@ -17,11 +22,77 @@ func ParseINIFile(filePath string) (map[string]string, error) {
 		return nil, fmt.Errorf("failed to read the INI file %s because %v", filePath, err)
 	}
 
+	return flattenINISections(iniFile), nil
+}
+
+// Same as ParseINIFile, but parses the contents of an INI file that has
+// already been read into memory.
+func ParseINI(contents []byte) (map[string]string, error) {
+	iniFile, err := ini.Load(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the INI contents because %v", err)
+	}
+
+	return flattenINISections(iniFile), nil
+}
+
+func flattenINISections(iniFile *ini.File) map[string]string {
 	data := make(map[string]string)
 	for _, section := range iniFile.Sections() {
 		for key, value := range section.KeysHash() {
 			data[key] = value
 		}
 	}
-	return data, nil
+	return data
+}
+
+// Parses an INI file into a map of section names, each mapped to the
+// key/value pairs declared within that section. Empty sections are omitted.
+func ParseINIFileSections(filePath string) (map[string]map[string]string, error) {
+	iniFile, err := ini.Load(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the INI file %s because %v", filePath, err)
+	}
+
+	return groupINISections(iniFile), nil
+}
+
+// Same as ParseINIFileSections, but parses the contents of an INI file that
+// has already been read into memory.
+func ParseINISections(contents []byte) (map[string]map[string]string, error) {
+	iniFile, err := ini.Load(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the INI contents because %v", err)
+	}
+
+	return groupINISections(iniFile), nil
+}
+
+// Groups the keys of an INI file by section. Empty sections are kept, as
+// they're still profiles that can be selected, except for the default section
+// which is always there whether the file declares it or not.
+func groupINISections(iniFile *ini.File) map[string]map[string]string {
+	sections := make(map[string]map[string]string)
+	for _, section := range iniFile.Sections() {
+		keys := section.KeysHash()
+		if len(keys) == 0 && section.Name() == DefaultINISection {
+			continue
+		}
+		sections[section.Name()] = keys
+	}
+
+	return sections
+}
+
+// Returns the names of the sections that can be used as profiles, sorted
+// alphabetically. The default section is not included.
+func INIProfileNames(sections map[string]map[string]string) []string {
+	var names []string
+	for name := range sections {
+		if name != DefaultINISection {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
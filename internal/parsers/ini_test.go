@@ -39,3 +39,68 @@ func TestParsingINIFiles(t *testing.T) {
 	})
 
 }
+
+func TestParsingINIFileSections(t *testing.T) {
+	t.Run("INI with a default section and profiles", func(t *testing.T) {
+		tempFile, err := os.CreateTemp("", "test")
+		if err != nil {
+			t.Errorf("Error creating temp file: %s", err)
+		}
+
+		defer os.Remove(tempFile.Name())
+
+		contents := []byte(`location=eastus
+[dev]
+group=dev-group
+[prod]
+group=prod-group
+location=westus
+[empty]`)
+
+		if _, err := tempFile.Write(contents); err != nil {
+			t.Errorf("Error writing to temp file: %s", err)
+		}
+
+		sections, err := ParseINIFileSections(tempFile.Name())
+		if err != nil {
+			t.Errorf("Error parsing INI file: %s", err)
+		}
+
+		if sections[DefaultINISection]["location"] != "eastus" {
+			t.Errorf("Default section is wrong: %v", sections[DefaultINISection])
+		}
+
+		if sections["dev"]["group"] != "dev-group" {
+			t.Errorf("dev section is wrong: %v", sections["dev"])
+		}
+
+		if sections["prod"]["group"] != "prod-group" || sections["prod"]["location"] != "westus" {
+			t.Errorf("prod section is wrong: %v", sections["prod"])
+		}
+
+		if keys, ok := sections["empty"]; !ok || len(keys) != 0 {
+			t.Errorf("empty section is wrong: %v", keys)
+		}
+
+		profiles := INIProfileNames(sections)
+		if len(profiles) != 3 || profiles[0] != "dev" || profiles[1] != "empty" || profiles[2] != "prod" {
+			t.Errorf("Profiles are wrong: %v", profiles)
+		}
+	})
+
+	t.Run("INI without a default section", func(t *testing.T) {
+		sections, err := ParseINISections([]byte("[dev]\ngroup=dev-group"))
+		if err != nil {
+			t.Errorf("Error parsing INI contents: %s", err)
+		}
+
+		if _, ok := sections[DefaultINISection]; ok {
+			t.Errorf("Default section shouldn't be included: %v", sections)
+		}
+
+		profiles := INIProfileNames(sections)
+		if len(profiles) != 1 || profiles[0] != "dev" {
+			t.Errorf("Profiles are wrong: %v", profiles)
+		}
+	})
+}
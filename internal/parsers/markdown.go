@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -49,6 +50,18 @@ type ExpectedOutputBlock struct {
 	ExpectedRegex      *regexp.Regexp `json:"expectedRegexPattern"`
 }
 
+// A value captured from the output of a code block into a variable, declared
+// by a capture comment after the code block:
+//
+//	<!-- capture: VM_IP=$.publicIpAddress VERSION=/v(\d+\.\d+)/ -->
+//
+// The expression is either a JSONPath into the output, or a regex between
+// slashes that captures its first group, or the whole match if it has none.
+type Capture struct {
+	Variable   string `json:"variable"`
+	Expression string `json:"expression"`
+}
+
 // The representation of a code block in a markdown file.
 type CodeBlock struct {
 	Language       string              `json:"language"`
@@ -56,6 +69,21 @@ type CodeBlock struct {
 	Header         string              `json:"header"`
 	Description    string              `json:"description"`
 	ExpectedOutput ExpectedOutputBlock `json:"resultBlock"`
+	Attributes     map[string]string   `json:"attributes,omitempty"`
+	Tags           []string            `json:"tags,omitempty"`
+	Captures       []Capture           `json:"captures,omitempty"`
+}
+
+// The path of the file the code block is written to, set with the file
+// attribute. Empty for code blocks that are run.
+func (block CodeBlock) File() string {
+	return block.Attributes["file"]
+}
+
+// Whether the code block starts a process that keeps running in the
+// background, set with the background attribute.
+func (block CodeBlock) Background() bool {
+	return block.Attributes["background"] == "true"
 }
 
 // Assumes the title of the scenario is the first h1 header in the
@@ -82,6 +110,21 @@ func ExtractScenarioTitleFromAst(node ast.Node, source []byte) (string, error) {
 	return header, nil
 }
 
+var captureCommentRegex = regexp.MustCompile(`(?s)^<!--\s*capture:(.*?)-->`)
+
+// Parses the captures declared by a capture comment, ordered by the name of
+// their variable.
+func parseCaptures(list string) []Capture {
+	attributes := parseAttributeList(list)
+
+	var captures []Capture
+	for variable, expression := range attributes {
+		captures = append(captures, Capture{Variable: variable, Expression: expression})
+	}
+	sort.Slice(captures, func(i, j int) bool { return captures[i].Variable < captures[j].Variable })
+	return captures
+}
+
 var expectedSimilarityRegex = regexp.MustCompile(
 	`<!--\s*expected_similarity=\s*(\d+\.?\d*)|"(.*)"\s*-->`,
 )
@@ -112,6 +155,18 @@ func ExtractCodeBlocksFromAst(
 			// Extract the code block if it matches the language.
 			case *ast.HTMLBlock:
 				content := extractTextFromMarkdown(&n.BaseBlock, source)
+
+				// Captures apply to the output of the code block before them.
+				if capture := captureCommentRegex.FindStringSubmatch(content); capture != nil {
+					if len(commands) == 0 {
+						logging.GlobalLogger.Warnf("There is no code block before the capture comment `%s`", content)
+						break
+					}
+					last := &commands[len(commands)-1]
+					last.Captures = append(last.Captures, parseCaptures(capture[1])...)
+					break
+				}
+
 				matches := expectedSimilarityRegex.FindStringSubmatch(content)
 
 				if len(matches) < 3 {
@@ -160,6 +215,22 @@ func ExtractCodeBlocksFromAst(
 				}
 
 				lastNode = node
+				attributes := ParseCodeBlockAttributes(infoText(n, source))
+
+				// Code blocks that write a file are extracted whatever their
+				// language.
+				if attributes["file"] != "" {
+					commands = append(commands, CodeBlock{
+						Language:    language,
+						Content:     content,
+						Header:      lastHeader,
+						Description: description,
+						Attributes:  attributes,
+						Tags:        splitTags(attributes["tags"]),
+					})
+					break
+				}
+
 				for _, desiredLanguage := range languagesToExtract {
 					if language == desiredLanguage {
 						command := CodeBlock{
@@ -167,6 +238,8 @@ func ExtractCodeBlocksFromAst(
 							Content:     content,
 							Header:      lastHeader,
 							Description: description,
+							Attributes:  attributes,
+							Tags:        splitTags(attributes["tags"]),
 						}
 						commands = append(commands, command)
 						break
@@ -198,6 +271,96 @@ func ExtractCodeBlocksFromAst(
 	return commands
 }
 
+// Gets the full info string of a fenced code block, i.e. everything after the
+// opening fence.
+func infoText(n *ast.FencedCodeBlock, source []byte) string {
+	if n.Info == nil {
+		return ""
+	}
+	return string(n.Info.Segment.Value(source))
+}
+
+var codeBlockAttributesRegex = regexp.MustCompile(`\{(.*)\}\s*$`)
+
+// Parses the attributes from the info string of a code block, written in
+// braces after the language:
+//
+//	```bash {tags=setup,cleanup name="Create the cluster"}
+//
+// Values can be quoted to include spaces. An attribute without a value is
+// set to "true".
+func ParseCodeBlockAttributes(info string) map[string]string {
+	match := codeBlockAttributesRegex.FindStringSubmatch(info)
+	if match == nil {
+		return nil
+	}
+	return parseAttributeList(match[1])
+}
+
+// Parses a list of key=value attributes separated by whitespace, see
+// ParseCodeBlockAttributes. Returns nil if there are none.
+func parseAttributeList(text string) map[string]string {
+	attributes := make(map[string]string)
+	remaining := strings.TrimSpace(text)
+	for remaining != "" {
+		end := strings.IndexAny(remaining, "= \t")
+		if end == -1 {
+			attributes[remaining] = "true"
+			break
+		}
+
+		key := remaining[:end]
+		remaining = remaining[end:]
+		if remaining[0] != '=' {
+			attributes[key] = "true"
+			remaining = strings.TrimSpace(remaining)
+			continue
+		}
+
+		remaining = remaining[1:]
+		value := ""
+		if remaining != "" && (remaining[0] == '"' || remaining[0] == '\'') {
+			quote := remaining[0]
+			closing := strings.IndexByte(remaining[1:], quote)
+			if closing == -1 {
+				value = remaining[1:]
+				remaining = ""
+			} else {
+				value = remaining[1 : closing+1]
+				remaining = remaining[closing+2:]
+			}
+		} else {
+			end := strings.IndexAny(remaining, " \t")
+			if end == -1 {
+				end = len(remaining)
+			}
+			value = remaining[:end]
+			remaining = remaining[end:]
+		}
+
+		if key != "" {
+			attributes[key] = value
+		}
+		remaining = strings.TrimSpace(remaining)
+	}
+
+	if len(attributes) == 0 {
+		return nil
+	}
+	return attributes
+}
+
+// Splits a comma separated list of tags.
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
 // This regex matches HTML comments within markdown blocks that contain
 // variables to use within the scenario.
 var variableCommentBlockRegex = regexp.MustCompile("(?s)<!--.*?```variables(.*?)```.*?")
@@ -3,6 +3,8 @@ package parsers
 import (
 	"fmt"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestParsingMarkdownHeaders(t *testing.T) {
@@ -182,3 +184,81 @@ func TestParsingMarkdownExpectedRegex(t *testing.T) {
 		}
 	})
 }
+
+func TestParsingCodeBlockAttributes(t *testing.T) {
+	t.Run("Attributes after the language", func(t *testing.T) {
+		markdown := []byte("# Hello World\n```bash {tags=setup,cleanup name=\"Create it\" optional}\necho Hello\n```\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+		assert.Equal(t, 1, len(codeBlocks))
+		assert.Equal(t, "bash", codeBlocks[0].Language)
+		assert.Equal(t, []string{"setup", "cleanup"}, codeBlocks[0].Tags)
+		assert.Equal(t, map[string]string{
+			"tags":     "setup,cleanup",
+			"name":     "Create it",
+			"optional": "true",
+		}, codeBlocks[0].Attributes)
+	})
+
+	t.Run("Code block without attributes", func(t *testing.T) {
+		markdown := []byte("# Hello World\n```bash\necho Hello\n```\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+		assert.Equal(t, 1, len(codeBlocks))
+		assert.Nil(t, codeBlocks[0].Attributes)
+		assert.Nil(t, codeBlocks[0].Tags)
+	})
+
+	t.Run("Code blocks that write a file are extracted in any language", func(t *testing.T) {
+		markdown := []byte("# Hello World\n" +
+			"```yaml {file=deployment.yaml}\nkind: Deployment\n```\n" +
+			"```yaml\nkind: Service\n```\n" +
+			"```bash\nkubectl apply -f deployment.yaml\n```\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+		assert.Equal(t, 2, len(codeBlocks))
+		assert.Equal(t, "yaml", codeBlocks[0].Language)
+		assert.Equal(t, "deployment.yaml", codeBlocks[0].File())
+		assert.Equal(t, "kind: Deployment\n", codeBlocks[0].Content)
+		assert.Equal(t, "", codeBlocks[1].File())
+	})
+
+	t.Run("Info string without braces", func(t *testing.T) {
+		assert.Nil(t, ParseCodeBlockAttributes("bash"))
+		assert.Equal(t, map[string]string{"tags": "a b"}, ParseCodeBlockAttributes("bash {tags='a b'}"))
+	})
+}
+
+func TestParsingCaptures(t *testing.T) {
+	t.Run("Capture comments apply to the code block before them", func(t *testing.T) {
+		markdown := []byte("```bash\naz vm create\n```\n" +
+			"<!-- capture: VM_IP=$.publicIpAddress VERSION='/version (\\d+)/' -->\n\n" +
+			"```bash\necho $VM_IP\n```\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+		assert.Len(t, codeBlocks, 2)
+		assert.Equal(t, []Capture{
+			{Variable: "VERSION", Expression: "/version (\\d+)/"},
+			{Variable: "VM_IP", Expression: "$.publicIpAddress"},
+		}, codeBlocks[0].Captures)
+		assert.Empty(t, codeBlocks[1].Captures)
+	})
+
+	t.Run("Capture comments before any code block are ignored", func(t *testing.T) {
+		markdown := []byte("<!-- capture: VM_IP=$.publicIpAddress -->\n\n```bash\necho hi\n```\n")
+
+		document := ParseMarkdownIntoAst(markdown)
+		codeBlocks := ExtractCodeBlocksFromAst(document, markdown, []string{"bash"})
+
+		assert.Len(t, codeBlocks, 1)
+		assert.Empty(t, codeBlocks[0].Captures)
+	})
+}
@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// What secret values are replaced with wherever they're displayed.
+const Mask = "********"
+
+// Values shorter than this aren't masked, as replacing them would mangle
+// unrelated text.
+const minimumSecretLength = 4
+
+// Variable names that are treated as secrets without being marked as such.
+var secretNameRegex = regexp.MustCompile(
+	`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|CREDENTIAL|CONNECTION_?STRING|PRIVATE_?KEY|API_?KEY|ACCESS_?KEY|ACCOUNT_?KEY|(^|_)KEY$|(^|_)SAS($|_))`,
+)
+
+// A well known format of secret and what to replace it with.
+type secretPattern struct {
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// Well known formats of secrets that are masked wherever they appear.
+var secretPatterns = []secretPattern{
+	// PEM encoded private keys.
+	{
+		regex:       regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		replacement: Mask,
+	},
+	// JSON web tokens, I.E. the output of `az account get-access-token`.
+	{
+		regex:       regexp.MustCompile(`eyJ[a-zA-Z0-9_-]{10,}\.eyJ[a-zA-Z0-9_-]{10,}\.[a-zA-Z0-9_-]+`),
+		replacement: Mask,
+	},
+	// GitHub tokens.
+	{
+		regex:       regexp.MustCompile(`\b(gh[pousr]|github_pat)_[a-zA-Z0-9_]{36,}\b`),
+		replacement: Mask,
+	},
+	// AWS access key IDs.
+	{
+		regex:       regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+		replacement: Mask,
+	},
+	// Azure storage account keys.
+	{
+		regex:       regexp.MustCompile(`\b[a-zA-Z0-9+/]{86}==`),
+		replacement: Mask,
+	},
+	// Keys & signatures within connection strings and SAS URLs. The name of
+	// the key is kept for context.
+	{
+		regex:       regexp.MustCompile(`((?i)AccountKey|SharedAccessKey|Password|sig)=[^;&\s"']+`),
+		replacement: "${1}=" + Mask,
+	},
+}
+
+type registry struct {
+	sync.RWMutex
+	names  map[string]bool
+	values map[string]bool
+	// Registered values, longest first so that values containing other values
+	// are masked whole.
+	sortedValues []string
+}
+
+var secrets = registry{
+	names:  make(map[string]bool),
+	values: make(map[string]bool),
+}
+
+// Marks variables as secret, regardless of their name or value.
+func MarkAsSecret(names ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	for _, name := range names {
+		secrets.names[name] = true
+	}
+}
+
+// Registers secret values to be masked wherever they appear.
+func Register(values ...string) {
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	for _, value := range values {
+		if len(value) < minimumSecretLength || secrets.values[value] {
+			continue
+		}
+		secrets.values[value] = true
+		secrets.sortedValues = append(secrets.sortedValues, value)
+	}
+
+	sort.SliceStable(secrets.sortedValues, func(i, j int) bool {
+		return len(secrets.sortedValues[i]) > len(secrets.sortedValues[j])
+	})
+}
+
+// Checks if a variable holds a secret, either because it was marked as secret,
+// its name suggests it's a secret or its value has the format of a secret.
+func IsSecretVariable(name string, value string) bool {
+	secrets.RLock()
+	marked := secrets.names[name]
+	secrets.RUnlock()
+
+	return marked || secretNameRegex.MatchString(name) || looksLikeSecret(value)
+}
+
+// Registers the values of the variables that hold secrets.
+func RegisterVariables(variables map[string]string) {
+	for name, value := range variables {
+		if IsSecretVariable(name, value) {
+			Register(value)
+		}
+	}
+}
+
+// Masks the registered secret values & anything in the format of a secret
+// within text.
+func MaskString(text string) string {
+	secrets.RLock()
+	for _, value := range secrets.sortedValues {
+		text = strings.ReplaceAll(text, value, Mask)
+	}
+	secrets.RUnlock()
+
+	for _, pattern := range secretPatterns {
+		text = pattern.regex.ReplaceAllString(text, pattern.replacement)
+	}
+
+	return text
+}
+
+// Wraps err so that its message has secrets masked. The original error can
+// still be reached with errors.Is and errors.As.
+func MaskError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &maskedError{err: err}
+}
+
+type maskedError struct {
+	err error
+}
+
+func (e *maskedError) Error() string {
+	return MaskString(e.err.Error())
+}
+
+func (e *maskedError) Unwrap() error {
+	return e.err
+}
+
+// Returns a copy of variables with the values of secret variables masked.
+func MaskVariables(variables map[string]string) map[string]string {
+	masked := make(map[string]string, len(variables))
+	for name, value := range variables {
+		if IsSecretVariable(name, value) {
+			masked[name] = Mask
+		} else {
+			masked[name] = MaskString(value)
+		}
+	}
+	return masked
+}
+
+func looksLikeSecret(value string) bool {
+	for _, pattern := range secretPatterns {
+		if pattern.regex.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Forgets every registered secret. Only used by tests.
+func reset() {
+	secrets.Lock()
+	defer secrets.Unlock()
+
+	secrets.names = make(map[string]bool)
+	secrets.values = make(map[string]bool)
+	secrets.sortedValues = nil
+}
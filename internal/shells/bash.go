@@ -2,14 +2,20 @@ package shells
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/secrets"
 )
 
 func appendToBashHistory(command string, filePath string) error {
@@ -40,31 +46,138 @@ type CommandOutput struct {
 	StdErr string
 }
 
-type BashCommandConfiguration struct {
+type CommandConfiguration struct {
 	EnvironmentVariables map[string]string
 	InheritEnvironment   bool
 	InteractiveCommand   bool
 	WriteToHistory       bool
+	// Kills the command when it's done. Commands aren't cancelled when it's nil.
+	Context context.Context
+	// Called with each line the command writes to "stdout" or "stderr" as it
+	// runs, from a goroutine per stream. Not called for interactive commands.
+	OnOutput func(stream string, chunk string)
+	// The language of the code block the command comes from, which selects the
+	// interpreter it runs with. Commands without one run with bash.
+	Language string
+	// Runs commands in strict mode, which fails them when they use a variable
+	// that isn't set or a command of a pipeline fails. Only applies to the
+	// commands of shells.
+	Strict bool
+	// The directory the command runs in. Commands run in the working directory
+	// of the process when it's empty.
+	WorkingDirectory string
 }
 
-var ExecuteBashCommand = executeBashCommandImpl
+// Turns on strict mode for shells, leaving out pipefail for the ones that
+// don't support it.
+const strictModeCommand = "set -u; if (set -o pipefail) 2> /dev/null; then set -o pipefail; fi"
+
+// The error of a command run in strict mode that used a variable that isn't
+// set.
+type UnsetVariableError struct {
+	Variable string
+	// The line of the command the variable is used on, starting at 1.
+	Line int
+	Err  error
+}
+
+func (e *UnsetVariableError) Error() string {
+	return fmt.Sprintf("the variable %s isn't set on line %d", e.Variable, e.Line)
+}
+
+func (e *UnsetVariableError) Unwrap() error {
+	return e.Err
+}
+
+// The messages bash, zsh and sh print when a variable isn't set in strict mode.
+var unsetVariableMessage = regexp.MustCompile(
+	`(?:line |:\s?)(\d+): ([a-zA-Z_][a-zA-Z0-9_]*): (?:unbound variable|parameter not set)`,
+)
+
+// Finds the variable that wasn't set from the output of a command that failed
+// in strict mode, given the line of the script the command starts on.
+func findUnsetVariable(stderr string, commandLine int, err error) error {
+	match := unsetVariableMessage.FindStringSubmatch(stderr)
+	if match == nil {
+		return err
+	}
+	line, _ := strconv.Atoi(match[1])
+	return &UnsetVariableError{Variable: match[2], Line: line - commandLine + 1, Err: err}
+}
+
+// How long to wait for the output of a cancelled command to close.
+const cancelledCommandWaitDelay = 2 * time.Second
+
+// Executes commands with bash, or the interpreter of their language. Variables
+// exported by a command are shared with the commands that follow it through the
+// environment state file.
+type BashExecutor struct {
+	// Interpreters of languages added to or replacing DefaultInterpreters.
+	Interpreters map[string]Interpreter
+}
+
+// Finds the interpreter of a language in the interpreters of the executor first
+// and then in the default ones, falling back to bash.
+func (executor BashExecutor) Interpreter(language string) Interpreter {
+	return findInterpreter(executor.Interpreters, language)
+}
 
 // Executes a bash command and returns the output or error.
-func executeBashCommandImpl(
+func (executor BashExecutor) Execute(
 	command string,
-	config BashCommandConfiguration,
+	config CommandConfiguration,
 ) (CommandOutput, error) {
-	commandWithStateSaved := []string{
-		"set -e",
-		command,
+	interpreter := executor.Interpreter(config.Language)
+
+	// Shells run the command themselves, while bash passes it to the other
+	// interpreters as their last argument so that the state is still saved.
+	program, arguments := "bash", []string{"-c"}
+	commandToRun := "\"$@\""
+	if interpreter.Shell {
+		program = interpreter.Command[0]
+		arguments = append([]string{}, interpreter.Command[1:]...)
+		commandToRun = command
+	}
+
+	commandWithStateSaved := []string{"set -e"}
+	strict := config.Strict && interpreter.Shell
+	if strict {
+		commandWithStateSaved = append(commandWithStateSaved, strictModeCommand)
+	}
+	// The line of the script the command starts on.
+	commandLine := len(commandWithStateSaved) + 1
+	commandWithStateSaved = append(
+		commandWithStateSaved,
+		commandToRun,
 		"IE_LAST_COMMAND_EXIT_CODE=\"$?\"",
-		"env > " + lib.DefaultEnvironmentStateFile,
+		"env > "+lib.DefaultEnvironmentStateFile,
 		"exit $IE_LAST_COMMAND_EXIT_CODE",
+	)
+
+	arguments = append(arguments, strings.Join(commandWithStateSaved, "\n"))
+	if !interpreter.Shell {
+		arguments = append(arguments, "ie")
+		arguments = append(arguments, interpreter.Command...)
+		arguments = append(arguments, command)
 	}
 
-	commandToExecute := exec.Command("bash", "-c", strings.Join(commandWithStateSaved, "\n"))
+	commandToExecute := exec.Command(program, arguments...)
+	if config.Context != nil {
+		commandToExecute = exec.CommandContext(config.Context, program, arguments...)
+		// Kill the processes started by the command along with bash, unless the
+		// command needs the terminal. Any that survive may keep the output open,
+		// so stop waiting for them shortly after.
+		if !config.InteractiveCommand {
+			commandToExecute.SysProcAttr = &unix.SysProcAttr{Setpgid: true}
+			commandToExecute.Cancel = func() error {
+				return unix.Kill(-commandToExecute.Process.Pid, unix.SIGKILL)
+			}
+		}
+		commandToExecute.WaitDelay = cancelledCommandWaitDelay
+	}
 
 	var stdoutBuffer, stderrBuffer bytes.Buffer
+	var stdoutLines, stderrLines *lineWriter
 
 	// If the command requires interaction, we provide the user with the ability
 	// to interact with the command. However, we cannot capture the buffer this
@@ -76,8 +189,16 @@ func executeBashCommandImpl(
 	} else {
 		commandToExecute.Stdout = &stdoutBuffer
 		commandToExecute.Stderr = &stderrBuffer
+
+		if config.OnOutput != nil {
+			stdoutLines = newLineWriter("stdout", config.OnOutput)
+			stderrLines = newLineWriter("stderr", config.OnOutput)
+			commandToExecute.Stdout = io.MultiWriter(&stdoutBuffer, stdoutLines)
+			commandToExecute.Stderr = io.MultiWriter(&stderrBuffer, stderrLines)
+		}
 	}
 
+	commandToExecute.Dir = config.WorkingDirectory
 	if config.InheritEnvironment {
 		commandToExecute.Env = os.Environ()
 	}
@@ -114,22 +235,39 @@ func executeBashCommandImpl(
 
 	err = commandToExecute.Run()
 
+	if stdoutLines != nil {
+		stdoutLines.Flush()
+		stderrLines.Flush()
+	}
+
 	// TODO(vmarcella): Find a better way to handle this.
 	if config.InteractiveCommand {
 		return CommandOutput{}, err
 	}
 
-	standardOutput, standardError := stdoutBuffer.String(), stderrBuffer.String()
+	// Variables exported by the command may hold secrets that show up in the
+	// output of this command or the ones that follow it. The output is returned
+	// as it is, it's masked wherever it's displayed.
+	if state, stateErr := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile); stateErr == nil {
+		secrets.RegisterVariables(state)
+	}
+
+	standardOutput := stdoutBuffer.String()
+	standardError := stderrBuffer.String()
 
 	if err != nil {
+		err = fmt.Errorf(
+			"command exited with '%w' and the message '%s'",
+			err,
+			standardError,
+		)
+		if strict {
+			err = findUnsetVariable(standardError, commandLine, err)
+		}
 		return CommandOutput{
-				StdOut: standardOutput,
-				StdErr: standardError,
-			}, fmt.Errorf(
-				"command exited with '%w' and the message '%s'",
-				err,
-				standardError,
-			)
+			StdOut: standardOutput,
+			StdErr: standardError,
+		}, err
 	}
 
 	return CommandOutput{
@@ -1,16 +1,23 @@
 package shells
 
 import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/secrets"
 )
 
 func TestBashCommandExecution(t *testing.T) {
 	// Ensures that if a command succeeds, the output is returned.
 	t.Run("Valid command execution", func(t *testing.T) {
 		cmd := "printf hello"
-		result, err := ExecuteBashCommand(
+		result, err := BashExecutor{}.Execute(
 			cmd,
-			BashCommandConfiguration{
+			CommandConfiguration{
 				EnvironmentVariables: nil,
 				InheritEnvironment:   true,
 				InteractiveCommand:   false,
@@ -25,12 +32,27 @@ func TestBashCommandExecution(t *testing.T) {
 		}
 	})
 
+	// Ensures that commands run in the working directory they're given.
+	t.Run("Command runs in its working directory", func(t *testing.T) {
+		directory := t.TempDir()
+		result, err := BashExecutor{}.Execute(
+			"pwd",
+			CommandConfiguration{InheritEnvironment: true, WorkingDirectory: directory},
+		)
+		if err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+		if result.StdOut != directory+"\n" {
+			t.Errorf("Expected the command to run in '%s', got '%s'", directory, result.StdOut)
+		}
+	})
+
 	// Ensures that if a command fails, an error is returned.
 	t.Run("Invalid command execution", func(t *testing.T) {
 		cmd := "not_real_command"
-		_, err := ExecuteBashCommand(
+		_, err := BashExecutor{}.Execute(
 			cmd,
-			BashCommandConfiguration{
+			CommandConfiguration{
 				EnvironmentVariables: nil,
 				InheritEnvironment:   true,
 				InteractiveCommand:   false,
@@ -46,9 +68,9 @@ func TestBashCommandExecution(t *testing.T) {
 	// Test the execution of commands with multiple subcommands.
 	t.Run("Command with multiple subcommands", func(t *testing.T) {
 		cmd := "printf hello; printf world"
-		result, err := ExecuteBashCommand(
+		result, err := BashExecutor{}.Execute(
 			cmd,
-			BashCommandConfiguration{
+			CommandConfiguration{
 				EnvironmentVariables: nil,
 				InheritEnvironment:   true,
 				InteractiveCommand:   false,
@@ -67,9 +89,9 @@ func TestBashCommandExecution(t *testing.T) {
 	// as well.
 	t.Run("Command with multiple subcommands exits on first error", func(t *testing.T) {
 		cmd := "printf hello; not_real_command; printf world"
-		_, err := ExecuteBashCommand(
+		_, err := BashExecutor{}.Execute(
 			cmd,
-			BashCommandConfiguration{
+			CommandConfiguration{
 				EnvironmentVariables: nil,
 				InheritEnvironment:   true,
 				InteractiveCommand:   false,
@@ -86,9 +108,9 @@ func TestBashCommandExecution(t *testing.T) {
 	// the configuration.
 	t.Run("Command with environment variables", func(t *testing.T) {
 		cmd := "printf $TEST_ENV_VAR"
-		result, err := ExecuteBashCommand(
+		result, err := BashExecutor{}.Execute(
 			cmd,
-			BashCommandConfiguration{
+			CommandConfiguration{
 				EnvironmentVariables: map[string]string{
 					"TEST_ENV_VAR": "hello",
 				},
@@ -105,4 +127,119 @@ func TestBashCommandExecution(t *testing.T) {
 			t.Errorf("Expected result to be non-empty, got '%s'", result.StdOut)
 		}
 	})
+	// Ensures that secrets exported by a command are registered, while its
+	// output is returned as it is to be masked where it's displayed.
+	t.Run("Secrets are registered but not masked in the output", func(t *testing.T) {
+		cmd := "export MY_SECRET=super-secret-value; printf \"the value is $MY_SECRET\""
+		result, err := BashExecutor{}.Execute(
+			cmd,
+			CommandConfiguration{
+				EnvironmentVariables: nil,
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+			},
+		)
+		if err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+		if result.StdOut != "the value is super-secret-value" {
+			t.Errorf("Expected the output to be unmasked, got '%s'", result.StdOut)
+		}
+		if masked := secrets.MaskString(result.StdOut); masked != "the value is "+secrets.Mask {
+			t.Errorf("Expected the secret to be registered, got '%s'", masked)
+		}
+	})
+
+	// Ensures that the output is passed on line by line as the command runs.
+	t.Run("Output is streamed to OnOutput", func(t *testing.T) {
+		cmd := "printf 'one\ntwo\n'; printf 'oops\n' >&2; printf three"
+		var mutex sync.Mutex
+		chunks := map[string][]string{}
+		result, err := BashExecutor{}.Execute(
+			cmd,
+			CommandConfiguration{
+				EnvironmentVariables: nil,
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+				OnOutput: func(stream string, chunk string) {
+					mutex.Lock()
+					defer mutex.Unlock()
+					chunks[stream] = append(chunks[stream], chunk)
+				},
+			},
+		)
+		if err != nil {
+			t.Errorf("Expected err to be nil, got %v", err)
+		}
+		if result.StdOut != "one\ntwo\nthree" {
+			t.Errorf("Expected the output to still be returned, got '%s'", result.StdOut)
+		}
+
+		// The last line of stdout has no newline, so it's only passed on once the
+		// command finishes.
+		stdout := strings.Join(chunks["stdout"], "|")
+		if stdout != "one\n|two\n|three" {
+			t.Errorf("Expected stdout to be streamed line by line, got %q", stdout)
+		}
+		stderr := strings.Join(chunks["stderr"], "|")
+		if stderr != "oops\n" {
+			t.Errorf("Expected stderr to be streamed, got %q", stderr)
+		}
+	})
+
+	// Ensures that commands are killed when their context is cancelled.
+	t.Run("Command is cancelled with its context", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := BashExecutor{}.Execute(
+			"sleep 10",
+			CommandConfiguration{
+				EnvironmentVariables: nil,
+				InheritEnvironment:   true,
+				InteractiveCommand:   false,
+				WriteToHistory:       false,
+				Context:              ctx,
+			},
+		)
+
+		if err == nil {
+			t.Errorf("Expected an error to occur, but the command succeeded.")
+		}
+		if elapsed := time.Since(start); elapsed >= cancelledCommandWaitDelay {
+			t.Errorf("Expected the command to be cancelled, but it ran for %s", elapsed)
+		}
+	})
+
+	// Ensures that strict mode fails on unset variables and pipeline errors,
+	// reporting the variable that isn't set.
+	t.Run("Command runs in strict mode", func(t *testing.T) {
+		commands := map[string]string{
+			"unset variable": "echo start\necho $RESOURCE_GRUOP",
+			"pipeline error": "false | cat",
+		}
+		for name, cmd := range commands {
+			_, err := BashExecutor{}.Execute(cmd, CommandConfiguration{InheritEnvironment: true})
+			if err != nil {
+				t.Errorf("Expected the %s to be ignored outside of strict mode, got %v", name, err)
+			}
+
+			_, err = BashExecutor{}.Execute(cmd, CommandConfiguration{InheritEnvironment: true, Strict: true})
+			if err == nil {
+				t.Errorf("Expected the %s to fail in strict mode, but the command succeeded.", name)
+			}
+		}
+
+		_, err := BashExecutor{}.Execute(commands["unset variable"], CommandConfiguration{Strict: true})
+		var unset *UnsetVariableError
+		if !errors.As(err, &unset) {
+			t.Fatalf("Expected an UnsetVariableError, got %v", err)
+		}
+		if unset.Variable != "RESOURCE_GRUOP" || unset.Line != 2 {
+			t.Errorf("Expected RESOURCE_GRUOP to be reported on line 2, got %s on line %d", unset.Variable, unset.Line)
+		}
+	})
 }
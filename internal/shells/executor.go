@@ -0,0 +1,40 @@
+package shells
+
+// Executes the commands of code blocks. BashExecutor runs them with bash, and
+// other executors can run them elsewhere or fake them in tests.
+type Executor interface {
+	// Executes a command, returning its output along with an error if it
+	// failed.
+	Execute(command string, config CommandConfiguration) (CommandOutput, error)
+}
+
+// Adapts a function to the Executor interface.
+type ExecutorFunc func(command string, config CommandConfiguration) (CommandOutput, error)
+
+func (fn ExecutorFunc) Execute(command string, config CommandConfiguration) (CommandOutput, error) {
+	return fn(command, config)
+}
+
+// Implemented by executors that run code blocks with the interpreter of their
+// language, like BashExecutor.
+type InterpreterFinder interface {
+	// Finds the interpreter that runs the code blocks of a language.
+	Interpreter(language string) Interpreter
+}
+
+// Finds the interpreter executor runs the code blocks of a language with,
+// falling back to DefaultInterpreters for executors that don't say.
+func FindInterpreter(executor Executor, language string) Interpreter {
+	if finder, ok := executor.(InterpreterFinder); ok {
+		return finder.Interpreter(language)
+	}
+	return findInterpreter(nil, language)
+}
+
+// Returns executor, or a BashExecutor when it's nil.
+func ExecutorOrDefault(executor Executor) Executor {
+	if executor == nil {
+		return BashExecutor{}
+	}
+	return executor
+}
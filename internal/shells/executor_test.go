@@ -0,0 +1,27 @@
+package shells
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutors(t *testing.T) {
+	t.Run("Functions can be used as executors", func(t *testing.T) {
+		var executed string
+		executor := ExecutorFunc(func(command string, config CommandConfiguration) (CommandOutput, error) {
+			executed = command
+			return CommandOutput{StdOut: "faked\n"}, nil
+		})
+
+		output, err := executor.Execute("echo hello", CommandConfiguration{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "echo hello", executed)
+		assert.Equal(t, "faked\n", output.StdOut)
+	})
+
+	t.Run("Commands run with bash by default", func(t *testing.T) {
+		assert.Equal(t, BashExecutor{}, ExecutorOrDefault(nil))
+	})
+}
@@ -0,0 +1,101 @@
+package shells
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/InnovationEngine/internal/parsers"
+)
+
+// How the code blocks of a language are run.
+type Interpreter struct {
+	// The program and arguments that run a code block, which is passed to it as
+	// the last argument.
+	Command []string
+	// Whether the interpreter is a POSIX shell. Shells run the code block
+	// directly, so the variables it exports are shared with the code blocks that
+	// follow it. Other interpreters are started by bash, so they can read the
+	// variables of the scenario but the variables they set aren't shared.
+	Shell bool
+}
+
+// Builds the bash command line that runs content with the interpreter, which
+// receives it as its last argument.
+func (interpreter Interpreter) CommandLine(content string) string {
+	arguments := append(append([]string{}, interpreter.Command...), content)
+	for i, argument := range arguments {
+		arguments[i] = parsers.QuoteBashValue(argument)
+	}
+	return strings.Join(arguments, " ")
+}
+
+// The interpreters of the languages that code blocks can be written in. Code
+// blocks in any other language run with bash.
+var DefaultInterpreters = map[string]Interpreter{
+	"bash":                 {Command: []string{"bash", "-c"}, Shell: true},
+	"azurecli":             {Command: []string{"bash", "-c"}, Shell: true},
+	"azurecli-interactive": {Command: []string{"bash", "-c"}, Shell: true},
+	"terraform":            {Command: []string{"bash", "-c"}, Shell: true},
+	"sh":                   {Command: []string{"sh", "-c"}, Shell: true},
+	"zsh":                  {Command: []string{"zsh", "-c"}, Shell: true},
+	"python":               {Command: []string{"python3", "-c"}},
+	"pwsh":                 {Command: []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command"}},
+}
+
+// The prefix of the commands of interpreters that are POSIX shells, in the
+// format accepted by ParseInterpreter.
+const shellInterpreterPrefix = "shell:"
+
+// Parses an interpreter in the format <language>=[shell:]<command>, where the
+// command is split on whitespace and receives the code block as its last
+// argument. The shell: prefix marks POSIX shells.
+func ParseInterpreter(value string) (string, Interpreter, error) {
+	language, command, found := strings.Cut(value, "=")
+	language = strings.TrimSpace(language)
+	if !found || language == "" {
+		return "", Interpreter{}, fmt.Errorf("invalid interpreter format: %s", value)
+	}
+
+	interpreter := Interpreter{}
+	if strings.HasPrefix(command, shellInterpreterPrefix) {
+		interpreter.Shell = true
+		command = strings.TrimPrefix(command, shellInterpreterPrefix)
+	}
+
+	interpreter.Command = strings.Fields(command)
+	if len(interpreter.Command) == 0 {
+		return "", Interpreter{}, fmt.Errorf("the interpreter of %s has no command", language)
+	}
+
+	return language, interpreter, nil
+}
+
+// The languages that code blocks can be written in, those of the default
+// interpreters along with the ones of interpreters, sorted.
+func Languages(interpreters map[string]Interpreter) []string {
+	var languages []string
+	for language := range DefaultInterpreters {
+		languages = append(languages, language)
+	}
+	for language := range interpreters {
+		if _, ok := DefaultInterpreters[language]; !ok {
+			languages = append(languages, language)
+		}
+	}
+
+	sort.Strings(languages)
+	return languages
+}
+
+// Finds the interpreter of a language in interpreters first and then in the
+// default ones, falling back to bash.
+func findInterpreter(interpreters map[string]Interpreter, language string) Interpreter {
+	if interpreter, ok := interpreters[language]; ok {
+		return interpreter
+	}
+	if interpreter, ok := DefaultInterpreters[language]; ok {
+		return interpreter
+	}
+	return DefaultInterpreters["bash"]
+}
@@ -0,0 +1,111 @@
+package shells
+
+import (
+	"testing"
+
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsingInterpreters(t *testing.T) {
+	t.Run("Parse an interpreter", func(t *testing.T) {
+		language, interpreter, err := ParseInterpreter("ruby=ruby -e")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ruby", language)
+		assert.Equal(t, Interpreter{Command: []string{"ruby", "-e"}}, interpreter)
+	})
+
+	t.Run("Parse a shell interpreter", func(t *testing.T) {
+		language, interpreter, err := ParseInterpreter("ksh=shell:ksh -c")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ksh", language)
+		assert.Equal(t, Interpreter{Command: []string{"ksh", "-c"}, Shell: true}, interpreter)
+	})
+
+	t.Run("Invalid interpreters fail to parse", func(t *testing.T) {
+		for _, value := range []string{"ruby", "=ruby -e", "ruby=", "ruby=shell:"} {
+			_, _, err := ParseInterpreter(value)
+			assert.Error(t, err, value)
+		}
+	})
+
+	t.Run("Custom interpreters add their languages", func(t *testing.T) {
+		languages := Languages(map[string]Interpreter{
+			"ruby":   {Command: []string{"ruby", "-e"}},
+			"python": {Command: []string{"python3.12", "-c"}},
+		})
+
+		assert.Equal(t, []string{
+			"azurecli",
+			"azurecli-interactive",
+			"bash",
+			"pwsh",
+			"python",
+			"ruby",
+			"sh",
+			"terraform",
+			"zsh",
+		}, languages)
+	})
+}
+
+func TestRunningOtherLanguages(t *testing.T) {
+	defer lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+	config := CommandConfiguration{
+		EnvironmentVariables: map[string]string{"GREETING": "hello"},
+		InheritEnvironment:   true,
+	}
+
+	t.Run("Shells share the variables they export", func(t *testing.T) {
+		config := config
+		config.Language = "sh"
+		_, err := BashExecutor{}.Execute("export NAME=world", config)
+		assert.NoError(t, err)
+
+		config.Language = "bash"
+		output, err := BashExecutor{}.Execute("echo \"$GREETING $NAME\"", config)
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world\n", output.StdOut)
+	})
+
+	t.Run("Other interpreters read the variables of the scenario", func(t *testing.T) {
+		config := config
+		config.Language = "python"
+		output, err := BashExecutor{}.Execute(
+			"import os\nprint(os.environ['GREETING'], os.environ['NAME'])",
+			config,
+		)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "hello world\n", output.StdOut)
+	})
+
+	t.Run("Failures of other interpreters are reported", func(t *testing.T) {
+		config := config
+		config.Language = "python"
+		_, err := BashExecutor{}.Execute("import sys\nsys.exit(3)", config)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("Custom interpreters replace the default ones", func(t *testing.T) {
+		executor := BashExecutor{Interpreters: map[string]Interpreter{
+			"python": {Command: []string{"awk", "BEGIN { print \"not python\" }"}},
+			"upper":  {Command: []string{"sh", "-c", "echo \"$0\" | tr a-z A-Z"}},
+		}}
+
+		config := config
+		config.Language = "upper"
+		output, err := executor.Execute("hello", config)
+		assert.NoError(t, err)
+		assert.Equal(t, "HELLO\n", output.StdOut)
+
+		config.Language = "python"
+		output, err = executor.Execute("print('hello')", config)
+		assert.NoError(t, err)
+		assert.Equal(t, "not python\n", output.StdOut)
+	})
+}
@@ -0,0 +1,48 @@
+package shells
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Passes the output of a command to a callback as it's written, one line at a
+// time so that secrets split across writes can still be masked where the
+// output is displayed.
+type lineWriter struct {
+	mutex    sync.Mutex
+	stream   string
+	buffer   bytes.Buffer
+	callback func(stream string, chunk string)
+}
+
+func newLineWriter(stream string, callback func(stream string, chunk string)) *lineWriter {
+	return &lineWriter{stream: stream, callback: callback}
+}
+
+func (writer *lineWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.buffer.Write(data)
+	for {
+		index := bytes.IndexByte(writer.buffer.Bytes(), '\n')
+		if index < 0 {
+			break
+		}
+		line := string(writer.buffer.Next(index + 1))
+		writer.callback(writer.stream, line)
+	}
+
+	return len(data), nil
+}
+
+// Passes on whatever is left after the last newline.
+func (writer *lineWriter) Flush() {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.buffer.Len() > 0 {
+		writer.callback(writer.stream, writer.buffer.String())
+		writer.buffer.Reset()
+	}
+}
@@ -30,3 +30,11 @@ func MoveCursorPositionDown(lines int) string {
 	fmt.Print(position)
 	return position
 }
+
+// Writes text over the line a specified number of lines below the cursor,
+// leaving the cursor where it was.
+func WriteLineBelow(lines int, text string) string {
+	output := fmt.Sprintf("\0337\033[%dB\r%s\033[K\0338", lines, text)
+	fmt.Print(output)
+	return output
+}
@@ -27,4 +27,11 @@ func TestCursorManipulation(t *testing.T) {
 			t.Errorf("Expected cursor to move up 2 lines, got %s", position)
 		}
 	})
+
+	t.Run("Test writing a line below the cursor", func(t *testing.T) {
+		output := WriteLineBelow(3, "waiting")
+		if output != "\0337\033[3B\rwaiting\033[K\0338" {
+			t.Errorf("Expected the line 3 lines below to be written, got %q", output)
+		}
+	})
 }
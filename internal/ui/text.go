@@ -24,6 +24,8 @@ var (
 	CheckStyle           = lipgloss.NewStyle().Foreground(lipgloss.Color("#32CD32"))
 	ErrorStyle           = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
 	ErrorMessageStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("#FF5733"))
+	WarningStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("#FFA500"))
+	SkippedStyle         = lipgloss.NewStyle().Foreground(lipgloss.Color("#808080"))
 	OcdStatusUpdateStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#000000"))
 )
 
@@ -56,6 +58,14 @@ func CommandPrompt(language string) string {
 	return promptText + ":" + promptDollar + " "
 }
 
+// Prompt shown before the content of a code block that is written to a file
+// instead of being run.
+func FilePrompt(language string, path string) string {
+	promptText := promptTextStyle.Render(language)
+	promptArrow := promptDollarStyle.Render(">")
+	return promptText + ":" + promptArrow + " " + path + "\n"
+}
+
 // Indents a multi-line command to be nested under the first line of the
 // command.
 func IndentMultiLineCommand(content string, indentation int) string {
@@ -0,0 +1,25 @@
+package ie
+
+import "github.com/Azure/InnovationEngine/internal/engine/events"
+
+// Something that happened while running a scenario, the same events that
+// `ie test --output jsonl` writes. Which fields are set depends on the type of
+// the event.
+type Event = events.Event
+
+// The type of an event.
+type EventType = events.Type
+
+// The step of the scenario an event belongs to.
+type EventStep = events.Step
+
+// The types of events published while running a scenario.
+const (
+	EventScenarioStarted   = events.ScenarioStarted
+	EventStepStarted       = events.StepStarted
+	EventCodeBlockStarted  = events.CodeBlockStarted
+	EventOutput            = events.Output
+	EventCodeBlockFinished = events.CodeBlockFinished
+	EventWaitProgress      = events.WaitProgress
+	EventScenarioFinished  = events.ScenarioFinished
+)
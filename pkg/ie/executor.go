@@ -0,0 +1,40 @@
+package ie
+
+import "github.com/Azure/InnovationEngine/internal/shells"
+
+// Executes the commands of a scenario. Implement it to run commands somewhere
+// other than a local bash, or to fake them in tests.
+type Executor = shells.Executor
+
+// Adapts a function to the Executor interface.
+type ExecutorFunc = shells.ExecutorFunc
+
+// How an executor runs a command.
+type CommandConfiguration = shells.CommandConfiguration
+
+// The output of a command run by an executor.
+type CommandOutput = shells.CommandOutput
+
+// Runs commands with the local bash, or the interpreter of the language of
+// their code block. The default executor.
+type BashExecutor = shells.BashExecutor
+
+// How the code blocks of a language are run by a BashExecutor.
+type Interpreter = shells.Interpreter
+
+// The interpreters of the languages code blocks can be written in. Code blocks
+// in any other language run with bash. Each call returns a new map, so it can
+// be changed and given to a BashExecutor.
+func DefaultInterpreters() map[string]Interpreter {
+	interpreters := make(map[string]Interpreter, len(shells.DefaultInterpreters))
+	for language, interpreter := range shells.DefaultInterpreters {
+		interpreters[language] = interpreter
+	}
+	return interpreters
+}
+
+// The languages of DefaultInterpreters along with those of interpreters, to
+// load scenarios with custom interpreters.
+func Languages(interpreters map[string]Interpreter) []string {
+	return shells.Languages(interpreters)
+}
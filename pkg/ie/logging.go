@@ -0,0 +1,18 @@
+package ie
+
+import (
+	"io"
+
+	"github.com/Azure/InnovationEngine/internal/logging"
+)
+
+// The engine doesn't log anything until SetLogOutput is called.
+func init() {
+	logging.InitWithOutput(logging.Info, io.Discard)
+}
+
+// Writes the logs of the engine to output, with secrets masked. The level is
+// one of "trace", "debug", "info", "warn", "error" or "fatal".
+func SetLogOutput(output io.Writer, level string) {
+	logging.InitWithOutput(logging.LevelFromString(level), output)
+}
@@ -0,0 +1,302 @@
+package ie
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Azure/InnovationEngine/internal/az"
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/logging"
+	"github.com/Azure/InnovationEngine/internal/secrets"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The statuses of a code block after a run.
+const (
+	StatusPassed  = common.CodeBlockPassed
+	StatusFailed  = common.CodeBlockFailed
+	StatusSkipped = common.CodeBlockSkipped
+	StatusNotRun  = common.CodeBlockNotRun
+)
+
+// The formats reports can be written in.
+const (
+	ReportFormatJSON  = common.ReportFormatJSON
+	ReportFormatJUnit = common.ReportFormatJUnit
+	ReportFormatHTML  = common.ReportFormatHTML
+)
+
+// Options for running a scenario.
+type RunOptions struct {
+	// The directory to run the scenario in. Defaults to the working directory.
+	WorkingDirectory string
+	// The subscription used by the azure-cli commands of the scenario. Relies on
+	// the default subscription when empty.
+	Subscription string
+	// Adds a correlation ID to the user agent of the azure-cli commands.
+	CorrelationID string
+	// Selectors for the steps and code blocks to run or skip, in the format of
+	// --only and --skip.
+	Only []string
+	Skip []string
+	// Called with every event of the run as it happens. Secrets are masked.
+	OnEvent func(Event)
+	// Called with the result of each code block once it finishes or is skipped.
+	OnCodeBlock func(CodeBlockResult)
+	// Keeps what terraform configuration applied instead of destroying it once
+	// the scenario ends.
+	DoNotDelete bool
+	// Runs the commands of the scenario. Defaults to running them with bash.
+	Executor Executor
+}
+
+// The result of running a code block. Secrets are masked in its output and
+// error.
+type CodeBlockResult struct {
+	StepName        string
+	StepNumber      int
+	CodeBlockNumber int
+	Content         string
+	// One of StatusPassed, StatusFailed, StatusSkipped or StatusNotRun.
+	Status          string
+	StdOut          string
+	StdErr          string
+	Error           error
+	SimilarityScore float64
+	Duration        time.Duration
+	// The variables captured from the output of the code block. Like the
+	// variables of the result, their values aren't masked.
+	Captured map[string]string
+}
+
+// A process started by a background code block.
+type BackgroundProcess = common.BackgroundProcess
+
+// The outcome of destroying what terraform configuration applied in a
+// directory.
+type TerraformDestruction = common.TerraformDestruction
+
+// The result of running a scenario.
+type Result struct {
+	Success bool
+	// The results of every code block of the scenario, in the order they run.
+	CodeBlocks []CodeBlockResult
+	// The variables the scenario declared or changed while it ran. Unlike
+	// reports and events, their values aren't masked.
+	Variables map[string]string
+	// The processes started by background code blocks, which are stopped once
+	// the scenario ends, along with their logs.
+	BackgroundProcesses []BackgroundProcess
+	// What terraform configuration applied in each directory, destroyed once
+	// the scenario ends unless DoNotDelete is set.
+	TerraformDestructions []TerraformDestruction
+
+	report common.Report
+}
+
+// Writes a report of the run in the format given, one of ReportFormatJSON,
+// ReportFormatJUnit or ReportFormatHTML.
+func (result *Result) WriteReport(path string, format string) error {
+	if !common.IsValidReportFormat(format) {
+		return fmt.Errorf("invalid report format: %s", format)
+	}
+	return result.report.WriteToFile(path, format)
+}
+
+func newCodeBlockResult(block common.StatefulCodeBlock) CodeBlockResult {
+	return CodeBlockResult{
+		StepName:        block.StepName,
+		StepNumber:      block.StepNumber,
+		CodeBlockNumber: block.CodeBlockNumber,
+		Content:         block.CodeBlock.Content,
+		Status:          block.Status(),
+		StdOut:          secrets.MaskString(block.StdOut),
+		StdErr:          secrets.MaskString(block.StdErr),
+		Error:           secrets.MaskError(block.Error),
+		SimilarityScore: block.SimilarityScore,
+		Duration:        time.Duration(block.DurationSeconds * float64(time.Second)),
+		Captured:        block.Captured,
+	}
+}
+
+// Code blocks share their variables through a state file, so only one
+// scenario can run at a time.
+var runMutex sync.Mutex
+
+// Runs a scenario, comparing the output of each code block with its expected
+// output and stopping at the first code block that fails, just like ie test
+// does. Returns an error when the scenario didn't succeed, along with the
+// result of the run if it started. Secrets are masked in the error.
+// Cancelling ctx kills the code block that is running and stops the scenario.
+//
+// The commands of the scenario run in options.WorkingDirectory, without
+// changing the working directory of the process. Scenarios run one at a
+// time: running one while another is running waits for it to finish.
+func Run(ctx context.Context, scenario *Scenario, options RunOptions) (*Result, error) {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+
+	filter, err := common.NewBlockFilter(options.Only, options.Skip)
+	if err != nil {
+		return nil, err
+	}
+
+	workingDirectory, err := filepath.Abs(options.WorkingDirectory)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(workingDirectory); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("the working directory '%s' isn't a directory", workingDirectory)
+	}
+	options.WorkingDirectory = workingDirectory
+
+	if options.OnEvent != nil {
+		unsubscribe := common.Events.Subscribe(options.OnEvent)
+		defer unsubscribe()
+	}
+
+	options.Executor = shells.ExecutorOrDefault(options.Executor)
+
+	if err := az.SetSubscription(options.Executor, options.Subscription); err != nil {
+		return nil, secrets.MaskError(err)
+	}
+
+	result, err := run(ctx, scenario.scenario, filter, options)
+	return result, secrets.MaskError(err)
+}
+
+func run(
+	ctx context.Context,
+	scenario *common.Scenario,
+	filter common.BlockFilter,
+	options RunOptions,
+) (result *Result, err error) {
+	environment := lib.CopyMap(scenario.Environment)
+	az.SetCorrelationId(options.CorrelationID, environment)
+	initialEnvironmentVariables := lib.GetEnvironmentVariables()
+
+	common.PublishScenarioStarted(scenario.Name, common.ModeTest, len(scenario.Steps))
+	defer func() { common.PublishScenarioFinished(err) }()
+
+	var codeBlocks []common.StatefulCodeBlock
+	for stepNumber, step := range scenario.Steps {
+		for blockNumber, block := range step.CodeBlocks {
+			codeBlock := common.StatefulCodeBlock{
+				CodeBlock:       block,
+				CodeBlockNumber: blockNumber,
+				StepName:        step.Name,
+				StepNumber:      stepNumber,
+			}
+
+			// Code blocks after the one that failed aren't run, but are still
+			// part of the result.
+			if err == nil {
+				codeBlock, err = runCodeBlock(ctx, options, codeBlock, environment, filter, step)
+				if codeBlock.WasExecuted() || codeBlock.Skipped {
+					if options.OnCodeBlock != nil {
+						options.OnCodeBlock(newCodeBlockResult(codeBlock))
+					}
+				}
+			}
+			codeBlocks = append(codeBlocks, codeBlock)
+		}
+	}
+
+	backgroundProcesses := common.StopBackgroundProcesses(options.Executor)
+	var terraformDestructions []TerraformDestruction
+	if options.DoNotDelete {
+		common.ForgetTerraformDirectories()
+	} else {
+		terraformDestructions = common.DestroyTerraformConfigurations(options.Executor, environment)
+	}
+
+	allEnvironmentVariables, envErr := lib.LoadEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+	if envErr != nil {
+		logging.GlobalLogger.Warnf("Failed to load environment state file: %s", envErr)
+		allEnvironmentVariables = make(map[string]string)
+	}
+	lib.DeleteEnvironmentStateFile(lib.DefaultEnvironmentStateFile)
+
+	variables := lib.DiffMapsByKey(allEnvironmentVariables, initialEnvironmentVariables)
+
+	result = &Result{
+		Success:               err == nil,
+		Variables:             variables,
+		BackgroundProcesses:   backgroundProcesses,
+		TerraformDestructions: terraformDestructions,
+		report:                common.BuildReport(scenario.Name),
+	}
+	result.report.
+		WithProperties(scenario.Properties).
+		WithEnvironmentVariables(variables).
+		WithSeed(scenario.Seed).
+		WithError(err).
+		WithCodeBlocks(codeBlocks).
+		WithBackgroundProcesses(backgroundProcesses)
+
+	for _, codeBlock := range codeBlocks {
+		result.CodeBlocks = append(result.CodeBlocks, newCodeBlockResult(codeBlock))
+	}
+
+	return result, err
+}
+
+// Runs a code block unless it's skipped, returning its state afterwards and
+// an error if the scenario can't continue.
+func runCodeBlock(
+	ctx context.Context,
+	options RunOptions,
+	codeBlock common.StatefulCodeBlock,
+	environment map[string]string,
+	filter common.BlockFilter,
+	step common.Step,
+) (common.StatefulCodeBlock, error) {
+	if filter.IsSkipped(step, codeBlock.StepNumber, codeBlock.CodeBlockNumber) {
+		codeBlock.Skipped = true
+		common.PublishCodeBlockSkipped(codeBlock)
+		return codeBlock, nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return codeBlock, err
+	}
+
+	result := common.RunCodeBlock(options.Executor, codeBlock, shells.CommandConfiguration{
+		EnvironmentVariables: lib.CopyMap(environment),
+		InheritEnvironment:   true,
+		InteractiveCommand:   false,
+		WriteToHistory:       false,
+		Context:              ctx,
+		WorkingDirectory:     options.WorkingDirectory,
+	})
+	codeBlock.StdOut = result.StdOut
+	codeBlock.StdErr = result.StdErr
+	codeBlock.Error = result.Error
+	codeBlock.Success = result.Error == nil
+	codeBlock.SimilarityScore = result.SimilarityScore
+	codeBlock.DurationSeconds = result.Duration.Seconds()
+	codeBlock.Captured = result.Captured
+	codeBlock.Variables = result.Variables
+
+	if result.Error == nil {
+		return codeBlock, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return codeBlock, errors.Join(err, result.Error)
+	}
+	return codeBlock, fmt.Errorf(
+		"failed to execute code block %d on step %d.\nError: %s\nStdErr: %s",
+		codeBlock.CodeBlockNumber,
+		codeBlock.StepNumber,
+		codeBlock.Error,
+		codeBlock.StdErr,
+	)
+}
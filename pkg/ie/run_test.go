@@ -0,0 +1,316 @@
+package ie
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const greetingScenario = "# Greetings\n\n" +
+	"## Greet\n\n" +
+	"```bash\nexport GREETING=hello\necho $GREETING\n```\n\n" +
+	"<!-- expected_similarity=1.0 -->\n\n" +
+	"```text\nhello\n```\n\n" +
+	"## Wave\n\n" +
+	"```bash\necho wave\n```\n"
+
+func TestLoadingScenarios(t *testing.T) {
+	t.Run("Parse a scenario from memory", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(greetingScenario), LoadOptions{Seed: 7})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Greetings", scenario.Name())
+		assert.Equal(t, int64(7), scenario.Seed())
+
+		steps := scenario.Steps()
+		assert.Len(t, steps, 2)
+		assert.Equal(t, "Greet", steps[0].Name)
+		assert.Equal(t, "hello\n", steps[0].CodeBlocks[0].ExpectedOutput)
+		assert.Equal(t, "echo wave\n", steps[1].CodeBlocks[0].Content)
+	})
+
+	t.Run("Load a scenario from a file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "greetings.md")
+		assert.NoError(t, os.WriteFile(path, []byte(greetingScenario), 0644))
+
+		scenario, err := LoadScenario(path, LoadOptions{Variables: map[string]string{"NAME": "world"}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Greetings", scenario.Name())
+		assert.Equal(t, "world", scenario.Variables()["NAME"])
+		assert.NotZero(t, scenario.Seed())
+	})
+
+	t.Run("Loading a missing file fails", func(t *testing.T) {
+		_, err := LoadScenario(filepath.Join(t.TempDir(), "missing.md"), LoadOptions{})
+		assert.Error(t, err)
+	})
+}
+
+func TestRunningScenarios(t *testing.T) {
+	t.Run("Run a scenario that succeeds", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(greetingScenario), LoadOptions{})
+		assert.NoError(t, err)
+
+		var eventTypes []EventType
+		var finished []CodeBlockResult
+		result, err := Run(context.Background(), scenario, RunOptions{
+			WorkingDirectory: t.TempDir(),
+			OnEvent:          func(event Event) { eventTypes = append(eventTypes, event.Type) },
+			OnCodeBlock:      func(codeBlock CodeBlockResult) { finished = append(finished, codeBlock) },
+		})
+
+		assert.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, "hello", result.Variables["GREETING"])
+
+		assert.Len(t, result.CodeBlocks, 2)
+		assert.Equal(t, StatusPassed, result.CodeBlocks[0].Status)
+		assert.Equal(t, "hello\n", result.CodeBlocks[0].StdOut)
+		assert.Equal(t, 1.0, result.CodeBlocks[0].SimilarityScore)
+		assert.Equal(t, "Wave", result.CodeBlocks[1].StepName)
+		assert.Equal(t, result.CodeBlocks, finished)
+
+		assert.Equal(t, EventScenarioStarted, eventTypes[0])
+		assert.Equal(t, EventStepStarted, eventTypes[1])
+		assert.Contains(t, eventTypes, EventOutput)
+		assert.Equal(t, EventScenarioFinished, eventTypes[len(eventTypes)-1])
+
+		reportPath := filepath.Join(t.TempDir(), "report.json")
+		assert.NoError(t, result.WriteReport(reportPath, ReportFormatJSON))
+		assert.FileExists(t, reportPath)
+		assert.Error(t, result.WriteReport(reportPath, "yaml"))
+	})
+
+	t.Run("Run a scenario that fails", func(t *testing.T) {
+		markdown := "# Failing\n\n## Fail\n\n```bash\nexit 3\n```\n\n## Never\n\n```bash\necho never\n```\n"
+		scenario, err := ParseScenario([]byte(markdown), LoadOptions{})
+		assert.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, RunOptions{WorkingDirectory: t.TempDir()})
+
+		assert.Error(t, err)
+		assert.False(t, result.Success)
+		assert.Equal(t, StatusFailed, result.CodeBlocks[0].Status)
+		assert.Error(t, result.CodeBlocks[0].Error)
+		assert.Equal(t, StatusNotRun, result.CodeBlocks[1].Status)
+	})
+
+	t.Run("Run a scenario in strict mode", func(t *testing.T) {
+		markdown := "# Strict\n\n## Optional\n\n```bash {strict=false}\necho \"[$OPTIONAL]\"\n```\n\n" +
+			"## Typo\n\n```bash\nexport REGION=eastus\necho $REGOIN\n```\n"
+		scenario, err := ParseScenario([]byte(markdown), LoadOptions{Strict: true})
+		assert.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, RunOptions{WorkingDirectory: t.TempDir()})
+
+		assert.Error(t, err)
+		assert.Equal(t, StatusPassed, result.CodeBlocks[0].Status)
+		assert.Equal(t, "[]\n", result.CodeBlocks[0].StdOut)
+		assert.Equal(t, StatusFailed, result.CodeBlocks[1].Status)
+		assert.EqualError(
+			t,
+			result.CodeBlocks[1].Error,
+			"the variable REGOIN isn't set on line 2 of code block 1 in step 2 (Typo)",
+		)
+	})
+
+	t.Run("Skip code blocks", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(greetingScenario), LoadOptions{})
+		assert.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, RunOptions{
+			WorkingDirectory: t.TempDir(),
+			Skip:             []string{"1"},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, StatusSkipped, result.CodeBlocks[0].Status)
+		assert.Equal(t, StatusPassed, result.CodeBlocks[1].Status)
+	})
+
+	t.Run("Invalid selectors fail before running", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(greetingScenario), LoadOptions{})
+		assert.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, RunOptions{Only: []string{"1.2.3"}})
+
+		assert.Error(t, err)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Run the commands with a custom executor", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(greetingScenario), LoadOptions{})
+		assert.NoError(t, err)
+
+		var commands []string
+		executor := ExecutorFunc(func(command string, config CommandConfiguration) (CommandOutput, error) {
+			commands = append(commands, command)
+			return CommandOutput{StdOut: "hello\n"}, nil
+		})
+
+		result, err := Run(context.Background(), scenario, RunOptions{
+			WorkingDirectory: t.TempDir(),
+			Subscription:     "fake-subscription",
+			Executor:         executor,
+		})
+
+		assert.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, []string{
+			"az account set --subscription fake-subscription",
+			"export GREETING=hello\necho $GREETING\n",
+			"echo wave\n",
+		}, commands)
+		assert.Equal(t, "hello\n", result.CodeBlocks[1].StdOut)
+	})
+
+	t.Run("Terraform configuration is destroyed when the scenario ends", func(t *testing.T) {
+		markdown := "# Terraform\n\n## Apply\n\n```terraform\nterraform {}\n```\n"
+		scenario, err := ParseScenario([]byte(markdown), LoadOptions{})
+		assert.NoError(t, err)
+
+		for _, doNotDelete := range []bool{false, true} {
+			var commands []string
+			executor := ExecutorFunc(func(command string, config CommandConfiguration) (CommandOutput, error) {
+				commands = append(commands, command)
+				return CommandOutput{}, nil
+			})
+
+			result, err := Run(context.Background(), scenario, RunOptions{
+				WorkingDirectory: t.TempDir(),
+				DoNotDelete:      doNotDelete,
+				Executor:         executor,
+			})
+			assert.NoError(t, err)
+
+			// The configuration is applied in a directory of its own.
+			var directory string
+			for _, command := range commands {
+				if match := regexp.MustCompile(`terraform -chdir=(\S+) init`).FindStringSubmatch(command); match != nil {
+					directory = match[1]
+				}
+			}
+			assert.NotEmpty(t, directory)
+
+			destroy := "terraform -chdir=" + directory + " destroy -auto-approve -input=false -no-color"
+			if doNotDelete {
+				assert.Empty(t, result.TerraformDestructions)
+				assert.NotContains(t, commands, destroy)
+				assert.DirExists(t, directory)
+				os.RemoveAll(directory)
+			} else {
+				assert.Equal(t, []TerraformDestruction{{Directory: directory}}, result.TerraformDestructions)
+				assert.Equal(t, destroy, commands[len(commands)-1])
+				assert.NoDirExists(t, directory)
+			}
+		}
+	})
+
+	t.Run("Run in the working directory without changing the one of the process", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte("# Where\n\n## Print\n\n```bash\npwd\n```\n"), LoadOptions{})
+		assert.NoError(t, err)
+
+		processDirectory, err := os.Getwd()
+		assert.NoError(t, err)
+		directory := t.TempDir()
+
+		var directoriesDuringRun []string
+		result, err := Run(context.Background(), scenario, RunOptions{
+			WorkingDirectory: directory,
+			OnCodeBlock: func(CodeBlockResult) {
+				current, _ := os.Getwd()
+				directoriesDuringRun = append(directoriesDuringRun, current)
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, directory+"\n", result.CodeBlocks[0].StdOut)
+		assert.Equal(t, []string{processDirectory}, directoriesDuringRun)
+	})
+
+	t.Run("Working directories that don't exist are rejected", func(t *testing.T) {
+		scenario, err := ParseScenario([]byte(greetingScenario), LoadOptions{})
+		assert.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, RunOptions{
+			WorkingDirectory: filepath.Join(t.TempDir(), "missing"),
+		})
+
+		assert.Error(t, err)
+		assert.Nil(t, result)
+	})
+
+	t.Run("Run code blocks in other languages", func(t *testing.T) {
+		markdown := "# Languages\n\n" +
+			"## Python\n\n```python\nimport os\nprint(os.environ['NAME'])\n```\n\n" +
+			"## Custom\n\n```shout\nhello\n```\n"
+		interpreters := map[string]Interpreter{"shout": {Command: []string{"printf", "%s"}}}
+
+		scenario, err := ParseScenario([]byte(markdown), LoadOptions{
+			Variables: map[string]string{"NAME": "world"},
+			Languages: Languages(interpreters),
+		})
+		assert.NoError(t, err)
+
+		result, err := Run(context.Background(), scenario, RunOptions{
+			WorkingDirectory: t.TempDir(),
+			Executor:         BashExecutor{Interpreters: interpreters},
+		})
+
+		assert.NoError(t, err)
+		// The first code block exports the variables set when loading.
+		assert.Equal(t, "world\n", result.CodeBlocks[1].StdOut)
+		assert.Equal(t, "hello\n", result.CodeBlocks[2].StdOut)
+	})
+
+	t.Run("Changing the default interpreters doesn't change those of other runs", func(t *testing.T) {
+		interpreters := DefaultInterpreters()
+		interpreters["python"] = Interpreter{Command: []string{"false"}}
+		delete(interpreters, "bash")
+
+		assert.Contains(t, DefaultInterpreters(), "bash")
+		assert.NotEqual(t, []string{"false"}, DefaultInterpreters()["python"].Command)
+	})
+
+	t.Run("Background processes are stopped when the scenario ends", func(t *testing.T) {
+		markdown := "# Serve\n\n" +
+			"## Start\n\n```bash {background}\necho serving\nsleep 60\n```\n\n" +
+			"## Wait\n\n```bash\nsleep 0.5\n```\n"
+		scenario, err := ParseScenario([]byte(markdown), LoadOptions{})
+		assert.NoError(t, err)
+
+		start := time.Now()
+		result, err := Run(context.Background(), scenario, RunOptions{WorkingDirectory: t.TempDir()})
+
+		assert.NoError(t, err)
+		assert.Less(t, time.Since(start), 30*time.Second)
+		assert.Equal(t, StatusPassed, result.CodeBlocks[0].Status)
+		assert.Len(t, result.BackgroundProcesses, 1)
+		assert.Equal(t, "serving\n", result.BackgroundProcesses[0].Logs)
+	})
+
+	t.Run("Cancelling the context stops the scenario", func(t *testing.T) {
+		markdown := "# Slow\n\n## Wait\n\n```bash\nsleep 10\n```\n\n## Never\n\n```bash\necho never\n```\n"
+		scenario, err := ParseScenario([]byte(markdown), LoadOptions{})
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		result, err := Run(ctx, scenario, RunOptions{WorkingDirectory: t.TempDir()})
+
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Less(t, time.Since(start), 5*time.Second)
+		assert.False(t, result.Success)
+		assert.Equal(t, StatusFailed, result.CodeBlocks[0].Status)
+		assert.Equal(t, StatusNotRun, result.CodeBlocks[1].Status)
+	})
+}
@@ -0,0 +1,153 @@
+// Package ie embeds Innovation Engine in Go programs. It loads executable
+// documents into scenarios and runs them without a terminal, reporting the
+// results and events of a run through callbacks instead of writing to stdout.
+//
+// Some of its types, like Executor, Interpreter, Event and BackgroundProcess,
+// are aliases of the types the ie CLI uses internally. Their fields may change
+// between releases, unlike the functions and types defined by this package.
+package ie
+
+import (
+	"github.com/Azure/InnovationEngine/internal/engine/common"
+	"github.com/Azure/InnovationEngine/internal/lib"
+	"github.com/Azure/InnovationEngine/internal/shells"
+)
+
+// The languages of the code blocks that are run when LoadOptions doesn't list
+// any, the same ones the ie CLI runs: those of DefaultInterpreters.
+var DefaultLanguages = shells.Languages(nil)
+
+// Options for loading a scenario.
+type LoadOptions struct {
+	// Overrides the variables declared by the scenario, like --var does.
+	Variables map[string]string
+	// Dotenv or INI files to load variables from, like --env-file does.
+	EnvFiles []string
+	// The section of the INI files to load variables from, like --profile does.
+	Profile string
+	// Seeds the values generated by the variables block of the scenario. A new
+	// seed is used when it's 0.
+	Seed int64
+	// The languages of the code blocks to run. Defaults to DefaultLanguages.
+	// Languages run by custom interpreters need to be listed, see Languages.
+	Languages []string
+	// Runs the code blocks in strict mode, like --strict does. They fail when
+	// they use a variable that isn't set or a command of a pipeline fails,
+	// unless they opt out with {strict=false}.
+	Strict bool
+}
+
+// A code block of a scenario.
+type CodeBlock struct {
+	Language    string
+	Content     string
+	Header      string
+	Description string
+	// The output the code block is expected to write, empty if it isn't checked.
+	ExpectedOutput string
+}
+
+// A step of a scenario, made of the code blocks under one of its headings.
+type Step struct {
+	Name       string
+	CodeBlocks []CodeBlock
+}
+
+// An executable document that was loaded and is ready to run.
+type Scenario struct {
+	scenario *common.Scenario
+}
+
+func (options LoadOptions) withDefaults() LoadOptions {
+	if len(options.Languages) == 0 {
+		options.Languages = DefaultLanguages
+	}
+	if options.Seed == 0 {
+		options.Seed = lib.NewSeed()
+	}
+	return options
+}
+
+func newScenario(scenario *common.Scenario, options LoadOptions) *Scenario {
+	if options.Strict {
+		scenario.EnableStrictMode()
+	}
+	return &Scenario{scenario: scenario}
+}
+
+// Loads a scenario from a markdown file or the URL of one. INI files paired
+// with the markdown and env files it lists are loaded relative to it.
+func LoadScenario(path string, options LoadOptions) (*Scenario, error) {
+	options = options.withDefaults()
+
+	scenario, err := common.CreateScenarioFromMarkdown(
+		path,
+		options.Languages,
+		options.Variables,
+		options.Profile,
+		options.EnvFiles,
+		options.Seed,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return newScenario(scenario, options), nil
+}
+
+// Loads a scenario from markdown held in memory. Env files it lists are
+// loaded relative to the working directory.
+func ParseScenario(markdown []byte, options LoadOptions) (*Scenario, error) {
+	options = options.withDefaults()
+
+	scenario, err := common.CreateScenarioFromSource(
+		"",
+		markdown,
+		options.Languages,
+		options.Variables,
+		options.Profile,
+		options.EnvFiles,
+		options.Seed,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return newScenario(scenario, options), nil
+}
+
+// The title of the scenario.
+func (s *Scenario) Name() string {
+	return s.scenario.Name
+}
+
+// The steps of the scenario, in the order they run.
+func (s *Scenario) Steps() []Step {
+	var steps []Step
+	for _, step := range s.scenario.Steps {
+		var codeBlocks []CodeBlock
+		for _, block := range step.CodeBlocks {
+			codeBlocks = append(codeBlocks, CodeBlock{
+				Language:       block.Language,
+				Content:        block.Content,
+				Header:         block.Header,
+				Description:    block.Description,
+				ExpectedOutput: block.ExpectedOutput.Content,
+			})
+		}
+		steps = append(steps, Step{Name: step.Name, CodeBlocks: codeBlocks})
+	}
+	return steps
+}
+
+// The variables the scenario starts with, after the variables block, env files
+// and overrides were applied.
+func (s *Scenario) Variables() map[string]string {
+	return lib.CopyMap(s.scenario.Environment)
+}
+
+// The seed used to generate the values of the variables block. Loading the
+// scenario again with the same seed generates the same values.
+func (s *Scenario) Seed() int64 {
+	return s.scenario.Seed
+}